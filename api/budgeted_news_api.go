@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ProviderNewsAPI is the name of the NewsAPI budget, see services.QuotaAccountant
+const ProviderNewsAPI = "newsapi"
+
+// BudgetedNewsAPI counts the fetches of a NewsAPI against the daily budget of its provider. When an ad-hoc fetch is
+// refused, the cached articles are returned instead, so API clients keep getting news while the reserve of the budget
+// is kept for the scheduled refresh. A refused scheduled fetch returns the services.BudgetError, to be retried after
+// its reset.
+//
+// The outcome of every fetch reaching the NewsAPI is recorded with datastore.RecordFetch, for the readiness checks.
+type BudgetedNewsAPI struct {
+	newsAPI    NewsAPI
+	accountant *services.QuotaAccountant
+	provider   string
+	cache      datastore.Cache
+
+	// Breaker, when set, is the circuit breaker of the provider, checked before charging the budget so fetches its open
+	// circuit refuses don't use it up
+	Breaker *resilience.Breaker
+}
+
+func NewBudgetedNewsAPI(newsAPI NewsAPI, accountant *services.QuotaAccountant, provider string, cache datastore.Cache) *BudgetedNewsAPI {
+	return &BudgetedNewsAPI{
+		newsAPI:    newsAPI,
+		accountant: accountant,
+		provider:   provider,
+		cache:      cache,
+	}
+}
+
+func (b *BudgetedNewsAPI) FetchEverythingHacking(ctx context.Context) (map[string]models.NewsArticle, error) {
+	if b.Breaker != nil {
+		if err := b.Breaker.Check(); err != nil {
+			return nil, err
+		}
+	}
+	err := b.accountant.Acquire(ctx, b.provider)
+	if err == nil {
+		news, err := b.newsAPI.FetchEverythingHacking(ctx)
+		if ctx.Err() != nil {
+			// cancelled by the caller, which tells nothing about the provider
+			return news, err
+		}
+		if recordErr := datastore.RecordFetch(ctx, b.cache, services.TopicHacking, b.provider, time.Now(), err); recordErr != nil {
+			slog.ErrorContext(ctx, "failed to record fetch", logging.KeyTopic, services.TopicHacking, logging.KeyProvider, b.provider, logging.Err(recordErr))
+		}
+		return news, err
+	}
+	if !errors.Is(err, services.ErrBudgetExhausted) || services.PriorityFromContext(ctx) == services.PriorityScheduled {
+		return nil, err
+	}
+
+	slog.WarnContext(ctx, "upstream budget exhausted, serving cached articles", logging.KeyProvider, b.provider, logging.Err(err))
+	articles, cacheErr := datastore.GetArticles(ctx, b.cache)
+	if cacheErr != nil || len(articles) == 0 {
+		return nil, err
+	}
+	news := make(map[string]models.NewsArticle, len(articles))
+	for _, article := range articles {
+		if article.Topic == "" || article.Topic == services.TopicHacking {
+			news[article.ID] = article
+		}
+	}
+	return news, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingNewsAPI counts the fetches that reach it
+type countingNewsAPI struct {
+	calls int
+}
+
+func (c *countingNewsAPI) FetchEverythingHacking(context.Context) (map[string]models.NewsArticle, error) {
+	c.calls++
+	return map[string]models.NewsArticle{"fresh": {ID: "fresh", Topic: services.TopicHacking}}, nil
+}
+
+func TestBudgetedNewsAPI(t *testing.T) {
+	ctx := context.Background()
+	scheduled := services.WithPriority(ctx, services.PriorityScheduled)
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		cached        bool
+		expectedIDs   []string
+		expectedCalls int
+		expectedErr   bool
+	}{
+		{name: "Ad-hoc fetches are served from cache", ctx: ctx, cached: true, expectedIDs: []string{"cached"}, expectedCalls: 1},
+		{name: "Ad-hoc fetches fail without cache", ctx: ctx, expectedCalls: 1, expectedErr: true},
+		{name: "Scheduled fetches use the reserve", ctx: scheduled, expectedIDs: []string{"fresh"}, expectedCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := datastore.NewMemoryCache()
+			if tt.cached {
+				if err := datastore.SetArticle(ctx, cache, models.NewsArticle{ID: "cached", Topic: services.TopicHacking}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			upstream := &countingNewsAPI{}
+			accountant := services.NewQuotaAccountant(cache, map[string]services.Budget{ProviderNewsAPI: {Limit: 2, Reserve: 1}})
+			newsAPI := NewBudgetedNewsAPI(upstream, accountant, ProviderNewsAPI, cache)
+
+			// the first fetch fits in the budget, the second one reaches the reserve
+			if _, err := newsAPI.FetchEverythingHacking(tt.ctx); err != nil {
+				t.Fatalf("expected the first fetch to fit in the budget, got %v", err)
+			}
+			news, err := newsAPI.FetchEverythingHacking(tt.ctx)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil && !errors.Is(err, services.ErrBudgetExhausted) {
+				t.Errorf("expected %v, got %v", services.ErrBudgetExhausted, err)
+			}
+			if upstream.calls != tt.expectedCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.expectedCalls, upstream.calls)
+			}
+			for _, id := range tt.expectedIDs {
+				if _, ok := news[id]; !ok || len(news) != len(tt.expectedIDs) {
+					t.Errorf("expected articles %v, got %v", tt.expectedIDs, news)
+				}
+			}
+		})
+	}
+}
+
+// cancelledNewsAPI fails as a fetch whose caller gave up
+type cancelledNewsAPI struct{}
+
+func (cancelledNewsAPI) FetchEverythingHacking(ctx context.Context) (map[string]models.NewsArticle, error) {
+	return nil, ctx.Err()
+}
+
+func TestBudgetedNewsAPICancelled(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	accountant := services.NewQuotaAccountant(cache, map[string]services.Budget{ProviderNewsAPI: {Limit: 2}})
+	newsAPI := NewBudgetedNewsAPI(cancelledNewsAPI{}, accountant, ProviderNewsAPI, cache)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newsAPI.FetchEverythingHacking(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the fetch to be cancelled, got %v", err)
+	}
+	// the fetch was never recorded
+	if _, err := datastore.GetFetchStatus(context.Background(), cache, services.TopicHacking); !errors.Is(err, datastore.ErrNotFound) {
+		t.Errorf("expected a cancelled fetch not to be recorded, got %v", err)
+	}
+}
+
+func TestBudgetedNewsAPICircuitOpen(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	accountant := services.NewQuotaAccountant(cache, map[string]services.Budget{ProviderNewsAPI: {Limit: 100}})
+	upstream := &countingNewsAPI{}
+	newsAPI := NewBudgetedNewsAPI(upstream, accountant, ProviderNewsAPI, cache)
+	newsAPI.Breaker = resilience.NewBreaker(ProviderNewsAPI, resilience.BreakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	newsAPI.Breaker.Failure()
+
+	for range 5 {
+		if _, err := newsAPI.FetchEverythingHacking(ctx); !errors.Is(err, resilience.ErrCircuitOpen) {
+			t.Fatalf("expected %v, got %v", resilience.ErrCircuitOpen, err)
+		}
+	}
+	if upstream.calls != 0 {
+		t.Errorf("expected no fetch, got %d", upstream.calls)
+	}
+	// the budget is untouched
+	if used, err := datastore.GetUpstreamCalls(ctx, cache, ProviderNewsAPI, time.Now()); err != nil || used != 0 {
+		t.Errorf("expected no call charged to the budget, got %d (%v)", used, err)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultFetchTimeout is how long a provider is waited for when no timeout is set for the topic fetched
+const DefaultFetchTimeout = 500 * time.Millisecond
+
+// FetchTimeouts are how long a provider is waited for, per topic
+type FetchTimeouts struct {
+	Default time.Duration            // The timeout of the topics without one
+	Topics  map[string]time.Duration // The timeouts by topic
+}
+
+// For returns the timeout of a topic
+func (t FetchTimeouts) For(topic string) time.Duration {
+	if timeout, ok := t.Topics[topic]; ok {
+		return timeout
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultFetchTimeout
+}
+
+// ParseTopicTimeouts parses comma separated "<topic>=<duration>" pairs, e.g. "hacking=2s,cloud=1500ms"
+func ParseTopicTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		topic, rawTimeout, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(topic) == "" {
+			return nil, fmt.Errorf("invalid topic timeout %q, expected <topic>=<duration>", pair)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(rawTimeout))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout of topic %q: %w", topic, err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout of topic %q: must be positive", topic)
+		}
+		timeouts[strings.TrimSpace(topic)] = timeout
+	}
+	return timeouts, nil
+}
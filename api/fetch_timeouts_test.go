@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTopicTimeouts(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    map[string]time.Duration
+		expectedErr bool
+	}{
+		{value: "", expected: map[string]time.Duration{}},
+		{value: "hacking=2s", expected: map[string]time.Duration{"hacking": 2 * time.Second}},
+		{value: "hacking=2s, cloud=1500ms", expected: map[string]time.Duration{"hacking": 2 * time.Second, "cloud": 1500 * time.Millisecond}},
+		{value: "hacking", expectedErr: true},
+		{value: "=2s", expectedErr: true},
+		{value: "hacking=soon", expectedErr: true},
+		{value: "hacking=0s", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			timeouts, err := ParseTopicTimeouts(tt.value)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(timeouts) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, timeouts)
+			}
+			for topic, timeout := range tt.expected {
+				if timeouts[topic] != timeout {
+					t.Errorf("expected %v for %s, got %v", timeout, topic, timeouts[topic])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchTimeoutsFor(t *testing.T) {
+	timeouts := FetchTimeouts{Default: time.Second, Topics: map[string]time.Duration{"hacking": 2 * time.Second}}
+	if timeout := timeouts.For("hacking"); timeout != 2*time.Second {
+		t.Errorf("expected the timeout of the topic, got %v", timeout)
+	}
+	if timeout := timeouts.For("cloud"); timeout != time.Second {
+		t.Errorf("expected the default timeout, got %v", timeout)
+	}
+	if timeout := (FetchTimeouts{}).For("cloud"); timeout != DefaultFetchTimeout {
+		t.Errorf("expected %v when no default is set, got %v", DefaultFetchTimeout, timeout)
+	}
+}
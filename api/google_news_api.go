@@ -2,16 +2,16 @@ package api
 
 import (
 	"context"
-	"crypto/md5"
 	"devbriefs-news/models"
 	"devbriefs-news/services"
+	"devbriefs-news/upstream"
 	"fmt"
-	"github.com/semper-proficiens/go-utils/web/securehttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"time"
 )
 
-// googleNewsTimeout is the time we want to make our go routines wait for a Google News API response in milliseconds
-const googleNewsTimeout = 500
+var tracer = otel.Tracer("devbriefs-news/api")
 
 type NewsAPIResponse struct {
 	articles []models.NewsArticle
@@ -20,49 +20,71 @@ type NewsAPIResponse struct {
 
 // NewsAPI defines the interface for fetching news articles.
 type NewsAPI interface {
-	FetchEverythingHacking(ctx context.Context) (map[string]any, error)
+	FetchEverythingHacking(ctx context.Context) (map[string]models.NewsArticle, error)
 }
 
 type GoogleNewsAPI struct {
 	APIKey     string
-	HTTPClient securehttp.CustomHTTPClientInterface
+	HTTPClient upstream.Doer
+	BaseURL    string        // Where NewsAPI is served, services.NewsAPIURL by default
+	Timeouts   FetchTimeouts // How long NewsAPI is waited for, per topic
 }
 
-func NewGoogleNewsAPI(apiKey string, sc *securehttp.CustomHTTPClient) (*GoogleNewsAPI, error) {
+func NewGoogleNewsAPI(apiKey string, sc upstream.Doer) (*GoogleNewsAPI, error) {
 	return &GoogleNewsAPI{
 		APIKey:     apiKey,
 		HTTPClient: sc,
+		BaseURL:    services.NewsAPIURL,
+		Timeouts:   FetchTimeouts{Default: DefaultFetchTimeout},
 	}, nil
 }
 
 // FetchEverythingHacking is an API method that calls the "FetchEverythingLogic" service logic for "hacking"
-func (api *GoogleNewsAPI) FetchEverythingHacking(ctx context.Context) (map[string]any, error) {
-	// we'll cancel this operation if it exceeds this time
-	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*googleNewsTimeout)
-	defer cancel()
+func (api *GoogleNewsAPI) FetchEverythingHacking(ctx context.Context) (news map[string]models.NewsArticle, err error) {
+	ctx, span := tracer.Start(ctx, "GoogleNewsAPI.FetchEverythingHacking")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
-	hackingChan := make(chan NewsAPIResponse)
-	data := make(map[string]any)
+	articles, err := fetchWithin(ctx, api.Timeouts.For(services.TopicHacking), func(ctx context.Context) ([]models.NewsArticle, error) {
+		return services.FetchEverythingNews(ctx, services.TopicHacking, api.APIKey, api.BaseURL, api.HTTPClient)
+	})
+	if err != nil {
+		return nil, err
+	}
+	news = make(map[string]models.NewsArticle, len(articles))
+	for _, article := range articles {
+		news[article.ID] = article
+	}
+	return news, nil
+}
+
+// fetchWithin runs fetch with a context cancelled after timeout, or as soon as ctx is, e.g. when the client of the
+// request went away. It returns as soon as either happens, the fetch finishing in the background: its result is sent
+// to a buffered channel, so its goroutine exits then rather than blocking forever on a channel nobody reads anymore.
+func fetchWithin(ctx context.Context, timeout time.Duration, fetch func(context.Context) ([]models.NewsArticle, error)) ([]models.NewsArticle, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
+	responses := make(chan NewsAPIResponse, 1)
 	go func() {
-		a, err := services.FetchEverythingNews(ctx, "hacking", api.APIKey, api.HTTPClient)
-		hackingChan <- NewsAPIResponse{
-			articles: a,
-			err:      err,
-		}
+		articles, err := fetch(fetchCtx)
+		responses <- NewsAPIResponse{articles: articles, err: err}
 	}()
 
-	// blocking until go routine context expires or we get a response from the api
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("FetchEverythingHacking timed out after %d milliseconds", googleNewsTimeout)
-		case apiResponse := <-hackingChan:
-			for _, article := range apiResponse.articles {
-				hashedTitle := fmt.Sprintf("%x", md5.Sum([]byte(article.Title)))
-				data[hashedTitle] = article
-			}
-			return data, apiResponse.err
+	// blocking until the context expires or we get a response from the api
+	select {
+	case <-fetchCtx.Done():
+		if ctx.Err() != nil {
+			// the caller gave up, which isn't a timeout of the provider
+			return nil, fmt.Errorf("fetch cancelled: %w", context.Cause(ctx))
 		}
+		return nil, fmt.Errorf("fetch timed out after %v: %w", timeout, fetchCtx.Err())
+	case response := <-responses:
+		return response.articles, response.err
 	}
 }
@@ -1 +1,119 @@
 package api
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/goleak"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// every test of the package must leave no goroutine behind, e.g. a fetch blocked on a channel nobody reads
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+const everythingResponse = `{"status": "ok", "articles": [
+	{"title": "Ransomware gang leaks hospital records", "url": "https://example.com/1", "publishedAt": "2024-05-01T12:00:00Z"},
+	{"title": "Zero-day in VPN appliances exploited", "url": "https://example.com/2", "publishedAt": "2024-05-01T13:00:00Z"}
+]}`
+
+// blockingClient answers every request with everythingResponse once release is closed, or fails once the request is
+// cancelled
+type blockingClient struct {
+	release chan struct{}
+	calls   atomic.Int32
+	last    atomic.Pointer[http.Request]
+}
+
+func (c *blockingClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	c.last.Store(req)
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-c.release:
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(everythingResponse))}, nil
+	}
+}
+
+func TestGoogleNewsAPIFetchEverythingHacking(t *testing.T) {
+	client := &blockingClient{release: make(chan struct{})}
+	close(client.release)
+	newsAPI, _ := NewGoogleNewsAPI("key", client)
+
+	news, err := newsAPI.FetchEverythingHacking(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(news) != 2 {
+		t.Errorf("expected 2 articles, got %d", len(news))
+	}
+
+	// the key is sent in a header, never in the URL which ends up in logs
+	req := client.last.Load()
+	if key := req.Header.Get("X-Api-Key"); key != "key" {
+		t.Errorf("expected the key in X-Api-Key, got %q", key)
+	}
+	if strings.Contains(req.URL.RawQuery, "key") {
+		t.Errorf("expected no key in the URL, got %s", req.URL)
+	}
+}
+
+func TestGoogleNewsAPITimeout(t *testing.T) {
+	client := &blockingClient{release: make(chan struct{})}
+	newsAPI, _ := NewGoogleNewsAPI("key", client)
+	newsAPI.Timeouts = FetchTimeouts{Default: time.Hour, Topics: map[string]time.Duration{"hacking": 10 * time.Millisecond}}
+
+	_, err := newsAPI.FetchEverythingHacking(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the hacking timeout to expire, got %v", err)
+	}
+
+	// the request to NewsAPI was cancelled too, which goleak checks once the test is done
+	if req := client.last.Load(); req != nil && req.Context().Err() == nil {
+		t.Error("expected the request to NewsAPI to be cancelled")
+	}
+}
+
+func TestGoogleNewsAPICancelled(t *testing.T) {
+	tests := []struct {
+		name          string
+		cancelBefore  bool // Whether the caller gave up before the fetch started
+		expectedCalls int32
+	}{
+		{name: "Cancelled while fetching", expectedCalls: 1},
+		{name: "Cancelled before fetching", cancelBefore: true, expectedCalls: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &blockingClient{release: make(chan struct{})}
+			newsAPI, _ := NewGoogleNewsAPI("key", client)
+			newsAPI.Timeouts = FetchTimeouts{Default: time.Hour}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelBefore {
+				cancel()
+			} else {
+				go func() {
+					for client.calls.Load() == 0 {
+						time.Sleep(time.Millisecond)
+					}
+					cancel()
+				}()
+			}
+
+			_, err := newsAPI.FetchEverythingHacking(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected the fetch to be cancelled, got %v", err)
+			}
+			if calls := client.calls.Load(); calls != tt.expectedCalls {
+				t.Errorf("expected %d NewsAPI calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
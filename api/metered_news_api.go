@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"devbriefs-news/metrics"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"time"
+)
+
+// MeteredNewsAPI observes the latency and outcome of the fetches of a NewsAPI in metrics.UpstreamFetchDuration
+type MeteredNewsAPI struct {
+	newsAPI  NewsAPI
+	provider string
+}
+
+func NewMeteredNewsAPI(newsAPI NewsAPI, provider string) *MeteredNewsAPI {
+	return &MeteredNewsAPI{
+		newsAPI:  newsAPI,
+		provider: provider,
+	}
+}
+
+func (m *MeteredNewsAPI) FetchEverythingHacking(ctx context.Context) (map[string]models.NewsArticle, error) {
+	start := time.Now()
+	news, err := m.newsAPI.FetchEverythingHacking(ctx)
+	outcome := "success"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the caller gave up, e.g. the client of the request went away
+		outcome = "cancelled"
+	case err != nil:
+		outcome = "error"
+	}
+	metrics.UpstreamFetchDuration.WithLabelValues(m.provider, services.TopicHacking, outcome).Observe(time.Since(start).Seconds())
+	return news, err
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"devbriefs-news/metrics"
+	"devbriefs-news/models"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingNewsAPI fails every fetch
+type failingNewsAPI struct{}
+
+func (failingNewsAPI) FetchEverythingHacking(context.Context) (map[string]models.NewsArticle, error) {
+	return nil, errors.New("upstream unavailable")
+}
+
+func TestMeteredNewsAPI(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewMeteredNewsAPI(&countingNewsAPI{}, "metered-test").FetchEverythingHacking(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMeteredNewsAPI(failingNewsAPI{}, "metered-test").FetchEverythingHacking(ctx); err == nil {
+		t.Fatal("expected the error of the wrapped NewsAPI")
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, outcome := range []string{"success", "error"} {
+		line := `devbriefs_upstream_fetch_duration_seconds_count{outcome="` + outcome + `",provider="metered-test",topic="hacking"} 1`
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("expected %s", line)
+		}
+	}
+}
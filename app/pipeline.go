@@ -0,0 +1,72 @@
+// Package app wires the service: the fetch pipeline and the HTTP routes in front of it, as main serves them and
+// cmd/loadtest measures them.
+package app
+
+import (
+	"context"
+	"devbriefs-news/api"
+	"devbriefs-news/broker"
+	"devbriefs-news/datastore"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/upstream"
+)
+
+// PipelineConfig is how the fetch pipeline calls NewsAPI
+type PipelineConfig struct {
+	NewsAPIKey string
+	NewsAPIURL string                     // e.g. services.NewsAPIURL, or a fake NewsAPI
+	Budget     services.Budget            // The NewsAPI calls allowed per day
+	Timeouts   api.FetchTimeouts          // How long NewsAPI is waited for
+	Retry      resilience.RetryPolicy     // How often a failed call is retried
+	Breaker    resilience.BreakerSettings // After how many failed calls in a row NewsAPI isn't called for a while
+}
+
+// Pipeline fetches the news from NewsAPI within its daily budget, and ingests the articles in the cache
+type Pipeline struct {
+	Accountant *services.QuotaAccountant
+	Breaker    *resilience.Breaker
+	NewsAPI    *api.BudgetedNewsAPI
+	Ingestor   *services.Ingestor
+	// Broker gets every article the pipeline didn't know about yet, for the clients streaming them
+	Broker *broker.Broker
+}
+
+// NewPipeline wires the fetch pipeline over a cache, calling NewsAPI with client
+func NewPipeline(cache datastore.Cache, client upstream.Doer, config PipelineConfig) (*Pipeline, error) {
+	// every NewsAPI call counts against its daily budget, ad-hoc fetches are served from cache once only the reserve
+	// for the scheduled refresh is left
+	accountant := services.NewQuotaAccountant(cache, map[string]services.Budget{
+		api.ProviderNewsAPI: config.Budget,
+	})
+
+	// transient NewsAPI failures are retried, each retry counting against the budget with the priority of the fetch,
+	// and NewsAPI isn't called anymore while it keeps failing
+	breaker := resilience.NewBreaker(api.ProviderNewsAPI, config.Breaker)
+	newsClient := resilience.NewClient(client, breaker, config.Retry)
+	newsClient.BeforeRetry = func(ctx context.Context) error {
+		return accountant.Acquire(ctx, api.ProviderNewsAPI)
+	}
+
+	googleNewsAPI, err := api.NewGoogleNewsAPI(config.NewsAPIKey, newsClient)
+	if err != nil {
+		return nil, err
+	}
+	googleNewsAPI.BaseURL = config.NewsAPIURL
+	googleNewsAPI.Timeouts = config.Timeouts
+	newsAPI := api.NewBudgetedNewsAPI(api.NewMeteredNewsAPI(googleNewsAPI, api.ProviderNewsAPI), accountant, api.ProviderNewsAPI, cache)
+	// fetches refused by the open circuit aren't charged to the budget
+	newsAPI.Breaker = breaker
+
+	ingestor := services.NewIngestor(cache)
+	articleBroker := broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize)
+	ingestor.OnIngest(articleBroker.Publish)
+
+	return &Pipeline{
+		Accountant: accountant,
+		Breaker:    breaker,
+		NewsAPI:    newsAPI,
+		Ingestor:   ingestor,
+		Broker:     articleBroker,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/graphqlapi"
+	"devbriefs-news/handlers"
+	"devbriefs-news/ratelimit"
+	"devbriefs-news/trustedproxy"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// RouterConfig is what the HTTP routes are served with
+type RouterConfig struct {
+	Cache    datastore.Cache
+	Pipeline *Pipeline
+	// Confirmer emails the confirmation of subscriptions, subscribing answers 503 without it
+	Confirmer handlers.SubscriptionConfirmer
+	// RateLimiter limits requests per client IP with IPLimit on public routes and when their API key is missing or
+	// invalid, and per API key with APIKeyLimit once authenticated
+	RateLimiter ratelimit.Limiter
+	IPLimit     ratelimit.Limit
+	APIKeyLimit ratelimit.Limit
+	// ProxyManager, when set, tells the client IP of the requests coming through Cloudflare, and CloudflareOnly
+	// rejects the others
+	ProxyManager   *trustedproxy.Manager
+	CloudflareOnly bool
+}
+
+// NewRouter returns the router serving the HTTP API
+func NewRouter(config RouterConfig) (*gin.Engine, error) {
+	cache, pipeline := config.Cache, config.Pipeline
+	r := gin.New()
+	r.Use(gin.Recovery(), handlers.Metrics(), handlers.Tracing(), handlers.RequestID(), handlers.AccessLog())
+
+	// only Cloudflare, in front of us, is trusted to tell the client IP
+	if config.ProxyManager != nil {
+		if err := handlers.UseTrustedProxies(r, config.ProxyManager, config.CloudflareOnly); err != nil {
+			return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+		}
+	}
+
+	// requests are rate limited per API key once authenticated, and per client IP on public routes and when their API
+	// key is missing or invalid
+	authFailureLimit := &handlers.AuthFailureLimit{Limiter: config.RateLimiter, Limit: config.IPLimit}
+	public := r.Group("/api", handlers.RateLimit(config.RateLimiter, config.IPLimit))
+
+	// every route but the public feeds, subscriptions and API description needs an API key with the read scope, see
+	// cmd/apikeys to issue them
+	authenticated := r.Group("/api", handlers.RequireAPIKey(cache, auth.ScopeRead, authFailureLimit), handlers.RateLimit(config.RateLimiter, config.APIKeyLimit))
+
+	authenticated.GET("/everything-hacking-news", func(c *gin.Context) {
+		handlers.GetEveryHackingNews(c.Writer, c.Request, pipeline.NewsAPI, pipeline.Ingestor)
+	})
+
+	// watchlists of the vendors, products and domains an API client cares about
+	authenticated.POST("/watchlists", func(c *gin.Context) {
+		handlers.CreateWatchlist(c.Writer, c.Request, cache)
+	})
+	authenticated.GET("/watchlists", func(c *gin.Context) {
+		handlers.ListWatchlists(c.Writer, c.Request, cache)
+	})
+	authenticated.GET("/watchlists/:id", func(c *gin.Context) {
+		handlers.GetWatchlist(c.Writer, c.Request, c.Param("id"), cache)
+	})
+	authenticated.DELETE("/watchlists/:id", func(c *gin.Context) {
+		handlers.DeleteWatchlist(c.Writer, c.Request, c.Param("id"), cache)
+	})
+	authenticated.GET("/watchlists/:id/news", func(c *gin.Context) {
+		handlers.GetWatchlistNews(c.Writer, c.Request, c.Param("id"), cache)
+	})
+	authenticated.GET("/watchlists/:id/feed/:format", func(c *gin.Context) {
+		handlers.GetWatchlistFeed(c.Writer, c.Request, c.Param("id"), c.Param("format"), cache)
+	})
+
+	// RSS 2.0, Atom 1.0 and JSON Feed 1.1 feeds of each topic, e.g. /api/feeds/hacking/atom
+	public.GET("/feeds/:topic/:format", func(c *gin.Context) {
+		handlers.GetTopicFeed(c.Writer, c.Request, c.Param("topic"), c.Param("format"), cache)
+	})
+
+	// Server-Sent Events of the articles the fetch pipeline ingests, e.g. /api/stream?topic=hacking&tag=ransomware
+	authenticated.GET("/stream", func(c *gin.Context) {
+		handlers.StreamArticles(c.Writer, c.Request, pipeline.Broker, 15*time.Second)
+	})
+
+	// the same articles over WebSocket, see handlers.LiveFeed for the protocol
+	liveFeed := handlers.NewLiveFeed(pipeline.Broker)
+	authenticated.GET("/live", func(c *gin.Context) {
+		liveFeed.ServeWS(c.Writer, c.Request, c.ClientIP())
+	})
+
+	// GraphQL queries over articles, sources, clusters, tags and briefs
+	graphqlExecutor, err := graphqlapi.NewExecutor(cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build graphql schema: %w", err)
+	}
+	authenticated.Match([]string{http.MethodGet, http.MethodPost}, "/graphql", func(c *gin.Context) {
+		handlers.GraphQL(c.Writer, c.Request, graphqlExecutor)
+	})
+
+	// webhooks notified when the fetch pipeline ingests articles matching their filter
+	authenticated.POST("/webhooks", func(c *gin.Context) {
+		handlers.CreateWebhook(c.Writer, c.Request, cache)
+	})
+	authenticated.GET("/webhooks", func(c *gin.Context) {
+		handlers.ListWebhooks(c.Writer, c.Request, cache)
+	})
+	authenticated.DELETE("/webhooks/:id", func(c *gin.Context) {
+		handlers.DeleteWebhook(c.Writer, c.Request, c.Param("id"), cache)
+	})
+	authenticated.GET("/webhooks/:id/deliveries", func(c *gin.Context) {
+		handlers.GetWebhookDeliveries(c.Writer, c.Request, c.Param("id"), cache)
+	})
+
+	// email subscribers of the daily brief, confirming and unsubscribing with the links emailed to them: GET answers a
+	// page posting back to the link, so mail scanners prefetching it don't act on it
+	public.POST("/subscribers", func(c *gin.Context) {
+		handlers.Subscribe(c.Writer, c.Request, cache, config.Confirmer)
+	})
+	public.GET("/subscribers/confirm", func(c *gin.Context) {
+		handlers.ConfirmSubscription(c.Writer, c.Request, cache)
+	})
+	public.POST("/subscribers/confirm", func(c *gin.Context) {
+		handlers.ConfirmSubscription(c.Writer, c.Request, cache)
+	})
+	public.GET("/unsubscribe", func(c *gin.Context) {
+		handlers.Unsubscribe(c.Writer, c.Request, cache)
+	})
+	public.POST("/unsubscribe", func(c *gin.Context) {
+		handlers.Unsubscribe(c.Writer, c.Request, cache)
+	})
+
+	// the versioned API, wrapping every response in an envelope, and its OpenAPI document
+	v1 := r.Group("/api/v1", handlers.V1(), handlers.RequireAPIKey(cache, auth.ScopeRead, authFailureLimit), handlers.RateLimit(config.RateLimiter, config.APIKeyLimit))
+	handlers.RegisterV1(v1, handlers.Dependencies{
+		Cache:     cache,
+		NewsAPI:   pipeline.NewsAPI,
+		Ingestor:  pipeline.Ingestor,
+		Confirmer: config.Confirmer,
+	})
+	public.GET("/openapi.json", func(c *gin.Context) {
+		handlers.OpenAPI(c.Writer, c.Request)
+	})
+
+	// administration: API keys, which are issued with cmd/apikeys, and the budgets of the upstream providers
+	admin := r.Group("/api/admin", handlers.RequireAPIKey(cache, auth.ScopeAdmin, authFailureLimit), handlers.RateLimit(config.RateLimiter, config.APIKeyLimit))
+	admin.GET("/apikeys", func(c *gin.Context) {
+		handlers.ListAPIKeys(c.Writer, c.Request, cache)
+	})
+	admin.DELETE("/apikeys/:id", func(c *gin.Context) {
+		handlers.RevokeAPIKey(c.Writer, c.Request, c.Param("id"), cache)
+	})
+	admin.GET("/upstream-budgets", func(c *gin.Context) {
+		handlers.GetUpstreamBudgets(c.Writer, c.Request, pipeline.Accountant)
+	})
+
+	return r, nil
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/ratelimit"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRouter(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	readKey, _, err := auth.Issue(ctx, cache, "team-a", "read", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := NewPipeline(cache, http.DefaultClient, PipelineConfig{
+		Budget:  services.Budget{Limit: 100},
+		Retry:   resilience.DefaultRetryPolicy,
+		Breaker: resilience.DefaultBreakerSettings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	limit := ratelimit.Limit{Rate: 100, Burst: 100}
+	router, err := NewRouter(RouterConfig{
+		Cache:       cache,
+		Pipeline:    pipeline,
+		RateLimiter: ratelimit.NewMemoryLimiter(),
+		IPLimit:     limit,
+		APIKeyLimit: limit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		apiKey         string
+		expectedStatus int
+	}{
+		{name: "Public feed", path: "/api/feeds/hacking/json", expectedStatus: http.StatusOK},
+		{name: "Public API description", path: "/api/openapi.json", expectedStatus: http.StatusOK},
+		{name: "Watchlists need a key", path: "/api/watchlists", expectedStatus: http.StatusUnauthorized},
+		{name: "Watchlists with a key", path: "/api/watchlists", apiKey: readKey, expectedStatus: http.StatusOK},
+		{name: "Versioned API needs a key", path: "/api/v1/briefs/hacking", expectedStatus: http.StatusUnauthorized},
+		{name: "Administration needs the admin scope", path: "/api/admin/apikeys", apiKey: readKey, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
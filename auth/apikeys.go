@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes of an API key. The read scope gives access to the API, the admin scope to the admin endpoints and implies read.
+const (
+	ScopeRead  = "read"
+	ScopeAdmin = "admin"
+)
+
+// keyPrefix starts every API key, so keys are easy to recognize, e.g. by secret scanners
+const keyPrefix = "dbn_"
+
+var (
+	// ErrInvalidKey is returned when authenticating with a key that wasn't issued
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrRevokedKey is returned when authenticating with a revoked key
+	ErrRevokedKey = errors.New("revoked API key")
+	// ErrQuotaExceeded is returned once a key made more requests than its daily quota
+	ErrQuotaExceeded = errors.New("API key quota exceeded")
+)
+
+// Hash returns the hex SHA-256 hash of an API key, the form keys are stored and looked up in. Keys are random so they
+// don't need a salted, slow hash like passwords do.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes parses a comma separated list of scopes
+func ParseScopes(list string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(list, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" {
+			continue
+		}
+		if scope != ScopeRead && scope != ScopeAdmin {
+			return nil, fmt.Errorf("invalid scope %q, expected %q or %q", scope, ScopeRead, ScopeAdmin)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// HasScope tells whether an API key can be used for a scope
+func HasScope(key models.APIKey, scope string) bool {
+	return slices.Contains(key.Scopes, scope) || slices.Contains(key.Scopes, ScopeAdmin)
+}
+
+// Issue creates and stores an API key for a client, returning the key itself, which can't be retrieved afterward
+func Issue(ctx context.Context, cache datastore.Cache, clientID, name string, scopes []string, quota int64) (string, models.APIKey, error) {
+	if clientID == "" {
+		return "", models.APIKey{}, errors.New("a client is required")
+	}
+	if quota < 0 {
+		return "", models.APIKey{}, fmt.Errorf("invalid quota %d", quota)
+	}
+	scopes, err := ParseScopes(strings.Join(scopes, ","))
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return "", models.APIKey{}, err
+	}
+	secret := keyPrefix + hex.EncodeToString(random)
+	key := models.APIKey{
+		ID:        uuid.NewString(),
+		ClientID:  clientID,
+		Name:      name,
+		Hash:      Hash(secret),
+		Prefix:    secret[:len(keyPrefix)+6],
+		Scopes:    scopes,
+		Quota:     quota,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = datastore.SetAPIKey(ctx, cache, key); err != nil {
+		return "", models.APIKey{}, err
+	}
+	return secret, key, nil
+}
+
+// Authenticate returns the API key matching a key, ErrInvalidKey when there is none and ErrRevokedKey when it was
+// revoked
+func Authenticate(ctx context.Context, cache datastore.Cache, secret string) (models.APIKey, error) {
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return models.APIKey{}, ErrInvalidKey
+	}
+	key, err := datastore.GetAPIKey(ctx, cache, Hash(secret))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return models.APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if key.RevokedAt != nil {
+		return models.APIKey{}, ErrRevokedKey
+	}
+	return key, nil
+}
+
+// Revoke revokes an API key by ID, it is kept to show who used it. Revoking a revoked key keeps its revocation date.
+func Revoke(ctx context.Context, cache datastore.Cache, id string) (models.APIKey, error) {
+	keys, err := datastore.GetAPIKeys(ctx, cache)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	index := slices.IndexFunc(keys, func(key models.APIKey) bool { return key.ID == id })
+	if index < 0 {
+		return models.APIKey{}, datastore.ErrNotFound
+	}
+	key := keys[index]
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err = datastore.SetAPIKey(ctx, cache, key); err != nil {
+			return models.APIKey{}, err
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+
+	secret, key, err := Issue(ctx, cache, "team-a", "ci", []string{"read"}, 100)
+	if err != nil {
+		t.Fatalf("failed to issue key: %v", err)
+	}
+	if !strings.HasPrefix(secret, keyPrefix) || !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("expected key %s to start with %s and its prefix %s", secret, keyPrefix, key.Prefix)
+	}
+
+	// only the hash is stored
+	stored, err := cache.Get(ctx, datastore.APIKeyKey(key.Hash))
+	if err != nil {
+		t.Fatalf("expected key stored under its hash: %v", err)
+	}
+	if strings.Contains(stored, secret) {
+		t.Errorf("expected the key itself not to be stored, got %s", stored)
+	}
+
+	tests := []struct {
+		name          string
+		secret        string
+		expectedError error
+	}{
+		{name: "Issued key", secret: secret},
+		{name: "Unknown key", secret: keyPrefix + "0000", expectedError: ErrInvalidKey},
+		{name: "Not a key", secret: "hunter2", expectedError: ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticated, err := Authenticate(ctx, cache, tt.secret)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if err == nil && (authenticated.ID != key.ID || authenticated.ClientID != "team-a") {
+				t.Errorf("expected key %s of team-a, got %+v", key.ID, authenticated)
+			}
+		})
+	}
+
+	revoked, err := Revoke(ctx, cache, key.ID)
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("expected key revoked, got %+v, %v", revoked, err)
+	}
+	if _, err = Authenticate(ctx, cache, secret); !errors.Is(err, ErrRevokedKey) {
+		t.Errorf("expected %v, got %v", ErrRevokedKey, err)
+	}
+	if _, err = Revoke(ctx, cache, "missing"); !errors.Is(err, datastore.ErrNotFound) {
+		t.Errorf("expected %v, got %v", datastore.ErrNotFound, err)
+	}
+}
+
+func TestIssueValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		scopes   []string
+		quota    int64
+	}{
+		{name: "Missing client", scopes: []string{"read"}},
+		{name: "Unknown scope", clientID: "team-a", scopes: []string{"write"}},
+		{name: "No scope", clientID: "team-a"},
+		{name: "Negative quota", clientID: "team-a", scopes: []string{"read"}, quota: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Issue(context.Background(), datastore.NewMemoryCache(), tt.clientID, "", tt.scopes, tt.quota); err == nil {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []string
+		scope    string
+		expected bool
+	}{
+		{name: "Read key reads", scopes: []string{ScopeRead}, scope: ScopeRead, expected: true},
+		{name: "Read key can't administrate", scopes: []string{ScopeRead}, scope: ScopeAdmin, expected: false},
+		{name: "Admin key reads", scopes: []string{ScopeAdmin}, scope: ScopeRead, expected: true},
+		{name: "Admin key administrates", scopes: []string{ScopeAdmin}, scope: ScopeAdmin, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasScope(models.APIKey{Scopes: tt.scopes}, tt.scope); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUseQuota(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	now := time.Date(2024, 5, 1, 22, 30, 0, 0, time.UTC)
+	key := models.APIKey{ID: "k1", Quota: 2}
+
+	for i, expectedRemaining := range []int64{1, 0} {
+		usage, err := UseQuota(ctx, cache, key, now)
+		if err != nil {
+			t.Fatalf("request %d: expected no error, got %v", i+1, err)
+		}
+		if usage.Remaining != expectedRemaining {
+			t.Errorf("request %d: expected %d remaining, got %d", i+1, expectedRemaining, usage.Remaining)
+		}
+	}
+
+	usage, err := UseQuota(ctx, cache, key, now)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected %v, got %v", ErrQuotaExceeded, err)
+	}
+	if expected := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC); !usage.Reset.Equal(expected) {
+		t.Errorf("expected reset at %v, got %v", expected, usage.Reset)
+	}
+
+	// the next day starts over
+	if _, err = UseQuota(ctx, cache, key, now.Add(2*time.Hour)); err != nil {
+		t.Errorf("expected the quota reset the next day, got %v", err)
+	}
+
+	// unlimited keys are counted, never rejected
+	unlimited := models.APIKey{ID: "k2"}
+	for range 5 {
+		if usage, err = UseQuota(ctx, cache, unlimited, now); err != nil {
+			t.Fatalf("expected no error for an unlimited key, got %v", err)
+		}
+	}
+	if usage.Used != 5 {
+		t.Errorf("expected 5 requests counted, got %d", usage.Used)
+	}
+}
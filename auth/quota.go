@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"time"
+)
+
+// Usage is how much of its daily quota an API key used
+type Usage struct {
+	Limit     int64     // The requests allowed per UTC day, unlimited when 0
+	Used      int64     // The requests made today, the current one included
+	Remaining int64     // The requests left today, 0 when unlimited
+	Reset     time.Time // When the quota resets, at the next UTC midnight
+}
+
+// UseQuota counts a request made with an API key at now, returning ErrQuotaExceeded along with the usage once the key
+// made more requests today than its quota. Requests rejected for being over quota count too, so a client hammering
+// the API stays rejected until the reset.
+func UseQuota(ctx context.Context, cache datastore.Cache, key models.APIKey, now time.Time) (Usage, error) {
+	year, month, day := now.UTC().Date()
+	usage := Usage{
+		Limit: key.Quota,
+		Reset: time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC),
+	}
+	// requests are counted for unlimited keys too, to show their usage
+	used, err := datastore.IncrQuotaUsage(ctx, cache, key.ID, now)
+	if err != nil {
+		return usage, err
+	}
+	usage.Used = used
+	if key.Quota == 0 {
+		return usage, nil
+	}
+	usage.Remaining = max(key.Quota-used, 0)
+	if used > key.Quota {
+		return usage, ErrQuotaExceeded
+	}
+	return usage, nil
+}
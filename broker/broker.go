@@ -0,0 +1,176 @@
+package broker
+
+import (
+	"devbriefs-news/models"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultReplaySize is the number of recent events kept to resume subscribers from
+	DefaultReplaySize = 1000
+	// DefaultBufferSize is the number of events a subscriber can lag behind before being dropped
+	DefaultBufferSize = 64
+)
+
+// Event is an article published by the broker, IDs increase by one with each event
+type Event struct {
+	ID      uint64
+	Article models.NewsArticle
+}
+
+// Filter selects the events a subscriber receives, an article matches when it's in one of the topics and carries one
+// of the tags. An empty list matches every article.
+type Filter struct {
+	Topics []string
+	Tags   []string
+}
+
+// Match tells whether an article passes the filter
+func (f Filter) Match(article models.NewsArticle) bool {
+	if len(f.Topics) > 0 && !containsFold(f.Topics, article.Topic) {
+		return false
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(article.Tags, func(tag string) bool { return containsFold(f.Tags, tag) }) {
+		return false
+	}
+	return true
+}
+
+// Broker fans out the articles ingested by the fetch pipeline to in-process subscribers, e.g. our SSE and WebSocket
+// clients. Publishing never blocks: a subscriber whose buffer is full is dropped, and can resume from the replay buffer
+// with the ID of the last event it got.
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	replay      []Event // ring of the most recent events, replay[next] is the oldest once full
+	next        int
+	replaySize  int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBroker returns a broker keeping replaySize events to resume from, giving each subscriber a buffer of bufferSize
+// events
+func NewBroker(replaySize, bufferSize int) *Broker {
+	return &Broker{
+		replaySize:  replaySize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns an ID to each article and sends it to the subscribers it matches, it has the signature of a
+// services.IngestHook
+func (b *Broker) Publish(articles []models.NewsArticle) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, article := range articles {
+		b.lastID++
+		event := Event{ID: b.lastID, Article: article}
+		if b.replaySize > 0 {
+			if len(b.replay) < b.replaySize {
+				b.replay = append(b.replay, event)
+			} else {
+				b.replay[b.next] = event
+				b.next = (b.next + 1) % b.replaySize
+			}
+		}
+
+		for sub := range b.subscribers {
+			if !sub.filter.Match(article) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				// a slow subscriber mustn't hold up the others
+				b.drop(sub, true)
+			}
+		}
+	}
+}
+
+// Subscribe registers a subscriber. When lastEventID isn't 0, the matching events published after it that are still
+// in the replay buffer are returned, so the subscriber can send them before reading new ones from its channel.
+func (b *Broker) Subscribe(filter Filter, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{
+		broker: b,
+		filter: filter,
+		events: make(chan Event, b.bufferSize),
+	}
+	b.subscribers[sub] = struct{}{}
+
+	var missed []Event
+	// an ID above ours comes from before a restart, there's nothing we can replay then
+	if lastEventID == 0 || lastEventID > b.lastID {
+		return sub, missed
+	}
+	for i := range b.replay {
+		event := b.replay[(b.next+i)%len(b.replay)]
+		if event.ID > lastEventID && filter.Match(event.Article) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed
+}
+
+// Subscribers returns the number of current subscribers
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// drop unregisters a subscriber and closes its channel, b.mu must be held
+func (b *Broker) drop(sub *Subscription, slow bool) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	sub.dropped = slow
+	close(sub.events)
+}
+
+// Subscription receives the events matching its filter until it's closed or dropped
+type Subscription struct {
+	broker  *Broker
+	filter  Filter
+	events  chan Event
+	dropped bool
+}
+
+// Events returns the channel events are sent on, it's closed when the subscription is closed or dropped
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped tells whether the subscription was closed because it didn't keep up with the events
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Close unregisters the subscription, it's safe to call more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s, false)
+}
+
+// SetFilter replaces the filter of the subscription, applying to the events published afterwards
+func (s *Subscription) SetFilter(filter Filter) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.filter = filter
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(item string) bool { return strings.EqualFold(item, s) })
+}
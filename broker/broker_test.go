@@ -0,0 +1,120 @@
+package broker
+
+import (
+	"devbriefs-news/models"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	article := models.NewsArticle{Topic: "hacking", Tags: []string{"ransomware", "breach"}}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{name: "Empty filter", filter: Filter{}, expected: true},
+		{name: "Matching topic", filter: Filter{Topics: []string{"Hacking"}}, expected: true},
+		{name: "Other topic", filter: Filter{Topics: []string{"linux"}}, expected: false},
+		{name: "Matching tag", filter: Filter{Tags: []string{"phishing", "breach"}}, expected: true},
+		{name: "Other tag", filter: Filter{Tags: []string{"phishing"}}, expected: false},
+		{name: "Matching topic, other tag", filter: Filter{Topics: []string{"hacking"}, Tags: []string{"phishing"}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(article); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPublishFansOut(t *testing.T) {
+	b := NewBroker(10, 10)
+	hacking, _ := b.Subscribe(Filter{Topics: []string{"hacking"}}, 0)
+	everything, _ := b.Subscribe(Filter{}, 0)
+	defer hacking.Close()
+	defer everything.Close()
+
+	b.Publish([]models.NewsArticle{{ID: "a1", Topic: "hacking"}, {ID: "a2", Topic: "linux"}})
+
+	if event := <-hacking.Events(); event.ID != 1 || event.Article.ID != "a1" {
+		t.Errorf("expected event 1 of a1, got %+v", event)
+	}
+	if len(hacking.Events()) != 0 {
+		t.Errorf("expected the linux article to be filtered out, got %d more events", len(hacking.Events()))
+	}
+	if len(everything.Events()) != 2 {
+		t.Errorf("expected 2 events without filter, got %d", len(everything.Events()))
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := NewBroker(3, 10)
+	for _, id := range []string{"a1", "a2", "a3", "a4", "a5"} {
+		b.Publish([]models.NewsArticle{{ID: id}})
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		expectedIDs []uint64
+	}{
+		{name: "New subscriber", lastEventID: 0, expectedIDs: nil},
+		{name: "Within the buffer", lastEventID: 3, expectedIDs: []uint64{4, 5}},
+		{name: "Up to date", lastEventID: 5, expectedIDs: nil},
+		{name: "Older than the buffer", lastEventID: 1, expectedIDs: []uint64{3, 4, 5}},
+		{name: "From before a restart", lastEventID: 42, expectedIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed := b.Subscribe(Filter{}, tt.lastEventID)
+			defer sub.Close()
+
+			var ids []uint64
+			for _, event := range missed {
+				ids = append(ids, event.ID)
+			}
+			if len(ids) != len(tt.expectedIDs) {
+				t.Fatalf("expected events %v, got %v", tt.expectedIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expectedIDs[i] {
+					t.Errorf("expected events %v, got %v", tt.expectedIDs, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := NewBroker(10, 1)
+	slow, _ := b.Subscribe(Filter{}, 0)
+	fast, _ := b.Subscribe(Filter{}, 0)
+	defer fast.Close()
+
+	b.Publish([]models.NewsArticle{{ID: "a1"}})
+	<-fast.Events()
+	b.Publish([]models.NewsArticle{{ID: "a2"}})
+
+	if !slow.Dropped() {
+		t.Error("expected the slow subscriber to be dropped")
+	}
+	<-slow.Events()
+	if _, ok := <-slow.Events(); ok {
+		t.Error("expected the channel of a dropped subscriber to be closed")
+	}
+	if event := <-fast.Events(); event.Article.ID != "a2" {
+		t.Errorf("expected the fast subscriber to get a2, got %+v", event)
+	}
+	if b.Subscribers() != 1 {
+		t.Errorf("expected 1 subscriber left, got %d", b.Subscribers())
+	}
+
+	slow.Close()
+	if slow.Dropped() != true {
+		t.Error("expected closing a dropped subscription to be a no-op")
+	}
+}
@@ -0,0 +1,147 @@
+// Command apikeys issues, lists and revokes the API keys of our service, directly in its Redis.
+//
+//	apikeys issue -client my-team -name ci -scopes read -quota 10000
+//	apikeys list
+//	apikeys revoke <id>
+//
+// The Redis address is taken from -redis, defaulting to the REDIS_ADDR environment variable like the service does.
+package main
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultRedisAddr = "192.168.0.229:6379"
+
+const usage = `usage: apikeys <command> [flags]
+
+commands:
+  issue   issue a key for a client, printed once
+  list    list every key with its usage today
+  revoke  revoke a key by ID
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "issue":
+		err = issue(args)
+	case "list":
+		err = list(args)
+	case "revoke":
+		err = revoke(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apikeys:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns the flags of a command, with the -redis flag every command shares
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = defaultRedisAddr
+	}
+	return flags, flags.String("redis", addr, "address of the Redis of the service")
+}
+
+func openCache(addr string) (*datastore.RedisCache, func()) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	return datastore.NewRedisCache(client), func() { _ = client.Close() }
+}
+
+func issue(args []string) error {
+	flags, addr := newFlagSet("issue")
+	client := flags.String("client", "", "the API client the key belongs to (required)")
+	name := flags.String("name", "", "a name to recognize the key by")
+	scopes := flags.String("scopes", auth.ScopeRead, "comma separated scopes: read, admin")
+	quota := flags.Int64("quota", 0, "requests allowed per UTC day, 0 for unlimited")
+	_ = flags.Parse(args)
+
+	parsed, err := auth.ParseScopes(*scopes)
+	if err != nil {
+		return err
+	}
+	cache, closeCache := openCache(*addr)
+	defer closeCache()
+
+	secret, key, err := auth.Issue(context.Background(), cache, *client, *name, parsed, *quota)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("issued key %s for %s with scopes %s\n", key.ID, key.ClientID, strings.Join(key.Scopes, ","))
+	fmt.Println("store it now, it can't be shown again:")
+	fmt.Println(secret)
+	return nil
+}
+
+func list(args []string) error {
+	flags, addr := newFlagSet("list")
+	_ = flags.Parse(args)
+	cache, closeCache := openCache(*addr)
+	defer closeCache()
+
+	ctx := context.Background()
+	keys, err := datastore.GetAPIKeys(ctx, cache)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPREFIX\tCLIENT\tNAME\tSCOPES\tQUOTA\tUSED TODAY\tCREATED\tREVOKED")
+	now := time.Now()
+	for _, key := range keys {
+		used, err := datastore.GetQuotaUsage(ctx, cache, key.ID, now)
+		if err != nil {
+			return err
+		}
+		quota, revoked := "unlimited", "-"
+		if key.Quota > 0 {
+			quota = fmt.Sprint(key.Quota)
+		}
+		if key.RevokedAt != nil {
+			revoked = key.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s…\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", key.ID, key.Prefix, key.ClientID, key.Name,
+			strings.Join(key.Scopes, ","), quota, used, key.CreatedAt.Format(time.RFC3339), revoked)
+	}
+	return w.Flush()
+}
+
+func revoke(args []string) error {
+	flags, addr := newFlagSet("revoke")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: apikeys revoke [-redis addr] <id>")
+	}
+	cache, closeCache := openCache(*addr)
+	defer closeCache()
+
+	key, err := auth.Revoke(context.Background(), cache, flags.Arg(0))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return fmt.Errorf("no key %s", flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("revoked key %s of %s at %s\n", key.ID, key.ClientID, key.RevokedAt.Format(time.RFC3339))
+	return nil
+}
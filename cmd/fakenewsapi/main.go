@@ -0,0 +1,57 @@
+// Command fakenewsapi serves recorded NewsAPI responses, so the service runs end to end offline, without spending any
+// of the NewsAPI budget.
+//
+//	go run ./cmd/fakenewsapi -addr :8081
+//	NEWSAPI_URL=http://localhost:8081 GOOGLE_NEWS_API_KEY=fake go run main.go
+//
+// The responses are the fixtures recorded by the services tests (see upstream/upstreamtest). -latency and -status
+// simulate a slow or failing NewsAPI, e.g. -status 503 to open the circuit breaker of the service.
+package main
+
+import (
+	"devbriefs-news/upstream/upstreamtest"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	fixtures := flag.String("fixtures", "services/testdata/newsapi", "directory of the recorded NewsAPI responses")
+	apiKey := flag.String("api-key", "", "API key required in the X-Api-Key header, any key is accepted when empty")
+	latency := flag.Duration("latency", 0, "delay before answering")
+	status := flag.Int("status", 0, "status code answered instead of the fixtures, e.g. 503")
+	flag.Parse()
+
+	loaded, err := upstreamtest.Load(*fixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fakenewsapi:", err)
+		os.Exit(1)
+	}
+	handler := upstreamtest.NewHandler(loaded)
+	handler.APIKey = *apiKey
+
+	slog.Info("serving fake NewsAPI", "addr", *addr, "fixtures", *fixtures, "responses", len(loaded))
+	err = http.ListenAndServe(*addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request", "method", r.Method, "path", r.URL.Path)
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(*latency):
+		}
+		if *status != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(*status)
+			_, _ = fmt.Fprintf(w, `{"status":"error","code":"unexpectedError","message":"Simulated %d."}`, *status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fakenewsapi:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestKind is a request of the load, with {id} in its path replaced by the ID of a cached article
+type requestKind struct {
+	path   string
+	public bool // sent without API key
+}
+
+var requestKinds = map[string]requestKind{
+	"news":    {path: "/api/v1/news"},
+	"article": {path: "/api/v1/articles/{id}"},
+	"brief":   {path: "/api/v1/briefs/hacking"},
+	"feed":    {path: "/api/feeds/hacking/json", public: true},
+}
+
+// weightedKind is a request kind and its share of the load
+type weightedKind struct {
+	name   string
+	weight int
+}
+
+// parseMix parses the request mix, e.g. "news=6,article=2,brief=1,feed=1" for 60% of news requests
+func parseMix(value string) ([]weightedKind, error) {
+	var mix []weightedKind
+	total := 0
+	for _, part := range strings.Split(value, ",") {
+		name, weightValue, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid request mix %q, expected kind=weight", part)
+		}
+		if _, ok = requestKinds[name]; !ok {
+			return nil, fmt.Errorf("unknown request kind %q in the mix", name)
+		}
+		weight, err := strconv.Atoi(weightValue)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q of %s", weightValue, name)
+		}
+		mix = append(mix, weightedKind{name: name, weight: weight})
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("request mix %q has no weight", value)
+	}
+	return mix, nil
+}
+
+// pick returns a kind of the mix at random, by weight
+func pick(mix []weightedKind, rng *rand.Rand) string {
+	total := 0
+	for _, kind := range mix {
+		total += kind.weight
+	}
+	n := rng.IntN(total)
+	for _, kind := range mix {
+		if n < kind.weight {
+			return kind.name
+		}
+		n -= kind.weight
+	}
+	return mix[len(mix)-1].name
+}
+
+type loadConfig struct {
+	Service     serviceConfig
+	Mix         []weightedKind
+	Concurrency int
+	// Requests is the number of requests sent, or 0 to send requests for Duration
+	Requests int
+	Duration time.Duration
+}
+
+// kindStats are the outcomes of the requests of a kind
+type kindStats struct {
+	latencies []time.Duration
+	// errors counts the failed requests by status code, 0 when no response was received
+	errors map[int]int
+}
+
+func (s *kindStats) merge(other *kindStats) {
+	s.latencies = append(s.latencies, other.latencies...)
+	for status, count := range other.errors {
+		s.errors[status] += count
+	}
+}
+
+func (s *kindStats) errorCount() int {
+	count := 0
+	for _, n := range s.errors {
+		count += n
+	}
+	return count
+}
+
+func newKindStats() *kindStats {
+	return &kindStats{errors: make(map[int]int)}
+}
+
+// report is the outcome of a load test
+type report struct {
+	Kinds            map[string]*kindStats
+	Total            *kindStats
+	Elapsed          time.Duration
+	UpstreamRequests int64
+}
+
+// Throughput is the requests answered per second
+func (r report) Throughput() float64 {
+	return float64(len(r.Total.latencies)) / r.Elapsed.Seconds()
+}
+
+// Amplification is the NewsAPI requests made per API request, close to 1 when every request calls NewsAPI instead of
+// being served from the cache
+func (r report) Amplification() float64 {
+	if len(r.Total.latencies) == 0 {
+		return 0
+	}
+	return float64(r.UpstreamRequests) / float64(len(r.Total.latencies))
+}
+
+// percentile returns the latency under which a fraction p of the sorted latencies are
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// run wires the service and sends it the load, from config.Concurrency workers
+func run(ctx context.Context, config loadConfig) (report, error) {
+	s, err := newService(ctx, config.Service)
+	if err != nil {
+		return report{}, err
+	}
+	defer s.Close()
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConns: config.Concurrency, MaxIdleConnsPerHost: config.Concurrency},
+	}
+	defer client.CloseIdleConnections()
+	articleIDs, err := s.seed(ctx, client)
+	if err != nil {
+		return report{}, fmt.Errorf("failed to seed the service: %w", err)
+	}
+
+	if config.Requests == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+	var sent atomic.Int64
+	workerStats := make([]map[string]*kindStats, config.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range config.Concurrency {
+		stats := make(map[string]*kindStats)
+		workerStats[i] = stats
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(i), uint64(start.UnixNano())))
+			for ctx.Err() == nil {
+				if config.Requests > 0 && sent.Add(1) > int64(config.Requests) {
+					return
+				}
+				name := pick(config.Mix, rng)
+				kind := requestKinds[name]
+				path := strings.ReplaceAll(kind.path, "{id}", articleIDs[rng.IntN(len(articleIDs))])
+				latency, status, err := send(ctx, client, s.server.URL+path, s.apiKey, kind.public)
+				if err != nil && ctx.Err() != nil {
+					// the run ended during the request
+					return
+				}
+				if stats[name] == nil {
+					stats[name] = newKindStats()
+				}
+				stats[name].latencies = append(stats[name].latencies, latency)
+				if err != nil || status >= http.StatusBadRequest {
+					stats[name].errors[status]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := report{
+		Kinds:            make(map[string]*kindStats),
+		Total:            newKindStats(),
+		Elapsed:          time.Since(start),
+		UpstreamRequests: s.upstreamRequests.Load(),
+	}
+	for _, stats := range workerStats {
+		for name, kind := range stats {
+			if r.Kinds[name] == nil {
+				r.Kinds[name] = newKindStats()
+			}
+			r.Kinds[name].merge(kind)
+			r.Total.merge(kind)
+		}
+	}
+	for _, stats := range r.Kinds {
+		slices.Sort(stats.latencies)
+	}
+	slices.Sort(r.Total.latencies)
+	return r, nil
+}
+
+// send sends a GET request and reads its response, returning how long it took and its status code
+func send(ctx context.Context, client *http.Client, url, apiKey string, public bool) (time.Duration, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !public {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Since(start), 0, err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return time.Since(start), resp.StatusCode, err
+}
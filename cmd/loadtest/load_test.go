@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  int
+		expectErr bool
+	}{
+		{name: "Every kind", input: "news=6, article=2,brief=1,feed=1", expected: 4},
+		{name: "Zero weight", input: "news=0,feed=1", expected: 2},
+		{name: "Unknown kind", input: "news=1,search=1", expectErr: true},
+		{name: "Missing weight", input: "news", expectErr: true},
+		{name: "Negative weight", input: "news=-1,feed=2", expectErr: true},
+		{name: "No weight", input: "news=0", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mix, err := parseMix(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if len(mix) != tt.expected {
+				t.Errorf("expected %d kinds, got %+v", tt.expected, mix)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for p, expected := range map[float64]time.Duration{0.5: 50 * time.Millisecond, 0.99: 99 * time.Millisecond, 1: 100 * time.Millisecond} {
+		if got := percentile(latencies, p); got != expected {
+			t.Errorf("expected p%v of %v, got %v", p*100, expected, got)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("expected 0 without latencies, got %v", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	mix, err := parseMix("article=1,brief=1,feed=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := run(context.Background(), loadConfig{
+		Service:     serviceConfig{Fixtures: "../../services/testdata/newsapi"},
+		Mix:         mix,
+		Concurrency: 4,
+		Requests:    60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Total.latencies) != 60 || r.Total.errorCount() != 0 {
+		t.Errorf("expected 60 requests without error, got %d with %v", len(r.Total.latencies), r.Total.errors)
+	}
+	if len(r.Kinds) != 3 {
+		t.Errorf("expected the 3 kinds of the mix, got %d", len(r.Kinds))
+	}
+	// articles, briefs and feeds are served from the cache
+	if r.UpstreamRequests != 0 || r.Amplification() != 0 {
+		t.Errorf("expected no NewsAPI request, got %d", r.UpstreamRequests)
+	}
+}
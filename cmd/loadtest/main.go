@@ -0,0 +1,112 @@
+// Command loadtest drives the HTTP API with concurrent requests, and reports their latency percentiles, the throughput
+// and how many NewsAPI requests they caused.
+//
+//	go run ./cmd/loadtest -concurrency 32 -duration 30s -mix news=6,article=2,brief=1,feed=1
+//
+// The service is wired in-process as main wires it, against an in-memory cache and a fake NewsAPI serving the
+// fixtures of the services tests (see upstream/upstreamtest) after -upstream-latency, so the run is offline and
+// repeatable. The upstream amplification, NewsAPI requests per API request, catches regressions like fetching from
+// NewsAPI on every request: -max-amplification and -max-p99 fail the run above them, e.g. in CI.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	concurrency := flag.Int("concurrency", 16, "requests sent at once")
+	duration := flag.Duration("duration", 10*time.Second, "how long to send requests for")
+	requests := flag.Int("requests", 0, "requests to send, instead of sending for -duration")
+	mixValue := flag.String("mix", "news=6,article=2,brief=1,feed=1", "weight of each kind of request: "+strings.Join(slices.Sorted(maps.Keys(requestKinds)), ", "))
+	fixtures := flag.String("fixtures", "services/testdata/newsapi", "directory of the recorded NewsAPI responses")
+	upstreamLatency := flag.Duration("upstream-latency", 50*time.Millisecond, "delay before the fake NewsAPI answers")
+	budget := flag.Int64("budget", 0, "NewsAPI calls allowed per day, unlimited when 0")
+	maxAmplification := flag.Float64("max-amplification", 0, "fail above this many NewsAPI requests per API request, 0 to never fail")
+	maxP99 := flag.Duration("max-p99", 0, "fail above this 99th percentile latency, 0 to never fail")
+	flag.Parse()
+
+	mix, err := parseMix(*mixValue)
+	if err != nil {
+		exit(err)
+	}
+	if *concurrency < 1 {
+		exit(fmt.Errorf("invalid concurrency %d", *concurrency))
+	}
+	// the access logs of every request would drown the report
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	r, err := run(context.Background(), loadConfig{
+		Service: serviceConfig{
+			Fixtures:        *fixtures,
+			UpstreamLatency: *upstreamLatency,
+			Budget:          *budget,
+		},
+		Mix:         mix,
+		Concurrency: *concurrency,
+		Requests:    *requests,
+		Duration:    *duration,
+	})
+	if err != nil {
+		exit(err)
+	}
+	printReport(os.Stdout, r)
+
+	if *maxAmplification > 0 && r.Amplification() > *maxAmplification {
+		exit(fmt.Errorf("upstream amplification %.2f above %.2f", r.Amplification(), *maxAmplification))
+	}
+	if p99 := percentile(r.Total.latencies, 0.99); *maxP99 > 0 && p99 > *maxP99 {
+		exit(fmt.Errorf("p99 latency %v above %v", p99, *maxP99))
+	}
+}
+
+func printReport(w io.Writer, r report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KIND\tREQUESTS\tERRORS\tP50\tP90\tP99\tMAX")
+	row := func(name string, stats *kindStats) {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%v\t%v\t%v\n", name, len(stats.latencies), stats.errorCount(),
+			round(percentile(stats.latencies, 0.5)), round(percentile(stats.latencies, 0.9)),
+			round(percentile(stats.latencies, 0.99)), round(percentile(stats.latencies, 1)))
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Kinds)) {
+		row(name, r.Kinds[name])
+	}
+	row("total", r.Total)
+	_ = tw.Flush()
+
+	fmt.Fprintf(w, "\nthroughput: %.1f requests/s over %v\n", r.Throughput(), round(r.Elapsed))
+	fmt.Fprintf(w, "upstream:   %d NewsAPI requests, %.2f per API request\n", r.UpstreamRequests, r.Amplification())
+	if len(r.Total.errors) > 0 {
+		statuses := make([]string, 0, len(r.Total.errors))
+		for _, status := range slices.Sorted(maps.Keys(r.Total.errors)) {
+			name := fmt.Sprint(status)
+			if status == 0 {
+				name = "no response"
+			}
+			statuses = append(statuses, fmt.Sprintf("%s: %d", name, r.Total.errors[status]))
+		}
+		fmt.Fprintf(w, "errors:     %s\n", strings.Join(statuses, ", "))
+	}
+}
+
+// round rounds a latency for display
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, "loadtest:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"devbriefs-news/api"
+	"devbriefs-news/app"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/ratelimit"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/upstream"
+	"devbriefs-news/upstream/upstreamtest"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+// unlimited is a rate limit the load never reaches, as every request comes from the same IP
+var unlimited = ratelimit.Limit{Rate: math.MaxInt32, Burst: math.MaxInt32}
+
+// service is the HTTP API wired by app as main wires it, against a fake NewsAPI and an in-memory cache. It isn't rate
+// limited.
+type service struct {
+	server  *httptest.Server
+	newsAPI *httptest.Server
+	cache   *datastore.MemoryCache
+	apiKey  string
+	// upstreamRequests counts the requests NewsAPI received
+	upstreamRequests atomic.Int64
+}
+
+type serviceConfig struct {
+	Fixtures        string
+	UpstreamLatency time.Duration
+	// Budget is the NewsAPI calls allowed per day, unlimited when 0 so the budget doesn't hide the calls we make
+	Budget int64
+}
+
+func newService(ctx context.Context, config serviceConfig) (*service, error) {
+	fixtures, err := upstreamtest.Load(config.Fixtures)
+	if err != nil {
+		return nil, err
+	}
+	s := &service{cache: datastore.NewMemoryCache()}
+	newsAPIKey := "loadtest-newsapi-key"
+	fixturesHandler := upstreamtest.NewHandler(fixtures)
+	fixturesHandler.APIKey = newsAPIKey
+	s.newsAPI = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.upstreamRequests.Add(1)
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(config.UpstreamLatency):
+		}
+		fixturesHandler.ServeHTTP(w, r)
+	}))
+
+	budget := services.Budget{Limit: config.Budget}
+	if budget.Limit == 0 {
+		budget.Limit = math.MaxInt64
+	}
+	pipeline, err := app.NewPipeline(s.cache, upstream.NewClient(s.newsAPI.Client()), app.PipelineConfig{
+		NewsAPIKey: newsAPIKey,
+		NewsAPIURL: s.newsAPI.URL,
+		Budget:     budget,
+		Timeouts:   api.FetchTimeouts{Default: api.DefaultFetchTimeout},
+		Retry:      resilience.DefaultRetryPolicy,
+		Breaker:    resilience.DefaultBreakerSettings,
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if s.apiKey, _, err = auth.Issue(ctx, s.cache, "loadtest", "loadtest", []string{auth.ScopeRead}, 0); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to issue an API key: %w", err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r, err := app.NewRouter(app.RouterConfig{
+		Cache:       s.cache,
+		Pipeline:    pipeline,
+		RateLimiter: ratelimit.NewMemoryLimiter(),
+		IPLimit:     unlimited,
+		APIKeyLimit: unlimited,
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.server = httptest.NewServer(r)
+	return s, nil
+}
+
+// seed fetches the news once, so the articles and the brief the requests ask for exist, and returns the IDs of the
+// articles. The NewsAPI requests it makes aren't counted.
+func (s *service) seed(ctx context.Context, client *http.Client) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.server.URL+"/api/v1/news", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the news answered %d", resp.StatusCode)
+	}
+
+	articles, err := datastore.GetArticles(ctx, s.cache)
+	if err != nil {
+		return nil, err
+	}
+	if len(articles) == 0 {
+		return nil, fmt.Errorf("no article in the fixtures of %s", s.newsAPI.URL)
+	}
+	if err = datastore.SetBrief(ctx, s.cache, services.BuildBrief(services.TopicHacking, articles, time.Now())); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(articles))
+	for _, article := range articles {
+		ids = append(ids, article.ID)
+	}
+	s.upstreamRequests.Store(0)
+	return ids, nil
+}
+
+func (s *service) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+	s.newsAPI.Close()
+}
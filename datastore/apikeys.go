@@ -0,0 +1,60 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SetAPIKey persists an API key under its hash, API keys never expire and are kept once revoked
+func SetAPIKey(ctx context.Context, c Cache, key models.APIKey) error {
+	jsonValue, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal api key %s: %w", key.ID, err)
+	}
+	return c.Persist(ctx, APIKeyKey(key.Hash), jsonValue)
+}
+
+// GetAPIKey returns an API key by the hex SHA-256 hash of the key, or ErrNotFound
+func GetAPIKey(ctx context.Context, c Cache, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := getJSON(ctx, c, APIKeyKey(hash), &key)
+	return key, err
+}
+
+// GetAPIKeys returns every API key, revoked ones included, oldest first
+func GetAPIKeys(ctx context.Context, c Cache) ([]models.APIKey, error) {
+	keys, err := c.Keys(ctx, apiKeyPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	apiKeys := make([]models.APIKey, 0, len(keys))
+	for _, key := range keys {
+		var apiKey models.APIKey
+		if err = getJSON(ctx, c, key, &apiKey); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	sort.SliceStable(apiKeys, func(i, j int) bool {
+		return apiKeys[i].CreatedAt.Before(apiKeys[j].CreatedAt)
+	})
+	return apiKeys, nil
+}
+
+// IncrQuotaUsage counts a request made with an API key during the UTC day of now, and returns the requests made so far
+func IncrQuotaUsage(ctx context.Context, c Cache, apiKeyID string, now time.Time) (int64, error) {
+	return c.Incr(ctx, QuotaKey(apiKeyID, now))
+}
+
+// GetQuotaUsage returns the requests made with an API key during the UTC day of now
+func GetQuotaUsage(ctx context.Context, c Cache, apiKeyID string, now time.Time) (int64, error) {
+	return getCounter(ctx, c, QuotaKey(apiKeyID, now))
+}
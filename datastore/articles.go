@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SetArticle caches an article under its ID
+func SetArticle(ctx context.Context, c Cache, article models.NewsArticle) error {
+	jsonValue, err := json.Marshal(article)
+	if err != nil {
+		return fmt.Errorf("failed to marshal article %s: %w", article.ID, err)
+	}
+	return c.Set(ctx, ArticleKey(article.ID), jsonValue)
+}
+
+// GetArticle returns a cached article by ID, or ErrNotFound
+func GetArticle(ctx context.Context, c Cache, id string) (models.NewsArticle, error) {
+	var article models.NewsArticle
+	err := getJSON(ctx, c, ArticleKey(id), &article)
+	return article, err
+}
+
+// GetArticles returns every cached article. Articles expiring while we iterate are skipped.
+func GetArticles(ctx context.Context, c Cache) ([]models.NewsArticle, error) {
+	keys, err := c.Keys(ctx, articlePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	articles := make([]models.NewsArticle, 0, len(keys))
+	for _, key := range keys {
+		var article models.NewsArticle
+		if err = getJSON(ctx, c, key, &article); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, nil
+}
+
+// SetTopicChanged records the time articles were last added to a topic
+func SetTopicChanged(ctx context.Context, c Cache, topic string, at time.Time) error {
+	return c.Persist(ctx, TopicChangedKey(topic), at.UTC().Format(time.RFC3339Nano))
+}
+
+// GetTopicChanged returns the time articles were last added to a topic, or ErrNotFound when none were since we started
+// recording it
+func GetTopicChanged(ctx context.Context, c Cache, topic string) (time.Time, error) {
+	value, err := c.Get(ctx, TopicChangedKey(topic))
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %s: %w", TopicChangedKey(topic), err)
+	}
+	return at, nil
+}
+
+// SetBrief caches the latest brief of its topic
+func SetBrief(ctx context.Context, c Cache, brief models.Brief) error {
+	jsonValue, err := json.Marshal(brief)
+	if err != nil {
+		return fmt.Errorf("failed to marshal brief %s: %w", brief.Topic, err)
+	}
+	return c.Set(ctx, BriefKey(brief.Topic), jsonValue)
+}
+
+// GetBrief returns the latest brief of a topic, or ErrNotFound
+func GetBrief(ctx context.Context, c Cache, topic string) (models.Brief, error) {
+	var brief models.Brief
+	err := getJSON(ctx, c, BriefKey(topic), &brief)
+	return brief, err
+}
+
+func getJSON(ctx context.Context, c Cache, key string, v any) error {
+	val, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal([]byte(val), v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+	return nil
+}
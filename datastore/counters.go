@@ -0,0 +1,31 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// IncrUpstreamCalls counts a call made to an upstream provider during the UTC day of now, unless limit calls were
+// already made that day, and returns the calls made so far and whether this one was counted
+func IncrUpstreamCalls(ctx context.Context, c Cache, provider string, now time.Time, limit int64) (int64, bool, error) {
+	return c.IncrBelow(ctx, UpstreamCallsKey(provider, now), limit)
+}
+
+// GetUpstreamCalls returns the calls made to an upstream provider during the UTC day of now
+func GetUpstreamCalls(ctx context.Context, c Cache, provider string, now time.Time) (int64, error) {
+	return getCounter(ctx, c, UpstreamCallsKey(provider, now))
+}
+
+// getCounter returns the value of a counter written with Cache.Incr, 0 when it doesn't exist
+func getCounter(ctx context.Context, c Cache, key string) (int64, error) {
+	value, err := c.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
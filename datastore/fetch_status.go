@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The outcomes of the fetches of a topic are written to separate keys, so recording one never overwrites another
+const (
+	fetchSuccess      = "success"
+	fetchFailure      = "failure"
+	fetchFirstFailure = "first_failure"
+)
+
+// fetchOutcome is a fetch of a topic as recorded under one of its keys
+type fetchOutcome struct {
+	At       time.Time `json:"at"`
+	Provider string    `json:"provider"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// RecordFetch records the outcome of a fetch of a topic at a given time as its last success or last failure, and the
+// first failure when none was recorded yet
+func RecordFetch(ctx context.Context, c Cache, topic, provider string, at time.Time, fetchErr error) error {
+	outcome := fetchOutcome{At: at, Provider: provider}
+	if fetchErr != nil {
+		outcome.Error = fetchErr.Error()
+	}
+	jsonValue, err := json.Marshal(outcome)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fetch status %s: %w", topic, err)
+	}
+
+	if fetchErr == nil {
+		return c.Persist(ctx, FetchStatusKey(topic, fetchSuccess), jsonValue)
+	}
+	if _, err = c.PersistIfAbsent(ctx, FetchStatusKey(topic, fetchFirstFailure), jsonValue); err != nil {
+		return err
+	}
+	return c.Persist(ctx, FetchStatusKey(topic, fetchFailure), jsonValue)
+}
+
+// GetFetchStatus returns the outcome of the latest fetches of a topic, or ErrNotFound when it was never fetched
+func GetFetchStatus(ctx context.Context, c Cache, topic string) (models.FetchStatus, error) {
+	status := models.FetchStatus{Topic: topic}
+	var success, failure, firstFailure fetchOutcome
+	found := false
+	for outcome, v := range map[string]*fetchOutcome{fetchSuccess: &success, fetchFailure: &failure, fetchFirstFailure: &firstFailure} {
+		err := getJSON(ctx, c, FetchStatusKey(topic, outcome), v)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return status, err
+		}
+		found = true
+	}
+	if !found {
+		return status, ErrNotFound
+	}
+
+	if !success.At.IsZero() {
+		status.LastSuccess, status.Provider = &success.At, success.Provider
+	}
+	if !failure.At.IsZero() {
+		status.LastFailure, status.LastError = &failure.At, failure.Error
+		if status.LastSuccess == nil || failure.At.After(success.At) {
+			status.Provider = failure.Provider
+		}
+	}
+	if !firstFailure.At.IsZero() {
+		status.FirstFailure = &firstFailure.At
+	}
+	return status, nil
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Every key we write is namespaced by what it holds, so we can list one kind of value with a pattern like "article:*"
+const (
+	articlePrefix    = "article:"
+	briefPrefix      = "brief:"
+	watchlistPrefix  = "watchlist:"
+	webhookPrefix    = "webhook:"
+	deliveryPrefix   = "webhook_delivery:"
+	subscriberPrefix = "subscriber:"
+	apiKeyPrefix     = "apikey:"
+	quotaPrefix      = "quota:"
+	upstreamPrefix   = "upstream_calls:"
+	fetchPrefix      = "fetch_status:"
+	changedPrefix    = "topic_changed:"
+)
+
+// ArticleKey returns the key of a cached article, id is the md5 hash of the article title
+func ArticleKey(id string) string {
+	return articlePrefix + id
+}
+
+// BriefKey returns the key of the latest brief of a topic
+func BriefKey(topic string) string {
+	return briefPrefix + topic
+}
+
+// WatchlistKey returns the key of a persisted watchlist
+func WatchlistKey(id string) string {
+	return watchlistPrefix + id
+}
+
+// WebhookKey returns the key of a registered webhook
+func WebhookKey(id string) string {
+	return webhookPrefix + id
+}
+
+// WebhookDeliveryKey returns the key of one delivery attempt to a webhook
+func WebhookDeliveryKey(webhookID, deliveryID string, attempt int) string {
+	return fmt.Sprintf("%s%s:%s:%d", deliveryPrefix, webhookID, deliveryID, attempt)
+}
+
+// SubscriberKey returns the key of an email subscriber, addresses are case-insensitive
+func SubscriberKey(email string) string {
+	return subscriberPrefix + strings.ToLower(email)
+}
+
+// APIKeyKey returns the key of an API key, by the hex SHA-256 hash of the key so the key itself is never stored
+func APIKeyKey(hash string) string {
+	return apiKeyPrefix + hash
+}
+
+// QuotaKey returns the key counting the requests made with an API key during a UTC day
+func QuotaKey(apiKeyID string, day time.Time) string {
+	return quotaPrefix + apiKeyID + ":" + day.UTC().Format(time.DateOnly)
+}
+
+// UpstreamCallsKey returns the key counting the calls made to an upstream provider, e.g. NewsAPI, during a UTC day
+func UpstreamCallsKey(provider string, day time.Time) string {
+	return upstreamPrefix + provider + ":" + day.UTC().Format(time.DateOnly)
+}
+
+// TopicChangedKey returns the key of the time articles were last added to a topic
+func TopicChangedKey(topic string) string {
+	return changedPrefix + topic
+}
+
+// FetchStatusKey returns the key of a fetch of a topic with an outcome, e.g. its last success
+func FetchStatusKey(topic, outcome string) string {
+	return fetchPrefix + topic + ":" + outcome
+}
@@ -0,0 +1,142 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time // zero when the entry never expires
+}
+
+// MemoryCache is an in-process Cache, used in tests and when running the service without Redis
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *MemoryCache) Set(_ context.Context, key string, value any) error {
+	return c.set(key, value, c.now().Add(expirationTTL))
+}
+
+func (c *MemoryCache) Persist(_ context.Context, key string, value any) error {
+	return c.set(key, value, time.Time{})
+}
+
+// PersistIfAbsent writes a value that never expires unless the key exists, see RedisCache.PersistIfAbsent
+func (c *MemoryCache) PersistIfAbsent(_ context.Context, key string, value any) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok && !c.expired(entry) {
+		return false, nil
+	}
+	c.entries[key] = memoryEntry{value: toString(value)}
+	return true, nil
+}
+
+func (c *MemoryCache) set(key string, value any, expiresAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryEntry{value: toString(value), expiresAt: expiresAt}
+	return nil
+}
+
+func (c *MemoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry) {
+		return "", ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (c *MemoryCache) Remove(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// Keys returns every live key matching a glob style pattern, sorted
+func (c *MemoryCache) Keys(_ context.Context, pattern string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var keys []string
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			continue
+		}
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Incr increments the counter at key and returns its new value, see RedisCache.Incr
+func (c *MemoryCache) Incr(_ context.Context, key string) (int64, error) {
+	value, _, err := c.incrBelow(key, math.MaxInt64)
+	return value, err
+}
+
+// IncrBelow increments the counter at key only while it's below limit, see RedisCache.IncrBelow
+func (c *MemoryCache) IncrBelow(_ context.Context, key string, limit int64) (int64, bool, error) {
+	return c.incrBelow(key, limit)
+}
+
+func (c *MemoryCache) incrBelow(key string, limit int64) (int64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry) {
+		entry = memoryEntry{value: "0", expiresAt: c.now().Add(expirationTTL)}
+	}
+	value, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("value of %s is not an integer", key)
+	}
+	if value >= limit {
+		return value, false, nil
+	}
+	value++
+	entry.value = strconv.FormatInt(value, 10)
+	c.entries[key] = entry
+	return value, true, nil
+}
+
+func (c *MemoryCache) expired(entry memoryEntry) bool {
+	return !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt)
+}
+
+// toString mirrors how go-redis writes values, so both caches return the same strings
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -2,14 +2,34 @@ package datastore
 
 import (
 	"context"
+	"devbriefs-news/logging"
+	"devbriefs-news/metrics"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
-	"log"
+	"log/slog"
 	"time"
 )
 
 const expirationTTL = time.Hour * 24 // hours
 
+// ErrNotFound is returned by a Cache when a key doesn't exist or has expired
+var ErrNotFound = errors.New("key not found")
+
+// Cache is the key value store behind our service. Keys written with Set expire after expirationTTL, keys written
+// with Persist or PersistIfAbsent never expire.
+type Cache interface {
+	Set(ctx context.Context, key string, value any) error
+	Persist(ctx context.Context, key string, value any) error
+	PersistIfAbsent(ctx context.Context, key string, value any) (bool, error)
+	Get(ctx context.Context, key string) (string, error)
+	Remove(ctx context.Context, key string) error
+	Keys(ctx context.Context, pattern string) ([]string, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	IncrBelow(ctx context.Context, key string, limit int64) (int64, bool, error)
+}
+
+// RedisCache counts its hits, misses and failed commands in metrics.CacheLookups and metrics.CacheErrors
 type RedisCache struct {
 	client *redis.Client
 }
@@ -20,28 +40,115 @@ func NewRedisCache(c *redis.Client) *RedisCache {
 	}
 }
 
-func (c *RedisCache) Set(key string, value any) error {
-	return c.client.Set(context.TODO(), key, value, expirationTTL).Err()
+func (c *RedisCache) Set(ctx context.Context, key string, value any) error {
+	return countError("set", c.client.Set(ctx, key, value, expirationTTL).Err())
+}
+
+func (c *RedisCache) Persist(ctx context.Context, key string, value any) error {
+	return countError("set", c.client.Set(ctx, key, value, 0).Err())
+}
+
+// PersistIfAbsent writes a value that never expires unless the key exists, and reports whether it was written
+func (c *RedisCache) PersistIfAbsent(ctx context.Context, key string, value any) (bool, error) {
+	written, err := c.client.SetNX(ctx, key, value, 0).Result()
+	return written, countError("setnx", err)
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.client.Get(ctx, key).Result()
+	switch {
+	case errors.Is(err, redis.Nil):
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+		return "", ErrNotFound
+	case err != nil:
+		return "", countError("get", err)
+	}
+	metrics.CacheLookups.WithLabelValues("hit").Inc()
+	return val, nil
 }
 
-func (c *RedisCache) Get(key string) (string, error) {
+func (c *RedisCache) Remove(ctx context.Context, key string) error {
+	return countError("del", c.client.Del(ctx, key).Err())
+}
 
-	return c.client.Get(context.TODO(), key).Result()
+// Keys returns every key matching a glob style pattern (e.g. "article:*"), iterating with SCAN so Redis isn't blocked
+func (c *RedisCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := c.client.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, countError("scan", iter.Err())
+}
+
+// Incr increments the counter at key and returns its new value. A counter starts at 0 and expires expirationTTL after
+// its first increment.
+func (c *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.ExpireNX(ctx, key, expirationTTL)
+		return nil
+	})
+	if err != nil {
+		return 0, countError("incr", err)
+	}
+	return incr.Val(), nil
+}
+
+// incrBelow increments the counter at KEYS[1] only while it's below ARGV[1], setting its TTL of ARGV[2] seconds on the
+// first increment like Incr. It returns whether it incremented the counter and the counter's value.
+var incrBelow = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value and not tonumber(value) then
+	return redis.error_reply('ERR value is not an integer or out of range')
+end
+value = tonumber(value) or 0
+if value >= tonumber(ARGV[1]) then
+	return {0, value}
+end
+value = redis.call('INCR', KEYS[1])
+if redis.call('TTL', KEYS[1]) == -1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return {1, value}
+`)
+
+// IncrBelow increments the counter at key only while it's below limit, in one atomic step, and returns its value and
+// whether it was incremented. Counters expire like with Incr.
+func (c *RedisCache) IncrBelow(ctx context.Context, key string, limit int64) (int64, bool, error) {
+	reply, err := incrBelow.Run(ctx, c.client, []string{key}, limit, int64(expirationTTL/time.Second)).Int64Slice()
+	if err != nil {
+		return 0, false, countError("incr", err)
+	}
+	if len(reply) != 2 {
+		return 0, false, fmt.Errorf("unexpected incr reply %v", reply)
+	}
+	return reply[1], reply[0] == 1, nil
+}
+
+// countError counts a failed Redis command by operation, and returns its error
+func countError(operation string, err error) error {
+	if err != nil {
+		metrics.CacheErrors.WithLabelValues(operation).Inc()
+	}
+	return err
 }
 
-func (c *RedisCache) Remove(key string) error {
-	return c.client.Del(context.TODO(), key).Err()
+// Ping checks Redis is reachable
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return countError("ping", c.client.Ping(ctx).Err())
 }
 
 // Scan iterates over every key in the cache. Use only for debugging
 func (c *RedisCache) Scan() error {
-	log.Println("executing scan")
+	slog.Debug("executing scan")
 	iter := c.client.Scan(context.TODO(), 0, "*", 0).Iterator()
 	for iter.Next(context.TODO()) {
-		fmt.Println("keys", iter.Val())
+		slog.Debug("scanned key", "key", iter.Val())
 	}
 	if err := iter.Err(); err != nil {
-		log.Println("error iterating keys:", err)
+		slog.Error("failed to iterate keys", logging.Err(err))
 	}
 	return nil
 }
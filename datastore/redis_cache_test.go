@@ -0,0 +1,373 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/metrics"
+	"devbriefs-news/models"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"testing"
+	"time"
+)
+
+// newRedisCache returns a RedisCache on an in-process Redis, closed at the end of the test. Retries are disabled so
+// the failures injected surface on the first command.
+func newRedisCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisCache(client), server
+}
+
+// TestCaches runs the same scenarios on both caches, so the service behaves the same with or without Redis
+func TestCaches(t *testing.T) {
+	caches := []struct {
+		name string
+		// new returns a cache and a function moving its clock forward
+		new func(t *testing.T) (Cache, func(time.Duration))
+	}{
+		{
+			name: "Memory",
+			new: func(*testing.T) (Cache, func(time.Duration)) {
+				cache := NewMemoryCache()
+				now := time.Now()
+				cache.now = func() time.Time { return now }
+				return cache, func(d time.Duration) { now = now.Add(d) }
+			},
+		},
+		{
+			name: "Redis",
+			new: func(t *testing.T) (Cache, func(time.Duration)) {
+				cache, server := newRedisCache(t)
+				return cache, server.FastForward
+			},
+		},
+	}
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration))
+	}{
+		{name: "Set, get and remove", run: testSetGetRemove},
+		{name: "Set expires", run: testSetExpires},
+		{name: "Persist never expires", run: testPersist},
+		{name: "PersistIfAbsent keeps the first value", run: testPersistIfAbsent},
+		{name: "Incr expires after the first increment", run: testIncr},
+		{name: "IncrBelow stops at the limit", run: testIncrBelow},
+		{name: "Keys are namespaced", run: testNamespaces},
+	}
+
+	for _, c := range caches {
+		for _, scenario := range scenarios {
+			t.Run(c.name+"/"+scenario.name, func(t *testing.T) {
+				cache, advance := c.new(t)
+				scenario.run(t, context.Background(), cache, advance)
+			})
+		}
+	}
+}
+
+func testSetGetRemove(t *testing.T, ctx context.Context, cache Cache, _ func(time.Duration)) {
+	if _, err := cache.Get(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	// values are written as strings, whatever their type
+	if err := cache.Set(ctx, "k", 42); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := cache.Get(ctx, "k"); err != nil || value != "42" {
+		t.Errorf("expected 42, got %q (%v)", value, err)
+	}
+	if err := cache.Remove(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v once removed, got %v", ErrNotFound, err)
+	}
+	// removing a key that doesn't exist isn't an error
+	if err := cache.Remove(ctx, "k"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func testSetExpires(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration)) {
+	if err := cache.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	advance(expirationTTL - time.Second)
+	if value, err := cache.Get(ctx, "k"); err != nil || value != "v" {
+		t.Fatalf("expected v until it expires, got %q (%v)", value, err)
+	}
+	advance(time.Second)
+	if _, err := cache.Get(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v once expired, got %v", ErrNotFound, err)
+	}
+	if keys, err := cache.Keys(ctx, "*"); err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys once expired, got %v (%v)", keys, err)
+	}
+}
+
+func testPersist(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration)) {
+	if err := cache.Persist(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	advance(10 * expirationTTL)
+	if value, err := cache.Get(ctx, "k"); err != nil || value != "v" {
+		t.Errorf("expected v to be kept, got %q (%v)", value, err)
+	}
+}
+
+func testPersistIfAbsent(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration)) {
+	for _, value := range []string{"first", "second"} {
+		if _, err := cache.PersistIfAbsent(ctx, "k", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	advance(10 * expirationTTL)
+	if value, err := cache.Get(ctx, "k"); err != nil || value != "first" {
+		t.Errorf("expected first to be kept, got %q (%v)", value, err)
+	}
+	// an expired key is absent
+	if err := cache.Set(ctx, "expired", "old"); err != nil {
+		t.Fatal(err)
+	}
+	advance(expirationTTL)
+	if written, err := cache.PersistIfAbsent(ctx, "expired", "new"); err != nil || !written {
+		t.Errorf("expected an expired key to be written, got %v (%v)", written, err)
+	}
+}
+
+func testIncr(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration)) {
+	for expected := int64(1); expected <= 3; expected++ {
+		if value, err := cache.Incr(ctx, "counter"); err != nil || value != expected {
+			t.Fatalf("expected %d, got %d (%v)", expected, value, err)
+		}
+	}
+	// later increments don't push the expiry back
+	advance(expirationTTL - time.Second)
+	if value, err := cache.Incr(ctx, "counter"); err != nil || value != 4 {
+		t.Fatalf("expected 4, got %d (%v)", value, err)
+	}
+	advance(time.Second)
+	if _, err := cache.Get(ctx, "counter"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the counter expired a day after its first increment, got %v", err)
+	}
+	if value, err := cache.Incr(ctx, "counter"); err != nil || value != 1 {
+		t.Errorf("expected a new counter, got %d (%v)", value, err)
+	}
+
+	if err := cache.Set(ctx, "title", "not a number"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Incr(ctx, "title"); err == nil {
+		t.Error("expected an error incrementing a string")
+	}
+	if _, _, err := cache.IncrBelow(ctx, "title", 10); err == nil {
+		t.Error("expected an error incrementing a string below a limit")
+	}
+}
+
+func testIncrBelow(t *testing.T, ctx context.Context, cache Cache, advance func(time.Duration)) {
+	for expected := int64(1); expected <= 2; expected++ {
+		if value, ok, err := cache.IncrBelow(ctx, "counter", 2); err != nil || !ok || value != expected {
+			t.Fatalf("expected %d, got %d %v (%v)", expected, value, ok, err)
+		}
+	}
+	if value, ok, err := cache.IncrBelow(ctx, "counter", 2); err != nil || ok || value != 2 {
+		t.Fatalf("expected the counter to stay at its limit of 2, got %d %v (%v)", value, ok, err)
+	}
+	if value, ok, err := cache.IncrBelow(ctx, "counter", 3); err != nil || !ok || value != 3 {
+		t.Fatalf("expected 3 below a higher limit, got %d %v (%v)", value, ok, err)
+	}
+	// and it expires a day after its first increment, like Incr
+	advance(expirationTTL)
+	if value, ok, err := cache.IncrBelow(ctx, "counter", 2); err != nil || !ok || value != 1 {
+		t.Errorf("expected a new counter, got %d %v (%v)", value, ok, err)
+	}
+}
+
+func testNamespaces(t *testing.T, ctx context.Context, cache Cache, _ func(time.Duration)) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if err := SetArticle(ctx, cache, models.NewsArticle{ID: "a1", Title: "Zero-day exploited"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetBrief(ctx, cache, models.Brief{Topic: "hacking"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := IncrUpstreamCalls(ctx, cache, "newsapi", now, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := cache.Keys(ctx, "article:*")
+	if err != nil || len(keys) != 1 || keys[0] != ArticleKey("a1") {
+		t.Errorf("expected only %s, got %v (%v)", ArticleKey("a1"), keys, err)
+	}
+	articles, err := GetArticles(ctx, cache)
+	if err != nil || len(articles) != 1 || articles[0].ID != "a1" {
+		t.Errorf("expected only article a1, got %+v (%v)", articles, err)
+	}
+	if calls, err := GetUpstreamCalls(ctx, cache, "newsapi", now); err != nil || calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d (%v)", calls, err)
+	}
+	// a day later, the calls are counted under another key
+	if calls, err := GetUpstreamCalls(ctx, cache, "newsapi", now.Add(24*time.Hour)); err != nil || calls != 0 {
+		t.Errorf("expected no upstream call the next day, got %d (%v)", calls, err)
+	}
+	if keys, err = cache.Keys(ctx, "*"); err != nil || len(keys) != 3 {
+		t.Errorf("expected 3 keys, got %v (%v)", keys, err)
+	}
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newRedisCache(t)
+
+	if err := cache.Set(ctx, "set", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("set"); ttl != expirationTTL {
+		t.Errorf("expected a TTL of %v, got %v", expirationTTL, ttl)
+	}
+	if err := cache.Persist(ctx, "persisted", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("persisted"); ttl != 0 {
+		t.Errorf("expected no TTL, got %v", ttl)
+	}
+
+	// the counter and its TTL are written in one transaction, the TTL only when the counter has none
+	if _, err := cache.Incr(ctx, "counter"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("counter"); ttl != expirationTTL {
+		t.Errorf("expected a TTL of %v, got %v", expirationTTL, ttl)
+	}
+	server.FastForward(time.Hour)
+	if _, err := cache.Incr(ctx, "counter"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("counter"); ttl != expirationTTL-time.Hour {
+		t.Errorf("expected a TTL of %v, got %v", expirationTTL-time.Hour, ttl)
+	}
+	// a counter persisted by mistake gets a TTL on its next increment
+	cache.client.Persist(ctx, "counter")
+	if _, err := cache.Incr(ctx, "counter"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("counter"); ttl != expirationTTL {
+		t.Errorf("expected a TTL of %v, got %v", expirationTTL, ttl)
+	}
+}
+
+// stallingServer accepts connections and never answers, like a Redis too busy to
+func stallingServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn, 10)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		close(conns)
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRedisCacheFailures(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Command errors", func(t *testing.T) {
+		cache, server := newRedisCache(t)
+		if err := cache.Set(ctx, "k", "v"); err != nil {
+			t.Fatal(err)
+		}
+		errorsBefore := testutil.ToFloat64(metrics.CacheErrors.WithLabelValues("get"))
+
+		server.SetError("LOADING Redis is loading the dataset in memory")
+		_, err := cache.Get(ctx, "k")
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the error of Redis, not a miss, got %v", err)
+		}
+		if _, err = cache.Incr(ctx, "counter"); err == nil {
+			t.Error("expected the transaction to fail")
+		}
+		if err = cache.Ping(ctx); err == nil {
+			t.Error("expected the ping to fail")
+		}
+		if errorsAfter := testutil.ToFloat64(metrics.CacheErrors.WithLabelValues("get")); errorsAfter != errorsBefore+1 {
+			t.Errorf("expected the failed get counted, got %v errors, had %v", errorsAfter, errorsBefore)
+		}
+
+		server.SetError("")
+		if value, err := cache.Get(ctx, "k"); err != nil || value != "v" {
+			t.Errorf("expected v once Redis answers again, got %q (%v)", value, err)
+		}
+	})
+
+	t.Run("Connection dropped", func(t *testing.T) {
+		cache, server := newRedisCache(t)
+		if err := cache.Set(ctx, "k", "v"); err != nil {
+			t.Fatal(err)
+		}
+
+		server.Close()
+		if _, err := cache.Get(ctx, "k"); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("expected a connection error, got %v", err)
+		}
+		if err := cache.Ping(ctx); err == nil {
+			t.Error("expected the ping to fail while Redis is down")
+		}
+
+		// the client reconnects once Redis is back
+		if err := server.Restart(); err != nil {
+			t.Fatal(err)
+		}
+		if value, err := cache.Get(ctx, "k"); err != nil || value != "v" {
+			t.Errorf("expected v once Redis is back, got %q (%v)", value, err)
+		}
+	})
+
+	t.Run("Timeouts", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{
+			Addr:         stallingServer(t),
+			MaxRetries:   -1,
+			ReadTimeout:  50 * time.Millisecond,
+			WriteTimeout: 50 * time.Millisecond,
+			// so the deadline of the caller applies as well
+			ContextTimeoutEnabled: true,
+		})
+		t.Cleanup(func() { _ = client.Close() })
+		cache := NewRedisCache(client)
+
+		start := time.Now()
+		_, err := cache.Get(ctx, "k")
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected to give up after the read timeout, took %v", elapsed)
+		}
+
+		// the caller's deadline applies too
+		deadlineCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err = cache.Incr(deadlineCtx, "counter"); err == nil {
+			t.Error("expected the increment to time out")
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetSubscriber persists an email subscriber, subscribers never expire
+func SetSubscriber(ctx context.Context, c Cache, subscriber models.Subscriber) error {
+	jsonValue, err := json.Marshal(subscriber)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscriber %s: %w", subscriber.Email, err)
+	}
+	return c.Persist(ctx, SubscriberKey(subscriber.Email), jsonValue)
+}
+
+// GetSubscriber returns a subscriber by email address, or ErrNotFound
+func GetSubscriber(ctx context.Context, c Cache, email string) (models.Subscriber, error) {
+	var subscriber models.Subscriber
+	err := getJSON(ctx, c, SubscriberKey(email), &subscriber)
+	return subscriber, err
+}
+
+// GetSubscribers returns every subscriber, oldest first
+func GetSubscribers(ctx context.Context, c Cache) ([]models.Subscriber, error) {
+	keys, err := c.Keys(ctx, subscriberPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	subscribers := make([]models.Subscriber, 0, len(keys))
+	for _, key := range keys {
+		var subscriber models.Subscriber
+		if err = getJSON(ctx, c, key, &subscriber); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	sort.SliceStable(subscribers, func(i, j int) bool {
+		return subscribers[i].CreatedAt.Before(subscribers[j].CreatedAt)
+	})
+	return subscribers, nil
+}
+
+// RemoveSubscriber deletes a subscriber by email address
+func RemoveSubscriber(ctx context.Context, c Cache, email string) error {
+	return c.Remove(ctx, SubscriberKey(email))
+}
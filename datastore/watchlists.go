@@ -0,0 +1,56 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetWatchlist persists a watchlist, watchlists never expire
+func SetWatchlist(ctx context.Context, c Cache, watchlist models.Watchlist) error {
+	jsonValue, err := json.Marshal(watchlist)
+	if err != nil {
+		return fmt.Errorf("failed to marshal watchlist %s: %w", watchlist.ID, err)
+	}
+	return c.Persist(ctx, WatchlistKey(watchlist.ID), jsonValue)
+}
+
+// GetWatchlist returns a watchlist by ID, or ErrNotFound
+func GetWatchlist(ctx context.Context, c Cache, id string) (models.Watchlist, error) {
+	var watchlist models.Watchlist
+	err := getJSON(ctx, c, WatchlistKey(id), &watchlist)
+	return watchlist, err
+}
+
+// GetWatchlists returns the watchlists owned by an API client, oldest first
+func GetWatchlists(ctx context.Context, c Cache, clientID string) ([]models.Watchlist, error) {
+	keys, err := c.Keys(ctx, watchlistPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	watchlists := make([]models.Watchlist, 0)
+	for _, key := range keys {
+		var watchlist models.Watchlist
+		if err = getJSON(ctx, c, key, &watchlist); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if watchlist.ClientID == clientID {
+			watchlists = append(watchlists, watchlist)
+		}
+	}
+	sort.SliceStable(watchlists, func(i, j int) bool {
+		return watchlists[i].CreatedAt.Before(watchlists[j].CreatedAt)
+	})
+	return watchlists, nil
+}
+
+// RemoveWatchlist deletes a watchlist by ID
+func RemoveWatchlist(ctx context.Context, c Cache, id string) error {
+	return c.Remove(ctx, WatchlistKey(id))
+}
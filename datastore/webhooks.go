@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetWebhook persists a webhook, webhooks never expire
+func SetWebhook(ctx context.Context, c Cache, webhook models.Webhook) error {
+	jsonValue, err := json.Marshal(webhook)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook %s: %w", webhook.ID, err)
+	}
+	return c.Persist(ctx, WebhookKey(webhook.ID), jsonValue)
+}
+
+// GetWebhook returns a webhook by ID, or ErrNotFound
+func GetWebhook(ctx context.Context, c Cache, id string) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := getJSON(ctx, c, WebhookKey(id), &webhook)
+	return webhook, err
+}
+
+// GetWebhooks returns every registered webhook, oldest first
+func GetWebhooks(ctx context.Context, c Cache) ([]models.Webhook, error) {
+	keys, err := c.Keys(ctx, webhookPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]models.Webhook, 0, len(keys))
+	for _, key := range keys {
+		var webhook models.Webhook
+		if err = getJSON(ctx, c, key, &webhook); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// RemoveWebhook deletes a webhook by ID, its delivery log expires on its own
+func RemoveWebhook(ctx context.Context, c Cache, id string) error {
+	return c.Remove(ctx, WebhookKey(id))
+}
+
+// AddWebhookDelivery logs a delivery attempt, the log expires like the articles it delivered
+func AddWebhookDelivery(ctx context.Context, c Cache, delivery models.WebhookDelivery) error {
+	jsonValue, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery %s: %w", delivery.ID, err)
+	}
+	return c.Set(ctx, WebhookDeliveryKey(delivery.WebhookID, delivery.ID, delivery.Attempt), jsonValue)
+}
+
+// GetWebhookDeliveries returns the logged delivery attempts to a webhook, most recent first
+func GetWebhookDeliveries(ctx context.Context, c Cache, webhookID string) ([]models.WebhookDelivery, error) {
+	keys, err := c.Keys(ctx, deliveryPrefix+webhookID+":*")
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]models.WebhookDelivery, 0, len(keys))
+	for _, key := range keys {
+		var delivery models.WebhookDelivery
+		if err = getJSON(ctx, c, key, &delivery); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].AttemptedAt.After(deliveries[j].AttemptedAt)
+	})
+	return deliveries, nil
+}
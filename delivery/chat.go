@@ -0,0 +1,141 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/semper-proficiens/go-utils/web/securehttp"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	ChatKindSlack = "slack"
+	ChatKindTeams = "teams"
+
+	// briefDateFormat is how the brief date reads in chat, e.g. "Sep 20, 2024"
+	briefDateFormat = "Jan 2, 2006"
+)
+
+// ChatChannel is a Slack or Teams channel the daily brief is posted to through an incoming webhook
+type ChatChannel struct {
+	Name       string   `json:"name"`             // A name for logs, e.g. "#security-news"
+	Kind       string   `json:"kind"`             // Either ChatKindSlack or ChatKindTeams
+	WebhookURL string   `json:"webhookUrl"`       // The incoming webhook URL of the channel
+	Topics     []string `json:"topics,omitempty"` // The topics posted to the channel, all of them when empty
+}
+
+// ParseChatChannels parses the JSON list of channels we read from the CHAT_CHANNELS env var
+func ParseChatChannels(value string) ([]ChatChannel, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var channels []ChatChannel
+	if err := json.Unmarshal([]byte(value), &channels); err != nil {
+		return nil, fmt.Errorf("failed to parse chat channels: %w", err)
+	}
+	for _, channel := range channels {
+		if channel.Kind != ChatKindSlack && channel.Kind != ChatKindTeams {
+			return nil, fmt.Errorf("chat channel %q has unknown kind %q", channel.Name, channel.Kind)
+		}
+		if channel.WebhookURL == "" {
+			return nil, fmt.Errorf("chat channel %q has no webhook url", channel.Name)
+		}
+	}
+	return channels, nil
+}
+
+// ChatPublisher posts briefs to chat channels. In dry-run mode payloads are printed instead of posted.
+type ChatPublisher struct {
+	channels []ChatChannel
+	client   *http.Client
+	DryRun   bool
+	Out      io.Writer // Where dry-run payloads are printed
+}
+
+func NewChatPublisher(channels []ChatChannel, client *http.Client) *ChatPublisher {
+	return &ChatPublisher{
+		channels: channels,
+		client:   client,
+	}
+}
+
+// Publish posts a brief to every channel following its topic, a failing channel doesn't prevent posting to the others
+func (p *ChatPublisher) Publish(ctx context.Context, brief models.Brief) error {
+	var errs []error
+	for _, channel := range p.channels {
+		if len(channel.Topics) > 0 && !slices.Contains(channel.Topics, brief.Topic) {
+			continue
+		}
+
+		var payload any
+		switch channel.Kind {
+		case ChatKindSlack:
+			payload = RenderSlackBrief(brief)
+		case ChatKindTeams:
+			payload = RenderTeamsBrief(brief)
+		default:
+			errs = append(errs, fmt.Errorf("chat channel %q has unknown kind %q", channel.Name, channel.Kind))
+			continue
+		}
+
+		if err := p.post(ctx, channel, payload); err != nil {
+			errs = append(errs, fmt.Errorf("failed to post brief to %q: %w", channel.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *ChatPublisher) post(ctx context.Context, channel ChatChannel, payload any) error {
+	if p.DryRun {
+		body, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.Out, "dry-run %s payload for %q:\n%s\n", channel.Kind, channel.Name, body)
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer securehttp.ResponseBodyCloser(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered with status code %d: %s", resp.StatusCode, answer)
+	}
+	return nil
+}
+
+// briefTitle is the headline of a brief, e.g. "Daily hacking brief - Sep 20, 2024"
+func briefTitle(brief models.Brief) string {
+	return fmt.Sprintf("Daily %s brief - %s", brief.Topic, brief.GeneratedAt.Format(briefDateFormat))
+}
+
+// articleContext is the line under each article, e.g. "Krebs on Security · 3 outlets · ransomware, data-breach"
+func articleContext(article models.NewsArticle) string {
+	parts := []string{article.Source.Name}
+	if article.Cluster != nil && article.Cluster.Size > 1 {
+		parts = append(parts, fmt.Sprintf("%d outlets", article.Cluster.Size))
+	}
+	if len(article.Tags) > 0 {
+		parts = append(parts, strings.Join(article.Tags, ", "))
+	}
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), " · ")
+}
@@ -0,0 +1,145 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"devbriefs-news/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testBrief = models.Brief{
+	Topic:       "hacking",
+	GeneratedAt: time.Date(2024, 9, 20, 10, 0, 0, 0, time.UTC),
+	Articles: []models.NewsArticle{
+		{
+			Title:       "Ransomware <gang> hits Acme & friends",
+			URL:         "https://krebsonsecurity.com/acme",
+			Description: "Details about the attack",
+			Source:      models.NewsSource{Name: "Krebs on Security"},
+			Tags:        []string{"ransomware"},
+			Cluster:     &models.Cluster{Size: 3},
+		},
+	},
+}
+
+func TestRenderSlackBrief(t *testing.T) {
+	msg := RenderSlackBrief(testBrief)
+
+	if msg.Text != "Daily hacking brief - Sep 20, 2024" {
+		t.Errorf("unexpected fallback text %q", msg.Text)
+	}
+	types := make([]string, len(msg.Blocks))
+	for i, block := range msg.Blocks {
+		types[i] = block.Type
+	}
+	if got := strings.Join(types, ","); got != "header,section,context,divider" {
+		t.Fatalf("unexpected blocks %s", got)
+	}
+	expected := "*<https://krebsonsecurity.com/acme|Ransomware &lt;gang&gt; hits Acme &amp; friends>*\nDetails about the attack"
+	if msg.Blocks[1].Text.Text != expected {
+		t.Errorf("expected section %q, got %q", expected, msg.Blocks[1].Text.Text)
+	}
+	if got := msg.Blocks[2].Elements[0].Text; got != "Krebs on Security · 3 outlets · ransomware" {
+		t.Errorf("unexpected context %q", got)
+	}
+}
+
+func TestRenderTeamsBrief(t *testing.T) {
+	msg := RenderTeamsBrief(testBrief)
+
+	if len(msg.Attachments) != 1 || msg.Attachments[0].ContentType != adaptiveCardContentType {
+		t.Fatalf("expected one adaptive card attachment, got %+v", msg.Attachments)
+	}
+	card := msg.Attachments[0].Content
+	if card.Type != "AdaptiveCard" || card.Version != adaptiveCardVersion {
+		t.Errorf("unexpected card %s %s", card.Type, card.Version)
+	}
+	if len(card.Body) != 4 {
+		t.Fatalf("expected heading, title, description and context, got %d elements", len(card.Body))
+	}
+	if got := card.Body[1].Text; got != "[Ransomware <gang> hits Acme & friends](https://krebsonsecurity.com/acme)" {
+		t.Errorf("unexpected title %q", got)
+	}
+}
+
+func TestChatPublisherPublish(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("could not decode payload: %v", err)
+		}
+		if _, ok := payload["blocks"]; ok {
+			received = append(received, r.URL.Path+":slack")
+		} else if _, ok = payload["attachments"]; ok {
+			received = append(received, r.URL.Path+":teams")
+		}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	channels, err := ParseChatChannels(`[
+		{"name":"#security","kind":"slack","webhookUrl":"` + server.URL + `/security"},
+		{"name":"SecOps","kind":"teams","webhookUrl":"` + server.URL + `/secops","topics":["hacking"]},
+		{"name":"#cloud","kind":"slack","webhookUrl":"` + server.URL + `/cloud","topics":["cloud"]},
+		{"name":"#broken","kind":"slack","webhookUrl":"` + server.URL + `/broken"}
+	]`)
+	if err != nil {
+		t.Fatalf("could not parse channels: %v", err)
+	}
+
+	err = NewChatPublisher(channels, server.Client()).Publish(context.Background(), testBrief)
+	if err == nil || !strings.Contains(err.Error(), "#broken") {
+		t.Errorf("expected the broken channel to be reported, got %v", err)
+	}
+	if got := strings.Join(received, ","); got != "/security:slack,/secops:teams,/broken:slack" {
+		t.Errorf("unexpected deliveries %s", got)
+	}
+}
+
+func TestChatPublisherDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("dry-run must not post")
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	publisher := NewChatPublisher([]ChatChannel{{Name: "#security", Kind: ChatKindSlack, WebhookURL: server.URL}}, server.Client())
+	publisher.DryRun = true
+	publisher.Out = &out
+
+	if err := publisher.Publish(context.Background(), testBrief); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"type": "header"`) {
+		t.Errorf("expected the payload to be printed, got %s", out.String())
+	}
+}
+
+func TestParseChatChannels(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expectError bool
+	}{
+		{name: "Empty", value: ""},
+		{name: "Unknown kind", value: `[{"name":"x","kind":"irc","webhookUrl":"https://example.com"}]`, expectError: true},
+		{name: "Missing url", value: `[{"name":"x","kind":"slack"}]`, expectError: true},
+		{name: "Invalid JSON", value: `[{`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseChatChannels(tt.value); (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
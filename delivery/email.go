@@ -0,0 +1,345 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+//go:embed templates/brief.html.tmpl templates/brief.txt.tmpl templates/confirmation.txt.tmpl
+var templatesFS embed.FS
+
+var (
+	templateFuncs    = map[string]any{"details": articleContext, "join": strings.Join}
+	htmlBrief        = htmlTemplate.Must(htmlTemplate.New("brief.html.tmpl").Funcs(templateFuncs).ParseFS(templatesFS, "templates/brief.html.tmpl"))
+	textBrief        = textTemplate.Must(textTemplate.New("brief.txt.tmpl").Funcs(templateFuncs).ParseFS(templatesFS, "templates/brief.txt.tmpl"))
+	textConfirmation = textTemplate.Must(textTemplate.New("confirmation.txt.tmpl").Funcs(templateFuncs).ParseFS(templatesFS, "templates/confirmation.txt.tmpl"))
+)
+
+// SMTPConfig tells how to reach the SMTP server briefs are sent through
+type SMTPConfig struct {
+	Host      string      // e.g. "smtp.example.com"
+	Port      int         // e.g. 587
+	Username  string      // Leave empty when the server doesn't require authentication
+	Password  string      // The password of Username
+	From      string      // The sender address, e.g. "DevBriefs <news@example.com>"
+	StartTLS  bool        // Whether to upgrade the connection with STARTTLS before authenticating, refusing to send otherwise
+	TLSConfig *tls.Config // Optional, defaults to verifying the certificate of Host
+	Timeout   time.Duration
+}
+
+// ParseSMTPConfig reads the SMTP_* env vars, ok is false when SMTP_HOST isn't set so email delivery is disabled
+func ParseSMTPConfig(envVars map[string]string) (config SMTPConfig, ok bool, err error) {
+	if envVars["SMTP_HOST"] == "" {
+		return config, false, nil
+	}
+	config = SMTPConfig{
+		Host:     envVars["SMTP_HOST"],
+		Port:     587,
+		Username: envVars["SMTP_USERNAME"],
+		Password: envVars["SMTP_PASSWORD"],
+		From:     envVars["SMTP_FROM"],
+		StartTLS: envVars["SMTP_STARTTLS"] != "false",
+		Timeout:  30 * time.Second,
+	}
+	if port := envVars["SMTP_PORT"]; port != "" {
+		if config.Port, err = strconv.Atoi(port); err != nil {
+			return config, false, fmt.Errorf("invalid SMTP_PORT %q: %w", port, err)
+		}
+	}
+	if _, err = mailAddress(config.From); err != nil {
+		return config, false, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	return config, true, nil
+}
+
+// briefEmail is what the email templates are rendered with
+type briefEmail struct {
+	Title          string
+	Brief          models.Brief
+	Email          string
+	UnsubscribeURL string
+}
+
+// confirmationEmail is what the confirmation email is rendered with
+type confirmationEmail struct {
+	Email      string
+	Topics     []string
+	ConfirmURL string
+}
+
+// EmailPublisher emails briefs to the subscribers following their topic, and the confirmation of new subscriptions
+type EmailPublisher struct {
+	config         SMTPConfig
+	cache          datastore.Cache
+	unsubscribeURL string
+	confirmURL     string
+}
+
+// NewEmailPublisher returns a publisher sending through the given SMTP server. unsubscribeURL and confirmURL are the
+// public URLs of our unsubscribe and confirmation endpoints, the email address and token of each subscriber are added
+// to them.
+func NewEmailPublisher(config SMTPConfig, cache datastore.Cache, unsubscribeURL, confirmURL string) *EmailPublisher {
+	return &EmailPublisher{
+		config:         config,
+		cache:          cache,
+		unsubscribeURL: unsubscribeURL,
+		confirmURL:     confirmURL,
+	}
+}
+
+// Publish emails a brief to every confirmed subscriber following its topic, a subscriber whose email fails to render or
+// send doesn't prevent sending to the others
+func (p *EmailPublisher) Publish(ctx context.Context, brief models.Brief) error {
+	subscribers, err := datastore.GetSubscribers(ctx, p.cache)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, subscriber := range subscribers {
+		if subscriber.Pending || len(subscriber.Topics) > 0 && !slices.Contains(subscriber.Topics, brief.Topic) {
+			continue
+		}
+		msg, err := p.RenderBrief(brief, subscriber)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render brief for %s: %w", subscriber.Email, err))
+			continue
+		}
+		if err = p.send(ctx, subscriber.Email, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to email brief to %s: %w", subscriber.Email, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RenderBrief returns the MIME message of a brief for a subscriber, with plain-text and HTML alternatives. It fails when
+// the address of the subscriber isn't a valid one, which could otherwise inject headers.
+func (p *EmailPublisher) RenderBrief(brief models.Brief, subscriber models.Subscriber) ([]byte, error) {
+	to, err := mailAddress(subscriber.Email)
+	if err != nil {
+		return nil, err
+	}
+	data := briefEmail{
+		Title:          briefTitle(brief),
+		Brief:          brief,
+		Email:          subscriber.Email,
+		UnsubscribeURL: UnsubscribeLink(p.unsubscribeURL, subscriber),
+	}
+
+	var text, html bytes.Buffer
+	if err := textBrief.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render text brief: %w", err)
+	}
+	if err := htmlBrief.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render html brief: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		// the last alternative is the preferred one
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := []struct{ key, value string }{
+		{"From", p.config.From},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", data.Title)},
+		{"Date", brief.GeneratedAt.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+		{"List-Unsubscribe", "<" + data.UnsubscribeURL + ">"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h.key, h.value)
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// SendConfirmation emails a pending subscriber the link confirming its subscription, so nobody can subscribe an
+// address they don't own
+func (p *EmailPublisher) SendConfirmation(ctx context.Context, subscriber models.Subscriber) error {
+	msg, err := p.RenderConfirmation(subscriber)
+	if err != nil {
+		return err
+	}
+	return p.send(ctx, subscriber.Email, msg)
+}
+
+// RenderConfirmation returns the plain-text message asking a subscriber to confirm its subscription
+func (p *EmailPublisher) RenderConfirmation(subscriber models.Subscriber) ([]byte, error) {
+	to, err := mailAddress(subscriber.Email)
+	if err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	data := confirmationEmail{Email: to, Topics: subscriber.Topics, ConfirmURL: subscriberLink(p.confirmURL, subscriber)}
+	if err = textConfirmation.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render confirmation: %w", err)
+	}
+
+	var msg bytes.Buffer
+	headers := []struct{ key, value string }{
+		{"From", p.config.From},
+		{"To", to},
+		{"Subject", "Confirm your DevBriefs subscription"},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h.key, h.value)
+	}
+	msg.WriteString("\r\n")
+	qw := quotedprintable.NewWriter(&msg)
+	if _, err = qw.Write(text.Bytes()); err != nil {
+		return nil, err
+	}
+	if err = qw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// send delivers a message over SMTP, upgrading the connection with STARTTLS before authenticating when configured to
+func (p *EmailPublisher) send(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(p.config.Host, strconv.Itoa(p.config.Port))
+	dialer := net.Dialer{Timeout: p.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if p.config.Timeout > 0 {
+		if err = conn.SetDeadline(time.Now().Add(p.config.Timeout)); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, p.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if p.config.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server doesn't support STARTTLS")
+		}
+		tlsConfig := p.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: p.config.Host, MinVersion: tls.VersionTLS12}
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if p.config.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", p.config.Username, p.config.Password, p.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mailAddress(p.config.From)
+	if err != nil {
+		return err
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// mailAddress returns the bare address of "Name <address>"
+func mailAddress(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	return parsed.Address, nil
+}
+
+// NewUnsubscribeToken returns a random token to include in the unsubscribe links of a subscriber
+func NewUnsubscribeToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// UnsubscribeLink returns the unsubscribe URL of a subscriber
+func UnsubscribeLink(unsubscribeURL string, subscriber models.Subscriber) string {
+	return subscriberLink(unsubscribeURL, subscriber)
+}
+
+// subscriberLink adds the email address and token of a subscriber to the URL of one of our endpoints
+func subscriberLink(endpointURL string, subscriber models.Subscriber) string {
+	query := url.Values{}
+	query.Set("email", subscriber.Email)
+	query.Set("token", subscriber.UnsubscribeToken)
+	return endpointURL + "?" + query.Encode()
+}
@@ -0,0 +1,340 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage is what the SMTP stand-in received for one message
+type smtpMessage struct {
+	from, auth string
+	to         []string
+	data       string
+	tls        bool
+}
+
+// smtpStandIn is a local SMTP server speaking just enough of the protocol for net/smtp: EHLO, STARTTLS, AUTH PLAIN,
+// MAIL, RCPT, DATA and QUIT
+type smtpStandIn struct {
+	listener  net.Listener
+	tlsConfig *tls.Config // STARTTLS is only advertised when set
+	mu        sync.Mutex
+	messages  []smtpMessage
+}
+
+func newSMTPStandIn(t *testing.T, tlsConfig *tls.Config) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	s := &smtpStandIn{listener: listener, tlsConfig: tlsConfig}
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage{}, s.messages...)
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(line string) {
+		_, _ = w.WriteString(line + "\r\n")
+		_ = w.Flush()
+	}
+
+	var msg smtpMessage
+	reply("220 stand-in ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			if s.tlsConfig != nil && !msg.tls {
+				reply("250-stand-in")
+				reply("250-STARTTLS")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250-stand-in")
+				reply("250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, msg.tls = tlsConn, true
+			r, w = bufio.NewReader(conn), bufio.NewWriter(conn)
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			msg.auth = string(credentials)
+			reply("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// testTLSConfigs borrows the certificate of an httptest TLS server, valid for example.com, so the stand-in can speak
+// STARTTLS and the client can verify it
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+	server = &tls.Config{Certificates: ts.TLS.Certificates}
+	client = &tls.Config{RootCAs: ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, ServerName: "example.com"}
+	return server, client
+}
+
+func TestEmailPublisherPublish(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	standIn := newSMTPStandIn(t, serverTLS)
+
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	subscribers := []models.Subscriber{
+		{Email: "alice@example.com", UnsubscribeToken: "t0k3n", CreatedAt: time.Unix(1, 0)},
+		{Email: "bob@example.com", Topics: []string{"cloud"}, CreatedAt: time.Unix(2, 0)},
+		{Email: "carol@example.com", Topics: []string{"hacking"}, CreatedAt: time.Unix(3, 0)},
+		// until dave confirms the subscription
+		{Email: "dave@example.com", Pending: true, CreatedAt: time.Unix(4, 0)},
+	}
+	for _, subscriber := range subscribers {
+		if err := datastore.SetSubscriber(ctx, cache, subscriber); err != nil {
+			t.Fatalf("could not store subscriber: %v", err)
+		}
+	}
+
+	config := SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      standIn.port(),
+		Username:  "briefs",
+		Password:  "pa55",
+		From:      "DevBriefs <news@example.com>",
+		StartTLS:  true,
+		TLSConfig: clientTLS,
+		Timeout:   5 * time.Second,
+	}
+	publisher := NewEmailPublisher(config, cache, "https://news.example.com/api/unsubscribe", "https://news.example.com/api/subscribers/confirm")
+	if err := publisher.Publish(ctx, testBrief); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	messages := standIn.received()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 emails, got %d", len(messages))
+	}
+	first := messages[0]
+	if !first.tls || first.auth != "\x00briefs\x00pa55" || first.from != "news@example.com" {
+		t.Errorf("expected an authenticated STARTTLS session from news@example.com, got %+v", first)
+	}
+	if first.to[0] != "alice@example.com" || messages[1].to[0] != "carol@example.com" {
+		t.Errorf("unexpected recipients %v and %v", first.to, messages[1].to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(first.data))
+	if err != nil {
+		t.Fatalf("could not parse email: %v", err)
+	}
+	unsubscribe := "https://news.example.com/api/unsubscribe?email=alice%40example.com&token=t0k3n"
+	if got := msg.Header.Get("List-Unsubscribe"); got != "<"+unsubscribe+">" {
+		t.Errorf("unexpected List-Unsubscribe %q", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q: %v", mediaType, err)
+	}
+
+	parts := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("could not decode part: %v", err)
+		}
+		parts[strings.SplitN(part.Header.Get("Content-Type"), ";", 2)[0]] = string(body)
+	}
+	if !strings.Contains(parts["text/plain"], "* Ransomware <gang> hits Acme & friends") ||
+		!strings.Contains(parts["text/plain"], "Unsubscribe: "+unsubscribe) {
+		t.Errorf("unexpected text part:\n%s", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "Ransomware &lt;gang&gt; hits Acme &amp; friends") ||
+		!strings.Contains(parts["text/html"], `href="https://news.example.com/api/unsubscribe?email=alice%40example.com&amp;token=t0k3n"`) {
+		t.Errorf("unexpected html part:\n%s", parts["text/html"])
+	}
+}
+
+func TestEmailPublisherSendConfirmation(t *testing.T) {
+	standIn := newSMTPStandIn(t, nil)
+	config := SMTPConfig{Host: "127.0.0.1", Port: standIn.port(), From: "news@example.com", Timeout: 5 * time.Second}
+	publisher := NewEmailPublisher(config, datastore.NewMemoryCache(), "https://news.example.com/api/unsubscribe", "https://news.example.com/api/subscribers/confirm")
+	subscriber := models.Subscriber{Email: "alice@example.com", Topics: []string{"hacking"}, UnsubscribeToken: "t0k3n", Pending: true}
+	if err := publisher.SendConfirmation(context.Background(), subscriber); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	messages := standIn.received()
+	if len(messages) != 1 || messages[0].to[0] != "alice@example.com" {
+		t.Fatalf("expected a confirmation emailed to alice, got %+v", messages)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].data))
+	if err != nil {
+		t.Fatalf("could not parse email: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("could not decode email: %v", err)
+	}
+	confirm := "https://news.example.com/api/subscribers/confirm?email=alice%40example.com&token=t0k3n"
+	if !strings.Contains(string(body), confirm) || !strings.Contains(string(body), "about hacking") {
+		t.Errorf("expected the confirmation link and topics, got:\n%s", body)
+	}
+
+	// and an address that would inject headers isn't emailed
+	if err = publisher.SendConfirmation(context.Background(), models.Subscriber{Email: "mallory@example.com\r\nBcc: eve@example.com"}); err == nil {
+		t.Error("expected an invalid address to be refused")
+	}
+}
+
+func TestEmailPublisherPublishRenderFailure(t *testing.T) {
+	standIn := newSMTPStandIn(t, nil)
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	subscribers := []models.Subscriber{
+		{Email: "alice@example.com", CreatedAt: time.Unix(1, 0)},
+		// rendering this one would inject a Bcc header
+		{Email: "mallory@example.com\r\nBcc: eve@example.com", CreatedAt: time.Unix(2, 0)},
+		{Email: "carol@example.com", CreatedAt: time.Unix(3, 0)},
+	}
+	for _, subscriber := range subscribers {
+		if err := datastore.SetSubscriber(ctx, cache, subscriber); err != nil {
+			t.Fatalf("could not store subscriber: %v", err)
+		}
+	}
+
+	config := SMTPConfig{Host: "127.0.0.1", Port: standIn.port(), From: "news@example.com", Timeout: 5 * time.Second}
+	err := NewEmailPublisher(config, cache, "http://localhost", "http://localhost").Publish(ctx, testBrief)
+	if err == nil || !strings.Contains(err.Error(), "failed to render brief for mallory@example.com") {
+		t.Errorf("expected a render error for mallory, got %v", err)
+	}
+
+	messages := standIn.received()
+	if len(messages) != 2 {
+		t.Fatalf("expected the 2 other subscribers to be emailed, got %d emails", len(messages))
+	}
+	for _, msg := range messages {
+		if strings.Contains(msg.data, "eve@example.com") {
+			t.Errorf("expected no injected header, got:\n%s", msg.data)
+		}
+	}
+}
+
+func TestEmailPublisherRequiresStartTLS(t *testing.T) {
+	standIn := newSMTPStandIn(t, nil)
+	cache := datastore.NewMemoryCache()
+	if err := datastore.SetSubscriber(context.Background(), cache, models.Subscriber{Email: "alice@example.com"}); err != nil {
+		t.Fatalf("could not store subscriber: %v", err)
+	}
+
+	config := SMTPConfig{Host: "127.0.0.1", Port: standIn.port(), From: "news@example.com", StartTLS: true, Timeout: 5 * time.Second}
+	err := NewEmailPublisher(config, cache, "http://localhost", "http://localhost").Publish(context.Background(), testBrief)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected a STARTTLS error, got %v", err)
+	}
+	if messages := standIn.received(); len(messages) != 0 {
+		t.Errorf("expected no email to be sent in clear text, got %d", len(messages))
+	}
+}
+
+func TestParseSMTPConfig(t *testing.T) {
+	config, ok, err := ParseSMTPConfig(map[string]string{
+		"SMTP_HOST": "smtp.example.com",
+		"SMTP_PORT": "2525",
+		"SMTP_FROM": "DevBriefs <news@example.com>",
+	})
+	if err != nil || !ok {
+		t.Fatalf("expected a valid config, got %v %v", ok, err)
+	}
+	if config.Port != 2525 || !config.StartTLS {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	if _, ok, _ = ParseSMTPConfig(map[string]string{}); ok {
+		t.Error("expected email delivery to be disabled without SMTP_HOST")
+	}
+	if _, _, err = ParseSMTPConfig(map[string]string{"SMTP_HOST": "smtp.example.com", "SMTP_PORT": "x", "SMTP_FROM": "a@b.c"}); err == nil {
+		t.Error("expected an invalid port to be rejected")
+	}
+	if _, _, err = ParseSMTPConfig(map[string]string{"SMTP_HOST": "smtp.example.com"}); err == nil {
+		t.Error("expected a missing sender to be rejected")
+	}
+}
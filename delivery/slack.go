@@ -0,0 +1,65 @@
+package delivery
+
+import (
+	"devbriefs-news/models"
+	"fmt"
+	"strings"
+)
+
+// SlackMessage is an incoming webhook payload using Block Kit, see https://api.slack.com/block-kit
+type SlackMessage struct {
+	Text   string       `json:"text"` // Fallback for notifications and clients without Block Kit
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock is one Block Kit layout block, only the fields of the block types we use are set
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+// SlackText is a Block Kit text object, either "plain_text" or "mrkdwn"
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// RenderSlackBrief renders a brief as a header followed by a section and a context block per article
+func RenderSlackBrief(brief models.Brief) SlackMessage {
+	title := briefTitle(brief)
+	msg := SlackMessage{
+		Text: title,
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: title}},
+		},
+	}
+
+	if len(brief.Articles) == 0 {
+		msg.Blocks = append(msg.Blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: "_No news today._"},
+		})
+		return msg
+	}
+
+	for _, article := range brief.Articles {
+		text := fmt.Sprintf("*<%s|%s>*", article.URL, slackEscaper.Replace(article.Title))
+		if article.Description != "" {
+			text += "\n" + slackEscaper.Replace(article.Description)
+		}
+		msg.Blocks = append(msg.Blocks,
+			SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}},
+		)
+		if details := articleContext(article); details != "" {
+			msg.Blocks = append(msg.Blocks, SlackBlock{
+				Type:     "context",
+				Elements: []SlackText{{Type: "mrkdwn", Text: slackEscaper.Replace(details)}},
+			})
+		}
+		msg.Blocks = append(msg.Blocks, SlackBlock{Type: "divider"})
+	}
+	return msg
+}
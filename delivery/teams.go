@@ -0,0 +1,88 @@
+package delivery
+
+import (
+	"devbriefs-news/models"
+	"fmt"
+	"strings"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+)
+
+// TeamsMessage is an incoming webhook payload carrying an Adaptive Card, see https://adaptivecards.io
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []AdaptiveElement `json:"body"`
+}
+
+// AdaptiveElement is a TextBlock of an Adaptive Card, the only element we use
+type AdaptiveElement struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Size      string `json:"size,omitempty"`
+	Weight    string `json:"weight,omitempty"`
+	Wrap      bool   `json:"wrap,omitempty"`
+	IsSubtle  bool   `json:"isSubtle,omitempty"`
+	Separator bool   `json:"separator,omitempty"`
+	Spacing   string `json:"spacing,omitempty"`
+}
+
+// teamsEscaper escapes the markdown characters that would break a link label
+var teamsEscaper = strings.NewReplacer("[", "\\[", "]", "\\]")
+
+// RenderTeamsBrief renders a brief as an Adaptive Card with a heading followed by a linked title, description and
+// context per article
+func RenderTeamsBrief(brief models.Brief) TeamsMessage {
+	body := []AdaptiveElement{
+		{Type: "TextBlock", Text: briefTitle(brief), Size: "Large", Weight: "Bolder", Wrap: true},
+	}
+
+	if len(brief.Articles) == 0 {
+		body = append(body, AdaptiveElement{Type: "TextBlock", Text: "No news today.", IsSubtle: true, Wrap: true})
+	}
+
+	for _, article := range brief.Articles {
+		body = append(body, AdaptiveElement{
+			Type:      "TextBlock",
+			Text:      fmt.Sprintf("[%s](%s)", teamsEscaper.Replace(article.Title), article.URL),
+			Weight:    "Bolder",
+			Wrap:      true,
+			Separator: true,
+			Spacing:   "Medium",
+		})
+		if article.Description != "" {
+			body = append(body, AdaptiveElement{Type: "TextBlock", Text: article.Description, Wrap: true})
+		}
+		if details := articleContext(article); details != "" {
+			body = append(body, AdaptiveElement{Type: "TextBlock", Text: details, IsSubtle: true, Size: "Small", Wrap: true})
+		}
+	}
+
+	return TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{{
+			ContentType: adaptiveCardContentType,
+			Content: AdaptiveCard{
+				Schema:  adaptiveCardSchema,
+				Type:    "AdaptiveCard",
+				Version: adaptiveCardVersion,
+				Body:    body,
+			},
+		}},
+	}
+}
@@ -0,0 +1,404 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/semper-proficiens/go-utils/web/securehttp"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// EventArticlesIngested is the event sent when the fetch pipeline ingests articles matching a webhook filter
+	EventArticlesIngested = "articles.ingested"
+
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the webhook secret
+	SignatureHeader = "X-Devbriefs-Signature"
+	// TimestampHeader carries the unix time the payload was signed at, receivers should reject stale timestamps
+	TimestampHeader = "X-Devbriefs-Timestamp"
+	EventHeader     = "X-Devbriefs-Event"
+	DeliveryHeader  = "X-Devbriefs-Delivery"
+
+	webhookQueueSize = 64
+	// webhookBacklog bounds the batches waiting for each webhook, newer ones are dropped once it's full
+	webhookBacklog = 16
+	// webhookWorkers bounds the delivery attempts in flight, each webhook having at most one
+	webhookWorkers = 8
+)
+
+// errInvalidRequest is returned when the request of a webhook can't be built, e.g. its URL is invalid, which no retry
+// fixes
+var errInvalidRequest = errors.New("invalid webhook request")
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	Event     string               `json:"event"`
+	WebhookID string               `json:"webhookId"`
+	SentAt    time.Time            `json:"sentAt"`
+	Articles  []models.NewsArticle `json:"articles"`
+}
+
+// webhookBatch is articles waiting to be delivered to a webhook
+type webhookBatch struct {
+	webhook  models.Webhook
+	articles []models.NewsArticle
+}
+
+// WebhookDispatcher POSTs newly ingested articles to the webhooks whose filter they match. Failed deliveries are
+// retried with exponential backoff and every attempt is logged in the cache. Each webhook has its own queue, delivered
+// in order by its own worker, so a slow or dead receiver doesn't hold back the others.
+type WebhookDispatcher struct {
+	cache  datastore.Cache
+	client *http.Client
+	scorer *services.Scorer
+	queue  chan []models.NewsArticle
+
+	slots   chan struct{}             // taken by each attempt in flight
+	mu      sync.Mutex                // guards pending
+	pending map[string][]webhookBatch // the batches waiting for each webhook, which has a worker while listed
+	workers sync.WaitGroup            // the workers of pending
+
+	MaxAttempts int           // How many times we try to deliver a payload
+	BaseBackoff time.Duration // The wait before the first retry, doubled on each retry
+	MaxBackoff  time.Duration // The longest we wait between retries, also caps Retry-After
+
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+}
+
+func NewWebhookDispatcher(cache datastore.Cache, client *http.Client) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cache:       cache,
+		client:      client,
+		scorer:      services.NewScorer(),
+		queue:       make(chan []models.NewsArticle, webhookQueueSize),
+		slots:       make(chan struct{}, webhookWorkers),
+		pending:     make(map[string][]webhookBatch),
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		sleep:       sleepContext,
+		now:         time.Now,
+	}
+}
+
+// Enqueue queues ingested articles for dispatch without blocking, it's meant to be registered as an ingest hook.
+// Articles are dropped when the queue is full.
+func (d *WebhookDispatcher) Enqueue(articles []models.NewsArticle) {
+	select {
+	case d.queue <- articles:
+	default:
+		slog.Warn("webhook queue is full, dropping articles", "articles", len(articles))
+	}
+}
+
+// Run dispatches queued articles until the context is cancelled, without waiting for their deliveries before
+// dispatching the next ones. It returns once the deliveries in flight are cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	defer d.workers.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case articles := <-d.queue:
+			if err := d.dispatch(ctx, articles); err != nil {
+				slog.ErrorContext(ctx, "failed to dispatch webhooks", logging.Err(err))
+			}
+		}
+	}
+}
+
+// Dispatch delivers the articles to every webhook whose filter matches at least one of them, and waits until every
+// webhook queue is delivered
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, articles []models.NewsArticle) error {
+	err := d.dispatch(ctx, articles)
+	d.workers.Wait()
+	return err
+}
+
+// dispatch queues the articles for every webhook whose filter matches at least one of them
+func (d *WebhookDispatcher) dispatch(ctx context.Context, articles []models.NewsArticle) error {
+	webhooks, err := datastore.GetWebhooks(ctx, d.cache)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		matched, err := d.match(ctx, webhook.Filter, articles)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to match webhook", "webhook_id", webhook.ID, logging.Err(err))
+			continue
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		d.push(ctx, webhookBatch{webhook: webhook, articles: matched})
+	}
+	return nil
+}
+
+// push queues a batch for its webhook, starting the worker of the webhook when it has none. The batch is dropped when
+// webhookBacklog batches are already waiting, e.g. while the receiver is down.
+func (d *WebhookDispatcher) push(ctx context.Context, batch webhookBatch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	batches, working := d.pending[batch.webhook.ID]
+	if len(batches) >= webhookBacklog {
+		slog.WarnContext(ctx, "webhook backlog is full, dropping articles", "webhook_id", batch.webhook.ID, "articles", len(batch.articles))
+		return
+	}
+	d.pending[batch.webhook.ID] = append(batches, batch)
+	if !working {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			d.work(ctx, batch.webhook.ID)
+		}()
+	}
+}
+
+// work delivers the batches queued for a webhook one at a time, so they arrive in order, until its queue is empty, the
+// webhook is deleted or ctx is cancelled, and then removes its queue
+func (d *WebhookDispatcher) work(ctx context.Context, webhookID string) {
+	for {
+		d.mu.Lock()
+		batches := d.pending[webhookID]
+		if len(batches) == 0 || ctx.Err() != nil {
+			delete(d.pending, webhookID)
+			d.mu.Unlock()
+			return
+		}
+		batch := batches[0]
+		d.pending[webhookID] = batches[1:]
+		d.mu.Unlock()
+
+		// the webhook may have been updated or deleted while the batch was waiting
+		webhook, err := datastore.GetWebhook(ctx, d.cache, webhookID)
+		if errors.Is(err, datastore.ErrNotFound) {
+			d.mu.Lock()
+			delete(d.pending, webhookID)
+			d.mu.Unlock()
+			return
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to read webhook", "webhook_id", webhookID, logging.Err(err))
+			webhook = batch.webhook
+		}
+		if err = d.Deliver(ctx, webhook, batch.articles); err != nil {
+			slog.WarnContext(ctx, "failed to deliver webhook", "webhook_id", webhookID, logging.Err(err))
+		}
+	}
+}
+
+// match returns the articles selected by a filter, scored and flagged with the watched entities they mention
+func (d *WebhookDispatcher) match(ctx context.Context, filter models.WebhookFilter, articles []models.NewsArticle) ([]models.NewsArticle, error) {
+	var watchlists []models.Watchlist
+	for _, id := range filter.Watchlists {
+		watchlist, err := datastore.GetWatchlist(ctx, d.cache, id)
+		if errors.Is(err, datastore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		watchlists = append(watchlists, watchlist)
+	}
+	if len(filter.Watchlists) > 0 && len(watchlists) == 0 {
+		// every watchlist of the filter was deleted, nothing can match
+		return nil, nil
+	}
+
+	var matched []models.NewsArticle
+	now := d.now()
+	for _, article := range articles {
+		if len(filter.Topics) > 0 && !slices.Contains(filter.Topics, article.Topic) {
+			continue
+		}
+		if len(filter.Tags) > 0 && !overlaps(filter.Tags, article.Tags) {
+			continue
+		}
+		article.Score = d.scorer.Score(article, now)
+		if article.Score < filter.MinScore {
+			continue
+		}
+		if len(watchlists) > 0 {
+			article.Mentions = nil
+			for _, watchlist := range watchlists {
+				article.Mentions = append(article.Mentions, services.MatchWatchlist(watchlist, article)...)
+			}
+			if len(article.Mentions) == 0 {
+				continue
+			}
+		}
+		matched = append(matched, article)
+	}
+	return matched, nil
+}
+
+// Deliver POSTs the articles to a webhook, retrying failed attempts until MaxAttempts is reached
+func (d *WebhookDispatcher) Deliver(ctx context.Context, webhook models.Webhook, articles []models.NewsArticle) error {
+	body, err := json.Marshal(WebhookPayload{
+		Event:     EventArticlesIngested,
+		WebhookID: webhook.ID,
+		SentAt:    d.now().UTC(),
+		Articles:  articles,
+	})
+	if err != nil {
+		return err
+	}
+
+	articleIDs := make([]string, len(articles))
+	for i, article := range articles {
+		articleIDs[i] = article.ID
+	}
+
+	deliveryID := uuid.NewString()
+	backoff := d.BaseBackoff
+	for attempt := 1; ; attempt++ {
+		release, err := d.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		delivery, retryAfter, err := d.attempt(ctx, webhook, deliveryID, body)
+		release()
+		delivery.Attempt = attempt
+		delivery.ArticleIDs = articleIDs
+		if logErr := datastore.AddWebhookDelivery(ctx, d.cache, delivery); logErr != nil {
+			slog.ErrorContext(ctx, "failed to log webhook delivery", "webhook_id", webhook.ID, "delivery_id", deliveryID, logging.Err(logErr))
+		}
+
+		if delivery.Success {
+			return nil
+		}
+		if !retryable(delivery.StatusCode, err) || attempt >= d.MaxAttempts {
+			return fmt.Errorf("delivery %s failed after %d attempts: %s", deliveryID, attempt, delivery.Error)
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if err = d.sleep(ctx, min(wait, d.MaxBackoff)); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, d.MaxBackoff)
+	}
+}
+
+// acquire waits until a slot is free and returns the function releasing it. Retries wait without holding one, so a
+// dead receiver ties up a single slot at most.
+func (d *WebhookDispatcher) acquire(ctx context.Context) (func(), error) {
+	select {
+	case d.slots <- struct{}{}:
+		return func() { <-d.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// attempt makes a single delivery attempt, returning how long the receiver asked us to wait if it did, and the error
+// of the request when it failed without a response
+func (d *WebhookDispatcher) attempt(ctx context.Context, webhook models.Webhook, deliveryID string, body []byte) (models.WebhookDelivery, time.Duration, error) {
+	start := d.now()
+	delivery := models.WebhookDelivery{
+		ID:          deliveryID,
+		WebhookID:   webhook.ID,
+		AttemptedAt: start.UTC(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, 0, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, EventArticlesIngested)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	delivery.Duration = d.now().Sub(start)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, 0, err
+	}
+	defer securehttp.ResponseBodyCloser(resp.Body)
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("receiver answered with status code %d", resp.StatusCode)
+	}
+	return delivery, parseRetryAfter(resp.Header.Get("Retry-After"), d.now()), nil
+}
+
+// Sign returns the signature header value of a payload, receivers recompute it with their copy of the secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable reports whether a failed attempt is worth retrying: the request failed in transport, unless the webhook
+// points to our network which it won't stop doing, or the receiver is rate limiting us or failed on its side
+func retryable(statusCode int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, errInvalidRequest) && !errors.Is(err, ErrForbiddenAddress)
+	}
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func overlaps(a, b []string) bool {
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,439 @@
+package delivery
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a local webhook endpoint answering with the given status codes in order, then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	rc.bodies = append(rc.bodies, body)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "7")
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(cache datastore.Cache, slept *[]time.Duration) *WebhookDispatcher {
+	d := NewWebhookDispatcher(cache, http.DefaultClient)
+	d.MaxAttempts = 3
+	d.sleep = func(_ context.Context, wait time.Duration) error {
+		*slept = append(*slept, wait)
+		return nil
+	}
+	return d
+}
+
+func TestDeliverSignsAndRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		expectedAttempts int
+		expectedSleeps   []time.Duration
+		expectError      bool
+	}{
+		{
+			name:             "Delivered on first attempt",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Retried with exponential backoff",
+			statuses:         []int{http.StatusInternalServerError, http.StatusBadGateway},
+			expectedAttempts: 3,
+			expectedSleeps:   []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:             "Retry-After is honored",
+			statuses:         []int{http.StatusTooManyRequests},
+			expectedAttempts: 2,
+			expectedSleeps:   []time.Duration{7 * time.Second},
+		},
+		{
+			name:             "Client errors are not retried",
+			statuses:         []int{http.StatusGone},
+			expectedAttempts: 1,
+			expectError:      true,
+		},
+		{
+			name:             "Gives up after max attempts",
+			statuses:         []int{500, 500, 500},
+			expectedAttempts: 3,
+			expectedSleeps:   []time.Duration{time.Second, 2 * time.Second},
+			expectError:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			cache := datastore.NewMemoryCache()
+			var slept []time.Duration
+			d := newTestDispatcher(cache, &slept)
+			webhook := models.Webhook{ID: "hook", URL: server.URL, Secret: "s3cret"}
+
+			err := d.Deliver(context.Background(), webhook, []models.NewsArticle{{ID: "a1", Title: "Breach"}})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if len(rc.bodies) != tt.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.expectedAttempts, len(rc.bodies))
+			}
+			if len(slept) != len(tt.expectedSleeps) {
+				t.Fatalf("expected sleeps %v, got %v", tt.expectedSleeps, slept)
+			}
+			for i := range slept {
+				if slept[i] != tt.expectedSleeps[i] {
+					t.Errorf("expected sleeps %v, got %v", tt.expectedSleeps, slept)
+				}
+			}
+
+			for i, body := range rc.bodies {
+				header := rc.headers[i]
+				expected := Sign("s3cret", header.Get(TimestampHeader), body)
+				if header.Get(SignatureHeader) != expected {
+					t.Errorf("expected signature %s, got %s", expected, header.Get(SignatureHeader))
+				}
+				var payload WebhookPayload
+				if err = json.Unmarshal(body, &payload); err != nil || payload.Event != EventArticlesIngested {
+					t.Errorf("unexpected payload %s: %v", body, err)
+				}
+			}
+
+			deliveries, err := datastore.GetWebhookDeliveries(context.Background(), cache, "hook")
+			if err != nil {
+				t.Fatalf("could not read delivery log: %v", err)
+			}
+			if len(deliveries) != tt.expectedAttempts {
+				t.Errorf("expected %d logged attempts, got %d", tt.expectedAttempts, len(deliveries))
+			}
+		})
+	}
+}
+
+func TestDispatchFilters(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	cache := datastore.NewMemoryCache()
+	watchlist := models.Watchlist{ID: "suppliers", ClientID: "team-a", Vendors: []string{"Okta"}}
+	webhooks := []models.Webhook{
+		{ID: "by-tag", URL: server.URL, Filter: models.WebhookFilter{Tags: []string{"ransomware"}}},
+		{ID: "by-watchlist", URL: server.URL, Filter: models.WebhookFilter{Watchlists: []string{"suppliers"}}},
+		{ID: "by-topic", URL: server.URL, Filter: models.WebhookFilter{Topics: []string{"cloud"}}},
+		{ID: "by-score", URL: server.URL, Filter: models.WebhookFilter{MinScore: 100}},
+	}
+	if err := datastore.SetWatchlist(ctx, cache, watchlist); err != nil {
+		t.Fatalf("could not store watchlist: %v", err)
+	}
+	for _, webhook := range webhooks {
+		if err := datastore.SetWebhook(ctx, cache, webhook); err != nil {
+			t.Fatalf("could not store webhook: %v", err)
+		}
+	}
+
+	var slept []time.Duration
+	d := newTestDispatcher(cache, &slept)
+	articles := []models.NewsArticle{
+		{ID: "a1", Topic: "hacking", Title: "Okta support system breached"},
+		{ID: "a2", Topic: "hacking", Title: "Ransomware hits hospital", Tags: []string{"ransomware"}},
+	}
+	if err := d.Dispatch(ctx, articles); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	delivered := make(map[string][]string)
+	for _, body := range rc.bodies {
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("could not decode payload: %v", err)
+		}
+		for _, article := range payload.Articles {
+			delivered[payload.WebhookID] = append(delivered[payload.WebhookID], article.ID)
+		}
+	}
+
+	expected := map[string][]string{"by-tag": {"a2"}, "by-watchlist": {"a1"}}
+	if len(delivered) != len(expected) {
+		t.Fatalf("expected deliveries %v, got %v", expected, delivered)
+	}
+	for id, ids := range expected {
+		if len(delivered[id]) != 1 || delivered[id][0] != ids[0] {
+			t.Errorf("expected webhook %s to get %v, got %v", id, ids, delivered[id])
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":          true,
+		"2606:2800:220:1::":      true,
+		"127.0.0.1":              false,
+		"::1":                    false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.0.229":          false,
+		"169.254.169.254":        false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"224.0.0.1":              false,
+		"::ffff:169.254.169.254": false,
+		"64:ff9b::a9fe:a9fe":     false,
+	}
+	for address, expected := range tests {
+		if got := PublicAddr(netip.MustParseAddr(address)); got != expected {
+			t.Errorf("expected %s public %v, got %v", address, expected, got)
+		}
+	}
+}
+
+func TestCheckWebhookHost(t *testing.T) {
+	for _, host := range []string{"localhost", "api.localhost", "127.0.0.1", "169.254.169.254", "::1"} {
+		if err := CheckWebhookHost(host); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("expected %s to be refused, got %v", host, err)
+		}
+	}
+	for _, host := range []string{"example.com", "93.184.216.34"} {
+		if err := CheckWebhookHost(host); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", host, err)
+		}
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	cache := datastore.NewMemoryCache()
+	var slept []time.Duration
+	d := newTestDispatcher(cache, &slept)
+	d.client = NewWebhookClient(time.Second)
+	// like a webhook whose host resolved to a public address when it was registered, and to loopback now
+	webhook := models.Webhook{ID: "hook", URL: server.URL, Secret: "s3cret"}
+
+	err := d.Deliver(context.Background(), webhook, []models.NewsArticle{{ID: "a1", Title: "Breach"}})
+	if err == nil || !strings.Contains(err.Error(), ErrForbiddenAddress.Error()) {
+		t.Fatalf("expected %v, got %v", ErrForbiddenAddress, err)
+	}
+	if len(rc.bodies) != 0 {
+		t.Errorf("expected nothing delivered, got %d requests", len(rc.bodies))
+	}
+	// and it isn't retried
+	deliveries, err := datastore.GetWebhookDeliveries(context.Background(), cache, "hook")
+	if err != nil || len(deliveries) != 1 || !strings.Contains(deliveries[0].Error, ErrForbiddenAddress.Error()) {
+		t.Errorf("expected a single attempt refused, got %+v (%v)", deliveries, err)
+	}
+}
+
+func TestRunDeliversAroundHangingReceiver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+	rc := &receiver{}
+	healthy := httptest.NewServer(rc)
+	defer healthy.Close()
+
+	cache := datastore.NewMemoryCache()
+	for _, webhook := range []models.Webhook{{ID: "hanging", URL: hanging.URL}, {ID: "healthy", URL: healthy.URL}} {
+		if err := datastore.SetWebhook(ctx, cache, webhook); err != nil {
+			t.Fatalf("could not store webhook: %v", err)
+		}
+	}
+	d := NewWebhookDispatcher(cache, &http.Client{Timeout: time.Minute})
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	// the healthy receiver gets every batch while the other one still hasn't answered the first
+	d.Enqueue([]models.NewsArticle{{ID: "a1", Title: "Breach"}})
+	d.Enqueue([]models.NewsArticle{{ID: "a2", Title: "Ransomware"}})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rc.mu.Lock()
+		delivered := len(rc.bodies)
+		rc.mu.Unlock()
+		if delivered == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 deliveries to the healthy receiver, got %d", delivered)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// and the hanging delivery is cancelled with Run
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return once cancelled")
+	}
+}
+
+func TestDeliverDoesNotRetryInvalidRequests(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	var slept []time.Duration
+	d := newTestDispatcher(cache, &slept)
+	webhook := models.Webhook{ID: "hook", URL: "http://exa mple.com/hook", Secret: "s3cret"}
+
+	if err := d.Deliver(context.Background(), webhook, []models.NewsArticle{{ID: "a1"}}); err == nil {
+		t.Fatal("expected an error for an invalid URL")
+	}
+	if len(slept) != 0 {
+		t.Errorf("expected no retry, got sleeps %v", slept)
+	}
+	deliveries, err := datastore.GetWebhookDeliveries(context.Background(), cache, "hook")
+	if err != nil || len(deliveries) != 1 {
+		t.Errorf("expected a single attempt, got %+v (%v)", deliveries, err)
+	}
+}
+
+// gatedReceiver is a webhook endpoint holding the first request until released, answering with the given status codes
+// in order, then 200, and recording the IDs of the articles of each request
+type gatedReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	ids      []string
+	held     chan struct{}
+	release  chan struct{}
+}
+
+func newGatedReceiver(statuses ...int) *gatedReceiver {
+	return &gatedReceiver{statuses: statuses, held: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (rc *gatedReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload WebhookPayload
+	_ = json.NewDecoder(r.Body).Decode(&payload)
+	rc.mu.Lock()
+	first := len(rc.ids) == 0
+	for _, article := range payload.Articles {
+		rc.ids = append(rc.ids, article.ID)
+	}
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	rc.mu.Unlock()
+	if first {
+		close(rc.held)
+		<-rc.release
+	}
+	w.WriteHeader(status)
+}
+
+func TestDispatchQueuesPerWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		batches     int
+		deleted     bool
+		expectedIDs []string
+	}{
+		{
+			name:        "Batches are delivered in order after a retry",
+			statuses:    []int{http.StatusInternalServerError},
+			batches:     3,
+			expectedIDs: []string{"a1", "a1", "a2", "a3"},
+		},
+		{
+			name:    "Batches beyond the backlog are dropped",
+			batches: webhookBacklog + 5,
+			expectedIDs: func() []string {
+				var ids []string
+				for i := 1; i <= webhookBacklog+1; i++ {
+					ids = append(ids, fmt.Sprintf("a%d", i))
+				}
+				return ids
+			}(),
+		},
+		{
+			name:        "Batches of a deleted webhook are dropped",
+			batches:     3,
+			deleted:     true,
+			expectedIDs: []string{"a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rc := newGatedReceiver(tt.statuses...)
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			cache := datastore.NewMemoryCache()
+			if err := datastore.SetWebhook(ctx, cache, models.Webhook{ID: "hook", URL: server.URL}); err != nil {
+				t.Fatalf("could not store webhook: %v", err)
+			}
+			var slept []time.Duration
+			d := newTestDispatcher(cache, &slept)
+
+			// the first batch holds the worker while the others are queued
+			for i := 1; i <= tt.batches; i++ {
+				if err := d.dispatch(ctx, []models.NewsArticle{{ID: fmt.Sprintf("a%d", i)}}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if i == 1 {
+					<-rc.held
+				}
+			}
+			if tt.deleted {
+				if err := datastore.RemoveWebhook(ctx, cache, "hook"); err != nil {
+					t.Fatalf("could not remove webhook: %v", err)
+				}
+			}
+			close(rc.release)
+			d.workers.Wait()
+
+			if strings.Join(rc.ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Errorf("expected deliveries %v, got %v", tt.expectedIDs, rc.ids)
+			}
+			if len(d.pending) != 0 {
+				t.Errorf("expected no queue left, got %v", d.pending)
+			}
+		})
+	}
+}
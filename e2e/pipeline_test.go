@@ -0,0 +1,154 @@
+// Package e2e tests the whole fetch pipeline offline, from NewsAPI serving its recorded responses over HTTP to the
+// handlers serving the articles it fetched, deduplicated and cached.
+package e2e
+
+import (
+	"context"
+	"devbriefs-news/api"
+	"devbriefs-news/app"
+	"devbriefs-news/datastore"
+	"devbriefs-news/handlers"
+	"devbriefs-news/models"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/upstream"
+	"devbriefs-news/upstream/upstreamtest"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const apiKey = "e2e-api-key"
+
+// newsAPI is a fake NewsAPI serving the fixtures of the services tests, or failing with status when set
+type newsAPI struct {
+	server   *httptest.Server
+	requests atomic.Int32
+	status   atomic.Int32
+}
+
+func newNewsAPI(t *testing.T) *newsAPI {
+	fixtures, err := upstreamtest.Load("../services/testdata/newsapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := upstreamtest.NewHandler(fixtures)
+	handler.APIKey = apiKey
+
+	n := &newsAPI{}
+	n.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.requests.Add(1)
+		if status := int(n.status.Load()); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+// newService wires the fetch pipeline as main does, against the fake NewsAPI and an in-memory cache
+func newService(t *testing.T, upstreamAPI *newsAPI, breakerSettings resilience.BreakerSettings) (*gin.Engine, datastore.Cache) {
+	cache := datastore.NewMemoryCache()
+	pipeline, err := app.NewPipeline(cache, upstream.NewClient(upstreamAPI.server.Client()), app.PipelineConfig{
+		NewsAPIKey: apiKey,
+		NewsAPIURL: upstreamAPI.server.URL,
+		Budget:     services.Budget{Limit: 100},
+		Timeouts:   api.FetchTimeouts{Default: 5 * time.Second},
+		Retry:      resilience.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		Breaker:    breakerSettings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newsAPI, ingestor := pipeline.NewsAPI, pipeline.Ingestor
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/api/everything-hacking-news", func(c *gin.Context) {
+		handlers.GetEveryHackingNews(c.Writer, c.Request, newsAPI, ingestor)
+	})
+	engine.GET("/api/feeds/:topic/:format", func(c *gin.Context) {
+		handlers.GetTopicFeed(c.Writer, c.Request, c.Param("topic"), c.Param("format"), cache)
+	})
+	return engine, cache
+}
+
+func get(engine *gin.Engine, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	engine.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	return rr
+}
+
+func TestPipeline(t *testing.T) {
+	upstreamAPI := newNewsAPI(t)
+	engine, cache := newService(t, upstreamAPI, resilience.DefaultBreakerSettings)
+
+	rr := get(engine, "/api/everything-hacking-news")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var news map[string]models.NewsArticle
+	if err := json.Unmarshal(rr.Body.Bytes(), &news); err != nil {
+		t.Fatal(err)
+	}
+	// the 5 articles recorded cover 4 stories
+	if len(news) != 4 {
+		t.Errorf("expected 4 articles, got %d", len(news))
+	}
+
+	// which were cached, and are served from there
+	articles, err := datastore.GetArticles(context.Background(), cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != len(news) {
+		t.Errorf("expected the %d articles fetched to be cached, got %d", len(news), len(articles))
+	}
+	var feed struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	rr = get(engine, "/api/feeds/hacking/json")
+	if err = json.Unmarshal(rr.Body.Bytes(), &feed); err != nil || len(feed.Items) != len(news) {
+		t.Errorf("expected the feed to list the %d articles cached, got %d (%v)", len(news), len(feed.Items), err)
+	}
+
+	status, err := datastore.GetFetchStatus(context.Background(), cache, services.TopicHacking)
+	if err != nil || status.LastSuccess == nil {
+		t.Errorf("expected the fetch to be recorded, got %+v (%v)", status, err)
+	}
+}
+
+func TestPipelineNewsAPIDown(t *testing.T) {
+	upstreamAPI := newNewsAPI(t)
+	upstreamAPI.status.Store(http.StatusServiceUnavailable)
+	engine, cache := newService(t, upstreamAPI, resilience.BreakerSettings{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+	// every fetch is retried once, until the circuit opens
+	for range 2 {
+		if rr := get(engine, "/api/everything-hacking-news"); rr.Code != http.StatusInternalServerError {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+		}
+	}
+	if requests := upstreamAPI.requests.Load(); requests != 4 {
+		t.Errorf("expected 4 NewsAPI requests, got %d", requests)
+	}
+
+	// then NewsAPI isn't called anymore
+	rr := get(engine, "/api/everything-hacking-news")
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 503 with Retry-After once the circuit is open, got %v %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if requests := upstreamAPI.requests.Load(); requests != 4 {
+		t.Errorf("expected no NewsAPI request once the circuit is open, got %d", requests-4)
+	}
+	// nor charged to its budget
+	if calls, err := datastore.GetUpstreamCalls(context.Background(), cache, api.ProviderNewsAPI, time.Now()); err != nil || calls != 4 {
+		t.Errorf("expected the 4 NewsAPI requests charged to the budget, got %d (%v)", calls, err)
+	}
+}
@@ -0,0 +1,85 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Atom 1.0, see https://www.rfc-editor.org/rfc/rfc4287
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []atomLink     `xml:"link"`
+	Summary    string         `xml:"summary,omitempty"`
+	Author     atomPerson     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Atom renders a feed as Atom 1.0
+func Atom(feed Feed) ([]byte, error) {
+	doc := atomFeed{
+		ID:       feed.ID,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: feed.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: feed.HomeURL, Rel: "alternate"},
+		},
+		Generator: generator,
+	}
+	for _, article := range feed.Articles {
+		published := publishedAt(article, feed.Updated).UTC().Format(time.RFC3339)
+		// an atom entry requires an author, the outlet is the closest thing we have
+		author := article.Source.Name
+		if author == "" {
+			author = generator
+		}
+		entry := atomEntry{
+			ID:        ArticleGUID(article),
+			Title:     article.Title,
+			Updated:   published,
+			Published: published,
+			Links:     []atomLink{{Href: article.URL, Rel: "alternate"}},
+			Summary:   article.Description,
+			Author:    atomPerson{Name: author},
+		}
+		for _, tag := range article.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
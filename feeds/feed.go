@@ -0,0 +1,70 @@
+package feeds
+
+import (
+	"devbriefs-news/models"
+	"time"
+)
+
+const (
+	FormatRSS  = "rss"
+	FormatAtom = "atom"
+	FormatJSON = "json"
+
+	generator = "DevBriefs"
+)
+
+// ContentTypes maps each feed format to the content type it's served with
+var ContentTypes = map[string]string{
+	FormatRSS:  "application/rss+xml; charset=utf-8",
+	FormatAtom: "application/atom+xml; charset=utf-8",
+	FormatJSON: "application/feed+json; charset=utf-8",
+}
+
+// Feed is the format agnostic description of a feed, rendered by RSS, Atom and JSONFeed
+type Feed struct {
+	ID          string               // A permanent identifier of the feed, e.g. "urn:devbriefs:topic:hacking"
+	Title       string               // e.g. "DevBriefs - hacking"
+	Description string               // A sentence about the feed
+	HomeURL     string               // The page the feed is about
+	FeedURL     string               // The URL the feed is served at
+	Updated     time.Time            // When the feed content last changed
+	Articles    []models.NewsArticle // The items, newest first
+}
+
+// ArticleGUID returns the permanent identifier of an article in every feed format. It's based on the article ID
+// rather than its URL, as outlets sometimes move articles around.
+func ArticleGUID(article models.NewsArticle) string {
+	return "urn:devbriefs:article:" + article.ID
+}
+
+// Render renders a feed in one of FormatRSS, FormatAtom or FormatJSON
+func Render(feed Feed, format string) ([]byte, error) {
+	switch format {
+	case FormatRSS:
+		return RSS(feed)
+	case FormatAtom:
+		return Atom(feed)
+	case FormatJSON:
+		return JSONFeed(feed)
+	default:
+		return nil, &UnknownFormatError{Format: format}
+	}
+}
+
+// UnknownFormatError is returned when rendering a feed in a format we don't support
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return "unknown feed format " + e.Format + ", expected rss, atom or json"
+}
+
+// publishedAt parses the publication date of an article, articles with an invalid date are dated at the feed update
+func publishedAt(article models.NewsArticle, fallback time.Time) time.Time {
+	published, err := time.Parse(time.RFC3339, article.PublishedAt)
+	if err != nil {
+		return fallback
+	}
+	return published
+}
@@ -0,0 +1,121 @@
+package feeds
+
+import (
+	"devbriefs-news/models"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testFeed = Feed{
+	ID:          "urn:devbriefs:topic:hacking",
+	Title:       "DevBriefs - hacking",
+	Description: "Curated hacking news",
+	HomeURL:     "http://localhost:8080/api/everything-hacking-news",
+	FeedURL:     "http://localhost:8080/api/feeds/hacking/rss",
+	Updated:     time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+	Articles: []models.NewsArticle{
+		{
+			ID:          "a1",
+			Title:       "Okta breach <exposes> sessions",
+			Description: "Attackers & sessions",
+			URL:         "https://example.com/okta",
+			PublishedAt: "2024-05-02T10:00:00Z",
+			Tags:        []string{"breach"},
+			Source:      models.NewsSource{Name: "Example"},
+		},
+		{
+			ID:          "a2",
+			Title:       "Undated",
+			URL:         "https://example.com/undated",
+			PublishedAt: "yesterday",
+		},
+	},
+}
+
+func TestRSS(t *testing.T) {
+	body, err := RSS(testFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc rssDocument
+	if err = xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected valid XML, got %v", err)
+	}
+	if doc.Version != "2.0" {
+		t.Errorf("expected version 2.0, got %q", doc.Version)
+	}
+	if len(doc.Channel.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(doc.Channel.Items))
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != "Okta breach <exposes> sessions" {
+		t.Errorf("expected the title to round trip, got %q", item.Title)
+	}
+	if item.GUID.Value != "urn:devbriefs:article:a1" || item.GUID.IsPermaLink {
+		t.Errorf("expected a non permalink guid based on the article ID, got %+v", item.GUID)
+	}
+	if item.PubDate != "Thu, 02 May 2024 10:00:00 +0000" {
+		t.Errorf("expected an RFC 1123 pubDate, got %q", item.PubDate)
+	}
+	if doc.Channel.Items[1].PubDate != item.PubDate {
+		t.Errorf("expected an undated article to be dated at the feed update, got %q", doc.Channel.Items[1].PubDate)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := Atom(testFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc atomFeed
+	if err = xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected valid XML, got %v", err)
+	}
+	if doc.ID != testFeed.ID || doc.Updated != "2024-05-02T10:00:00Z" {
+		t.Errorf("expected feed id and updated, got %q and %q", doc.ID, doc.Updated)
+	}
+	if len(doc.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(doc.Entries))
+	}
+	if doc.Entries[0].ID != "urn:devbriefs:article:a1" {
+		t.Errorf("expected an entry id based on the article ID, got %q", doc.Entries[0].ID)
+	}
+	if doc.Entries[0].Author.Name != "Example" || doc.Entries[1].Author.Name != generator {
+		t.Errorf("expected the outlet as author, falling back to the generator, got %q and %q",
+			doc.Entries[0].Author.Name, doc.Entries[1].Author.Name)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	body, err := JSONFeed(testFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc jsonFeed
+	if err = json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if doc.Version != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("expected version 1.1, got %q", doc.Version)
+	}
+	if len(doc.Items) != 2 || doc.Items[0].ID != "urn:devbriefs:article:a1" {
+		t.Fatalf("expected items identified by article ID, got %+v", doc.Items)
+	}
+	if doc.Items[0].DatePublished != "2024-05-02T10:00:00Z" {
+		t.Errorf("expected an RFC 3339 date_published, got %q", doc.Items[0].DatePublished)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	_, err := Render(testFeed, "opml")
+	var unknownFormat *UnknownFormatError
+	if !errors.As(err, &unknownFormat) {
+		t.Errorf("expected an UnknownFormatError, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package feeds
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSON Feed 1.1, see https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// JSONFeed renders a feed as JSON Feed 1.1
+func JSONFeed(feed Feed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.HomeURL,
+		FeedURL:     feed.FeedURL,
+		Description: feed.Description,
+		Language:    "en",
+		Items:       make([]jsonFeedItem, 0, len(feed.Articles)),
+	}
+	for _, article := range feed.Articles {
+		item := jsonFeedItem{
+			ID:    ArticleGUID(article),
+			URL:   article.URL,
+			Title: article.Title,
+			// an item requires content, the description is all we have
+			ContentText:   article.Description,
+			Summary:       article.Description,
+			DatePublished: publishedAt(article, feed.Updated).UTC().Format(time.RFC3339),
+			Tags:          article.Tags,
+		}
+		if article.Source.Name != "" {
+			item.Authors = []jsonFeedAuthor{{Name: article.Source.Name}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,78 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// RSS 2.0, see https://www.rssboard.org/rss-specification
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf is the atom:link recommended by the RSS board to point at the feed itself
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders a feed as RSS 2.0
+func RSS(feed Feed) ([]byte, error) {
+	channel := rssChannel{
+		Title:         feed.Title,
+		Link:          feed.HomeURL,
+		Description:   feed.Description,
+		AtomLink:      rssSelf{Href: feed.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+		Generator:     generator,
+	}
+	for _, article := range feed.Articles {
+		item := rssItem{
+			Title:       article.Title,
+			Link:        article.URL,
+			Description: article.Description,
+			Categories:  article.Tags,
+			GUID:        rssGUID{IsPermaLink: false, Value: ArticleGUID(article)},
+			PubDate:     publishedAt(article, feed.Updated).UTC().Format(time.RFC1123Z),
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	body, err := xml.MarshalIndent(rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
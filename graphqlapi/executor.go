@@ -0,0 +1,58 @@
+package graphqlapi
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Request is a GraphQL request, as sent by clients in the body of a POST
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Executor runs GraphQL requests against the schema of our articles, rejecting the ones over its Limits
+type Executor struct {
+	Limits Limits
+
+	schema graphql.Schema
+	cache  datastore.Cache
+}
+
+func NewExecutor(cache datastore.Cache) (*Executor, error) {
+	schema, err := NewSchema(cache)
+	if err != nil {
+		return nil, err
+	}
+	return &Executor{
+		Limits: DefaultLimits,
+		schema: schema,
+		cache:  cache,
+	}, nil
+}
+
+// Execute parses, validates and runs a request. Errors are reported in the result, as GraphQL clients expect.
+func (e *Executor) Execute(ctx context.Context, req Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if validation := graphql.ValidateDocument(&e.schema, doc, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if err = e.Limits.Check(doc, req.Variables); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        e.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       WithArticles(ctx, e.cache),
+	})
+}
@@ -0,0 +1,182 @@
+package graphqlapi
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestExecutor(t *testing.T) *Executor {
+	t.Helper()
+	cache := datastore.NewMemoryCache()
+	ctx := context.Background()
+	for _, article := range []models.NewsArticle{
+		{ID: "a1", Title: "Okta breach exposes sessions", Topic: "hacking", PublishedAt: "2024-05-01T10:00:00Z",
+			Source: models.NewsSource{Name: "Wired"}, Tags: []string{"breach"},
+			Cluster: &models.Cluster{ID: "a1", Size: 2, Outlets: []string{"Wired", "The Verge"}}},
+		{ID: "a2", Title: "LockBit ransomware returns", Topic: "hacking", PublishedAt: "2024-05-03T10:00:00Z",
+			Source: models.NewsSource{Name: "Ars Technica"}, Tags: []string{"ransomware"}},
+		{ID: "a3", Title: "Kernel 6.9 released", Topic: "linux", PublishedAt: "2024-05-02T10:00:00Z",
+			Source: models.NewsSource{Name: "Wired"}},
+	} {
+		if err := datastore.SetArticle(ctx, cache, article); err != nil {
+			t.Fatal(err)
+		}
+	}
+	brief := models.Brief{Topic: "hacking", GeneratedAt: time.Date(2024, 5, 3, 6, 0, 0, 0, time.UTC),
+		Articles: []models.NewsArticle{{ID: "a2", Title: "LockBit ransomware returns"}}}
+	if err := datastore.SetBrief(ctx, cache, brief); err != nil {
+		t.Fatal(err)
+	}
+
+	executor, err := NewExecutor(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executor
+}
+
+// execute runs a query and returns its JSON result
+func execute(t *testing.T, executor *Executor, query string, variables map[string]any) string {
+	t.Helper()
+	result := executor.Execute(context.Background(), Request{Query: query, Variables: variables})
+	body, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestExecute(t *testing.T) {
+	executor := newTestExecutor(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		expected  string
+	}{
+		{
+			name:     "Articles of a topic, newest first",
+			query:    `{ articles(topic: "hacking") { totalCount edges { node { id } } } }`,
+			expected: `{"data":{"articles":{"edges":[{"node":{"id":"a2"}},{"node":{"id":"a1"}}],"totalCount":2}}}`,
+		},
+		{
+			name:     "Filters",
+			query:    `{ articles(tags: ["BREACH"], source: "wired", search: "okta", publishedAfter: "2024-04-30T00:00:00Z") { edges { node { id } } } }`,
+			expected: `{"data":{"articles":{"edges":[{"node":{"id":"a1"}}]}}}`,
+		},
+		{
+			name:      "Cursor pagination",
+			query:     `query($after: String) { articles(first: 1, after: $after) { edges { node { id } } pageInfo { hasNextPage } } }`,
+			variables: map[string]any{"after": "b2Zmc2V0OjA"}, // offset:0
+			expected:  `{"data":{"articles":{"edges":[{"node":{"id":"a3"}}],"pageInfo":{"hasNextPage":true}}}}`,
+		},
+		{
+			name:     "Article to source to cluster to tags",
+			query:    `{ article(id: "a1") { source { name articleCount } cluster { size sources { name } } tags { name articleCount } } }`,
+			expected: `{"data":{"article":{"cluster":{"size":2,"sources":[{"name":"Wired"},{"name":"The Verge"}]},"source":{"articleCount":2,"name":"Wired"},"tags":[{"articleCount":1,"name":"breach"}]}}}`,
+		},
+		{
+			name:     "Unknown article",
+			query:    `{ article(id: "missing") { id } }`,
+			expected: `{"data":{"article":null}}`,
+		},
+		{
+			name:     "Sources, tags and clusters",
+			query:    `{ sources { name } tags { name } clusters { id article { title } } }`,
+			expected: `{"data":{"clusters":[{"article":{"title":"Okta breach exposes sessions"},"id":"a1"}],"sources":[{"name":"Ars Technica"},{"name":"Wired"}],"tags":[{"name":"breach"},{"name":"ransomware"}]}}`,
+		},
+		{
+			name:     "Brief",
+			query:    `{ brief(topic: "hacking") { generatedAt articles { id } } }`,
+			expected: `{"data":{"brief":{"articles":[{"id":"a2"}],"generatedAt":"2024-05-03T06:00:00Z"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, executor, tt.query, tt.variables); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	executor := newTestExecutor(t)
+	executor.Limits = Limits{MaxDepth: 6, MaxComplexity: 200}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		expected  string
+	}{
+		{name: "Syntax error", query: `{ articles {`, expected: "Syntax Error"},
+		{name: "Unknown field", query: `{ articles { nodes } }`, expected: `Cannot query field \"nodes\"`},
+		{name: "Invalid cursor", query: `{ articles(after: "nope") { totalCount } }`, expected: `invalid cursor`},
+		{name: "Page too large", query: `{ articles(first: 1000) { totalCount } }`, expected: `first must be between 0 and 100`},
+		{
+			name:     "Too deep",
+			query:    `{ articles { edges { node { source { articles { edges { node { id } } } } } } } }`,
+			expected: "query depth 8 exceeds the limit of 6",
+		},
+		{
+			name:      "Too complex",
+			query:     `query($first: Int) { articles(first: $first) { edges { node { id title url tags { name } } } } }`,
+			variables: map[string]any{"first": float64(50)},
+			expected:  "exceeds the limit of 200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, executor, tt.query, tt.variables); !strings.Contains(got, tt.expected) {
+				t.Errorf("expected an error containing %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestDefaultLimits checks the queries of the frontend pass DefaultLimits, while nested pages are still rejected
+func TestDefaultLimits(t *testing.T) {
+	executor := newTestExecutor(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		expected  string // in the error, none when empty
+	}{
+		{name: "Default page", query: `{ articles { edges { node { id title tags { name } } } } }`},
+		{name: "Largest page", query: `{ articles(first: 100) { edges { node { id title } } } }`},
+		{
+			name:      "Page of a variable size",
+			query:     `query($first: Int) { articles(first: $first) { edges { node { id title url publishedAt source { name } tags { name } } } pageInfo { hasNextPage endCursor } } }`,
+			variables: map[string]any{"first": float64(50)},
+		},
+		{name: "Sources and their articles", query: `{ sources { name articles { edges { node { id title } } } } }`},
+		{
+			name:     "Nested large pages",
+			query:    `{ articles(first: 100) { edges { node { source { articles(first: 100) { edges { node { id title } } } } } } } }`,
+			expected: "exceeds the limit of 5000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := execute(t, executor, tt.query, tt.variables)
+			if tt.expected == "" && strings.Contains(got, `"errors"`) {
+				t.Errorf("expected no error, got %s", got)
+			}
+			if tt.expected != "" && !strings.Contains(got, tt.expected) {
+				t.Errorf("expected an error containing %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql/language/ast"
+	"strconv"
+)
+
+// Limits bound the cost of a query before it's executed, as nested connections like
+// articles → source → articles → tags → articles can multiply the work of a small query
+type Limits struct {
+	MaxDepth      int // The deepest nesting of selections, e.g. "{ articles { edges { node { id } } } }" is 4 deep
+	MaxComplexity int // The number of fields the query may resolve, fields of connections counting "first" times
+}
+
+// DefaultLimits are generous enough for the frontend while keeping a query under a few thousand resolved fields
+var DefaultLimits = Limits{MaxDepth: 10, MaxComplexity: 5000}
+
+// Check returns an error when an operation of the document exceeds the limits. Variables are used to count
+// connections paginated with a variable "first".
+func (l Limits) Check(doc *ast.Document, variables map[string]any) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		operation, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		a := analyzer{fragments: fragments, variables: variables, visiting: make(map[string]bool)}
+		depth, complexity := a.selectionSet(operation.SelectionSet)
+		if depth > l.MaxDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+		}
+		if complexity > l.MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	visiting  map[string]bool // the fragments being expanded, to stop on cycles which validation reports anyway
+}
+
+// selectionSet returns the depth and complexity of a selection set, fragments being expanded in place
+func (a analyzer) selectionSet(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = a.selectionSet(selection.SelectionSet)
+			d++
+			c = 1 + c*a.multiplier(selection)
+		case *ast.InlineFragment:
+			d, c = a.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			fragment, ok := a.fragments[selection.Name.Value]
+			if !ok || a.visiting[fragment.Name.Value] {
+				continue
+			}
+			a.visiting[fragment.Name.Value] = true
+			d, c = a.selectionSet(fragment.SelectionSet)
+			delete(a.visiting, fragment.Name.Value)
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// multiplier returns how many times the selections of a field are resolved: "first" times for connections (at most
+// maxFirst, as larger pages are rejected), and defaultFirst for other lists we can't size before running the query. The
+// edges of a connection, and their node, are already counted "first" times by the connection.
+func (a analyzer) multiplier(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				return min(max(n, 1), maxFirst)
+			}
+		case *ast.Variable:
+			switch n := a.variables[value.Name.Value].(type) {
+			case float64:
+				return min(max(int(n), 1), maxFirst)
+			case int:
+				return min(max(n, 1), maxFirst)
+			}
+		}
+		return defaultFirst
+	}
+	switch field.Name.Value {
+	case "articles", "sources", "clusters", "tags":
+		return defaultFirst
+	}
+	return 1
+}
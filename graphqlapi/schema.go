@@ -0,0 +1,416 @@
+package graphqlapi
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFirst = 20
+	maxFirst     = 100
+)
+
+// scorer computes the score of articles at query time
+var scorer = services.NewScorer()
+
+// connectionArgs are the cursor pagination arguments of every list of articles
+var connectionArgs = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultFirst, Description: "At most 100"},
+	"after": &graphql.ArgumentConfig{Type: graphql.String, Description: "The endCursor of the previous page"},
+}
+
+// NewSchema returns the GraphQL schema of our articles, sources, clusters, tags and briefs, resolved against the cache
+func NewSchema(cache datastore.Cache) (graphql.Schema, error) {
+	var articleType, sourceType, clusterType, tagType *graphql.Object
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	articleEdgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ArticleEdge",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"node":   &graphql.Field{Type: graphql.NewNonNull(articleType)},
+			}
+		}),
+	})
+
+	articleConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ArticleConnection",
+		Fields: graphql.Fields{
+			"edges":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(articleEdgeType)))},
+			"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	sortEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name: "ArticleSort",
+		Values: graphql.EnumValueConfigMap{
+			"PUBLISHED_AT": &graphql.EnumValueConfig{Value: services.SortByPublishedAt, Description: "Newest first"},
+			"SCORE":        &graphql.EnumValueConfig{Value: services.SortByScore, Description: "Most relevant first"},
+		},
+	})
+
+	articleType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Article",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: articleField(func(a models.NewsArticle) any { return a.ID })},
+				"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: articleField(func(a models.NewsArticle) any { return a.Title })},
+				"url":         &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: articleField(func(a models.NewsArticle) any { return a.URL })},
+				"description": &graphql.Field{Type: graphql.String, Resolve: articleField(func(a models.NewsArticle) any { return a.Description })},
+				"publishedAt": &graphql.Field{Type: graphql.String, Resolve: articleField(func(a models.NewsArticle) any { return a.PublishedAt })},
+				"topic":       &graphql.Field{Type: graphql.String, Resolve: articleField(func(a models.NewsArticle) any { return a.Topic })},
+				"score": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.Float),
+					Description: "The relevance score at the time of the query",
+					Resolve: articleField(func(a models.NewsArticle) any {
+						return scorer.Score(a, time.Now())
+					}),
+				},
+				"source": &graphql.Field{
+					Type:    graphql.NewNonNull(sourceType),
+					Resolve: articleField(func(a models.NewsArticle) any { return a.Source.Name }),
+				},
+				"cluster": &graphql.Field{
+					Type:        clusterType,
+					Description: "The other outlets that covered the story, null when it's the only one",
+					Resolve: articleField(func(a models.NewsArticle) any {
+						if a.Cluster == nil {
+							return nil
+						}
+						return *a.Cluster
+					}),
+				},
+				"tags": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+					Resolve: articleField(func(a models.NewsArticle) any { return a.Tags }),
+				},
+			}
+		}),
+	})
+
+	sourceType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Source",
+		Description: "An outlet we got articles from",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				}},
+				"articleCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					return len(filterArticles(articles, func(a models.NewsArticle) bool { return a.Source.Name == p.Source })), err
+				}},
+				"articles": &graphql.Field{Type: graphql.NewNonNull(articleConnectionType), Args: connectionArgs, Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					return paginate(filterArticles(articles, func(a models.NewsArticle) bool { return a.Source.Name == p.Source }), p.Args)
+				}},
+			}
+		}),
+	})
+
+	clusterType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Cluster",
+		Description: "A story covered by several outlets, collapsed into its representative article",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: clusterField(func(c models.Cluster) any { return c.ID })},
+				"size": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: clusterField(func(c models.Cluster) any { return c.Size })},
+				"sources": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sourceType))),
+					Resolve: clusterField(func(c models.Cluster) any { return c.Outlets }),
+				},
+				"article": &graphql.Field{Type: articleType, Description: "The representative article", Resolve: func(p graphql.ResolveParams) (any, error) {
+					return findArticle(p.Context, p.Source.(models.Cluster).ID)
+				}},
+			}
+		}),
+	})
+
+	tagType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				}},
+				"articleCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					return len(filterArticles(articles, hasTag(p.Source.(string)))), err
+				}},
+				"articles": &graphql.Field{Type: graphql.NewNonNull(articleConnectionType), Args: connectionArgs, Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					return paginate(filterArticles(articles, hasTag(p.Source.(string))), p.Args)
+				}},
+			}
+		}),
+	})
+
+	briefType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Brief",
+		Fields: graphql.Fields{
+			"topic":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"generatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"articles":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(articleType)))},
+		},
+	})
+
+	articlesArgs := graphql.FieldConfigArgument{
+		"topic":          &graphql.ArgumentConfig{Type: graphql.String},
+		"tags":           &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "Articles carrying any of these tags"},
+		"source":         &graphql.ArgumentConfig{Type: graphql.String, Description: "The name of the outlet"},
+		"search":         &graphql.ArgumentConfig{Type: graphql.String, Description: "Words the title or description must contain"},
+		"publishedAfter": &graphql.ArgumentConfig{Type: graphql.DateTime},
+		"sort":           &graphql.ArgumentConfig{Type: sortEnum, DefaultValue: services.SortByPublishedAt},
+	}
+	for name, arg := range connectionArgs {
+		articlesArgs[name] = arg
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"article": &graphql.Field{
+				Type: articleType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return findArticle(p.Context, p.Args["id"].(string))
+				},
+			},
+			"articles": &graphql.Field{
+				Type: graphql.NewNonNull(articleConnectionType),
+				Args: articlesArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					articles = filterArticles(articles, articleFilter(p.Args))
+					return paginate(services.SortArticles(articles, p.Args["sort"].(string), time.Now()), p.Args)
+				},
+			},
+			"sources": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sourceType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					return distinct(articles, func(a models.NewsArticle) []string { return []string{a.Source.Name} }), err
+				},
+			},
+			"clusters": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(clusterType))),
+				Description: "The stories covered by several outlets, largest first",
+				Args:        graphql.FieldConfigArgument{"minSize": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 2}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					var clusters []models.Cluster
+					for _, article := range articles {
+						if article.Cluster != nil && article.Cluster.Size >= p.Args["minSize"].(int) {
+							clusters = append(clusters, *article.Cluster)
+						}
+					}
+					sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Size > clusters[j].Size })
+					return clusters, err
+				},
+			},
+			"tags": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					articles, err := articlesFrom(p.Context)
+					return distinct(articles, func(a models.NewsArticle) []string { return a.Tags }), err
+				},
+			},
+			"brief": &graphql.Field{
+				Type:        briefType,
+				Description: "The latest daily brief of a topic",
+				Args:        graphql.FieldConfigArgument{"topic": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					brief, err := datastore.GetBrief(p.Context, cache, p.Args["topic"].(string))
+					if errors.Is(err, datastore.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return map[string]any{"topic": brief.Topic, "generatedAt": brief.GeneratedAt, "articles": brief.Articles}, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// articleSetKey is the context key of the articles of a request, see WithArticles
+type articleSetKey struct{}
+
+// articleSet loads the cached articles once per request, however many fields need them
+type articleSet struct {
+	once     sync.Once
+	cache    datastore.Cache
+	articles []models.NewsArticle
+	err      error
+}
+
+// WithArticles returns a context resolving articles against the cache, it must be used for every query
+func WithArticles(ctx context.Context, cache datastore.Cache) context.Context {
+	return context.WithValue(ctx, articleSetKey{}, &articleSet{cache: cache})
+}
+
+func articlesFrom(ctx context.Context) ([]models.NewsArticle, error) {
+	set, ok := ctx.Value(articleSetKey{}).(*articleSet)
+	if !ok {
+		return nil, errors.New("no articles in context")
+	}
+	set.once.Do(func() {
+		set.articles, set.err = datastore.GetArticles(ctx, set.cache)
+		// the cache doesn't return articles in a stable order, and cursors need one
+		sort.Slice(set.articles, func(i, j int) bool { return set.articles[i].ID < set.articles[j].ID })
+	})
+	return set.articles, set.err
+}
+
+func findArticle(ctx context.Context, id string) (any, error) {
+	articles, err := articlesFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(articles, func(a models.NewsArticle) bool { return a.ID == id })
+	if i < 0 {
+		return nil, nil
+	}
+	return articles[i], nil
+}
+
+func articleField(get func(models.NewsArticle) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(models.NewsArticle)), nil
+	}
+}
+
+func clusterField(get func(models.Cluster) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(models.Cluster)), nil
+	}
+}
+
+// articleFilter returns the filter of the articles query arguments
+func articleFilter(args map[string]any) func(models.NewsArticle) bool {
+	return func(a models.NewsArticle) bool {
+		if topic, ok := args["topic"].(string); ok && !strings.EqualFold(a.Topic, topic) {
+			return false
+		}
+		if tags, ok := args["tags"].([]any); ok && len(tags) > 0 && !slices.ContainsFunc(tags, func(tag any) bool { return hasTag(tag.(string))(a) }) {
+			return false
+		}
+		if source, ok := args["source"].(string); ok && !strings.EqualFold(a.Source.Name, source) {
+			return false
+		}
+		if search, ok := args["search"].(string); ok {
+			text := strings.ToLower(a.Title + " " + a.Description)
+			for _, word := range strings.Fields(strings.ToLower(search)) {
+				if !strings.Contains(text, word) {
+					return false
+				}
+			}
+		}
+		if after, ok := args["publishedAfter"].(time.Time); ok {
+			published, err := time.Parse(time.RFC3339, a.PublishedAt)
+			if err != nil || !published.After(after) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func hasTag(tag string) func(models.NewsArticle) bool {
+	return func(a models.NewsArticle) bool {
+		return slices.ContainsFunc(a.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	}
+}
+
+func filterArticles(articles []models.NewsArticle, keep func(models.NewsArticle) bool) []models.NewsArticle {
+	var kept []models.NewsArticle
+	for _, article := range articles {
+		if keep(article) {
+			kept = append(kept, article)
+		}
+	}
+	return kept
+}
+
+// distinct returns the sorted distinct non-empty values of the articles
+func distinct(articles []models.NewsArticle, values func(models.NewsArticle) []string) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, article := range articles {
+		for _, value := range values(article) {
+			if value != "" && !seen[value] {
+				seen[value] = true
+				list = append(list, value)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// paginate returns the page of a connection selected by the "first" and "after" arguments. Cursors are opaque
+// offsets in the list.
+func paginate(articles []models.NewsArticle, args map[string]any) (map[string]any, error) {
+	first, _ := args["first"].(int)
+	if first < 0 || first > maxFirst {
+		return nil, fmt.Errorf("first must be between 0 and %d", maxFirst)
+	}
+	offset := 0
+	if after, ok := args["after"].(string); ok {
+		decoded, err := base64.RawURLEncoding.DecodeString(after)
+		if err == nil {
+			offset, err = strconv.Atoi(strings.TrimPrefix(string(decoded), "offset:"))
+		}
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid cursor %q", after)
+		}
+		offset++
+	}
+
+	edges := []map[string]any{}
+	end := min(offset+first, len(articles))
+	var endCursor any
+	for i := offset; i < end; i++ {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(i)))
+		edges = append(edges, map[string]any{"cursor": cursor, "node": articles[i]})
+		endCursor = cursor
+	}
+	return map[string]any{
+		"edges":      edges,
+		"totalCount": len(articles),
+		"pageInfo":   map[string]any{"hasNextPage": end < len(articles), "endCursor": endCursor},
+	}, nil
+}
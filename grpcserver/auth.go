@@ -0,0 +1,95 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Authenticator checks the API key of the calls to the news service, sent in the "authorization" metadata as a Bearer
+// token or in the "x-api-key" metadata, like the HTTP API does. Health checks and server reflection stay open.
+type Authenticator struct {
+	cache datastore.Cache
+}
+
+func NewAuthenticator(cache datastore.Cache) *Authenticator {
+	return &Authenticator{cache: cache}
+}
+
+// ServerOptions returns the interceptors to create the gRPC server with
+func (a *Authenticator) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.unary),
+		grpc.ChainStreamInterceptor(a.stream),
+	}
+}
+
+func (a *Authenticator) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *Authenticator) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// authenticate checks the API key of a call needing the read scope, counting it against the key quota
+func (a *Authenticator) authenticate(ctx context.Context, fullMethod string) error {
+	if strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") ||
+		strings.HasPrefix(fullMethod, "/grpc.reflection.") {
+		return nil
+	}
+
+	secret := metadataAPIKey(ctx)
+	if secret == "" {
+		return status.Error(codes.Unauthenticated, "missing API key, send it as a Bearer token in authorization or in x-api-key")
+	}
+	key, err := auth.Authenticate(ctx, a.cache, secret)
+	if errors.Is(err, auth.ErrInvalidKey) || errors.Is(err, auth.ErrRevokedKey) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to authenticate: %v", err)
+	}
+	if !auth.HasScope(key, auth.ScopeRead) {
+		return status.Errorf(codes.PermissionDenied, "API key is missing the %s scope", auth.ScopeRead)
+	}
+
+	usage, err := auth.UseQuota(ctx, a.cache, key, time.Now())
+	if errors.Is(err, auth.ErrQuotaExceeded) {
+		return status.Errorf(codes.ResourceExhausted, "daily quota of %d requests exceeded", usage.Limit)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to count call of api key", "api_key_id", key.ID, logging.Err(err))
+	}
+	return nil
+}
+
+func metadataAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		scheme, token, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return strings.TrimSpace(keys[0])
+	}
+	return ""
+}
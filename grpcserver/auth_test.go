@@ -0,0 +1,70 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/broker"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	newsv1 "devbriefs-news/proto/news/v1"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	seed(t, cache, models.NewsArticle{ID: "a1", Topic: "hacking"})
+	readKey, _, err := auth.Issue(ctx, cache, "team-a", "read", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limitedKey, _, err := auth.Issue(ctx, cache, "team-b", "limited", []string{auth.ScopeRead}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := startServer(t, cache, &fakeNewsAPI{}, broker.NewBroker(10, 10), NewAuthenticator(cache).ServerOptions()...)
+	client := newsv1.NewNewsServiceClient(conn)
+
+	tests := []struct {
+		name         string
+		md           metadata.MD
+		expectedCode codes.Code
+	}{
+		{name: "Bearer token", md: metadata.Pairs("authorization", "Bearer "+readKey), expectedCode: codes.OK},
+		{name: "x-api-key", md: metadata.Pairs("x-api-key", readKey), expectedCode: codes.OK},
+		{name: "Missing key", expectedCode: codes.Unauthenticated},
+		{name: "Unknown key", md: metadata.Pairs("x-api-key", "dbn_unknown"), expectedCode: codes.Unauthenticated},
+		{name: "Within quota", md: metadata.Pairs("x-api-key", limitedKey), expectedCode: codes.OK},
+		{name: "Over quota", md: metadata.Pairs("x-api-key", limitedKey), expectedCode: codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCtx := metadata.NewOutgoingContext(ctx, tt.md)
+			_, err := client.GetArticle(callCtx, &newsv1.GetArticleRequest{Id: "a1"})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Errorf("expected code %v, got %v (%v)", tt.expectedCode, code, err)
+			}
+		})
+	}
+
+	t.Run("Streams need a key", func(t *testing.T) {
+		stream, err := client.StreamArticles(ctx, &newsv1.StreamArticlesRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if code := status.Code(err); code != codes.Unauthenticated {
+			t.Errorf("expected code %v, got %v", codes.Unauthenticated, code)
+		}
+	})
+
+	t.Run("Health checks don't", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expected SERVING, got %v, %v", resp.GetStatus(), err)
+		}
+	})
+}
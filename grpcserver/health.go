@@ -0,0 +1,42 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/health"
+	newsv1 "devbriefs-news/proto/news/v1"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"log/slog"
+	"time"
+)
+
+// DefaultHealthInterval is how often the serving status of the gRPC health service is updated
+const DefaultHealthInterval = 15 * time.Second
+
+// ReportHealth updates the serving status of the gRPC health service, for the whole server and the news service, from
+// the same checks as the readiness probe: NOT_SERVING while a dependency failed, SERVING while they're all ok or
+// degraded. The checks run right away, then every interval until ctx is cancelled.
+func ReportHealth(ctx context.Context, server *grpchealth.Server, checker *health.Checker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report := checker.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		status := healthpb.HealthCheckResponse_SERVING
+		if report.Status == health.StatusFailed {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, service := range []string{"", newsv1.NewsService_ServiceDesc.ServiceName} {
+			server.SetServingStatus(service, status)
+		}
+		slog.DebugContext(ctx, "updated grpc serving status", "status", status.String(), "health", report.Status)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/health"
+	newsv1 "devbriefs-news/proto/news/v1"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReportHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var redisStatus atomic.Value
+	redisStatus.Store(health.StatusDegraded)
+	checker := health.NewChecker(time.Second)
+	checker.Register("redis", func(context.Context) health.Result {
+		return health.Result{Status: redisStatus.Load().(health.Status)}
+	})
+	server := grpchealth.NewServer()
+	go ReportHealth(ctx, server, checker, time.Millisecond)
+
+	tests := []struct {
+		name           string
+		redisStatus    health.Status
+		expectedStatus healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{name: "Dependency failed", redisStatus: health.StatusFailed, expectedStatus: healthpb.HealthCheckResponse_NOT_SERVING},
+		{name: "Dependency degraded", redisStatus: health.StatusDegraded, expectedStatus: healthpb.HealthCheckResponse_SERVING},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisStatus.Store(tt.redisStatus)
+			for _, service := range []string{"", newsv1.NewsService_ServiceDesc.ServiceName} {
+				deadline := time.Now().Add(5 * time.Second)
+				for {
+					resp, err := server.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+					if err == nil && resp.GetStatus() == tt.expectedStatus {
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("expected %q to be %v, got %v (%v)", service, tt.expectedStatus, resp.GetStatus(), err)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+		})
+	}
+}
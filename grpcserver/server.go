@@ -0,0 +1,238 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/api"
+	"devbriefs-news/broker"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	newsv1 "devbriefs-news/proto/news/v1"
+	"devbriefs-news/services"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// NewsServer implements the NewsService of proto/news/v1 over the same cache, news API and ingestion pipeline as the
+// HTTP handlers
+type NewsServer struct {
+	newsv1.UnimplementedNewsServiceServer
+
+	cache    datastore.Cache
+	newsAPI  api.NewsAPI
+	ingestor *services.Ingestor
+	broker   *broker.Broker
+}
+
+func NewNewsServer(cache datastore.Cache, newsAPI api.NewsAPI, ingestor *services.Ingestor, b *broker.Broker) *NewsServer {
+	return &NewsServer{
+		cache:    cache,
+		newsAPI:  newsAPI,
+		ingestor: ingestor,
+		broker:   b,
+	}
+}
+
+// NewGRPCServer returns a gRPC server serving news, along with the standard health service and server reflection so
+// tools like grpcurl can discover it. The health server is returned to report serving status changes.
+func NewGRPCServer(news *NewsServer, opts ...grpc.ServerOption) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(opts...)
+	newsv1.RegisterNewsServiceServer(server, news)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(newsv1.NewsService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server, healthServer
+}
+
+// ListArticles lists the cached articles matching the request, a page at a time. The page token is the offset of the
+// page, so pages sorted by score can shift as articles age.
+func (s *NewsServer) ListArticles(ctx context.Context, req *newsv1.ListArticlesRequest) (*newsv1.ListArticlesResponse, error) {
+	sortBy := req.GetSort()
+	if sortBy == "" {
+		sortBy = services.SortByPublishedAt
+	}
+	if sortBy != services.SortByScore && sortBy != services.SortByPublishedAt {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid sort %q, expected %q or %q", sortBy, services.SortByScore, services.SortByPublishedAt)
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+	offset, err := parsePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.GetRefresh() {
+		news, err := s.newsAPI.FetchEverythingHacking(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to fetch news: %v", err)
+		}
+		// stored even if the client cancels meanwhile, as the fetch was paid for
+		if _, err = s.ingestor.Ingest(context.WithoutCancel(ctx), news); err != nil {
+			slog.ErrorContext(ctx, "failed to store news data", logging.Err(err))
+		}
+	}
+
+	articles, err := datastore.GetArticles(ctx, s.cache)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get articles: %v", err)
+	}
+	filter := broker.Filter{Tags: req.GetTags()}
+	if req.GetTopic() != "" {
+		filter.Topics = []string{req.GetTopic()}
+	}
+	articles = slices.DeleteFunc(articles, func(article models.NewsArticle) bool { return !filter.Match(article) })
+	// the cache doesn't return articles in a stable order, and pages need one
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	articles = services.SortArticles(articles, sortBy, time.Now())
+
+	resp := &newsv1.ListArticlesResponse{}
+	if offset >= len(articles) {
+		return resp, nil
+	}
+	end := min(offset+pageSize, len(articles))
+	for _, article := range articles[offset:end] {
+		resp.Articles = append(resp.Articles, toArticle(article))
+	}
+	if end < len(articles) {
+		resp.NextPageToken = newPageToken(end)
+	}
+	return resp, nil
+}
+
+// GetArticle returns a cached article by ID
+func (s *NewsServer) GetArticle(ctx context.Context, req *newsv1.GetArticleRequest) (*newsv1.Article, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	article, err := datastore.GetArticle(ctx, s.cache, req.GetId())
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "article %s not found", req.GetId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get article: %v", err)
+	}
+	return toArticle(article), nil
+}
+
+// StreamArticles streams the articles published by the broker, first replaying the ones missed since last_event_id.
+// A stream that doesn't keep up is ended with ResourceExhausted, and can be resumed with the last event ID it got.
+func (s *NewsServer) StreamArticles(req *newsv1.StreamArticlesRequest, stream grpc.ServerStreamingServer[newsv1.ArticleEvent]) error {
+	sub, missed := s.broker.Subscribe(broker.Filter{Topics: req.GetTopics(), Tags: req.GetTags()}, req.GetLastEventId())
+	defer sub.Close()
+
+	for _, event := range missed {
+		if err := stream.Send(toArticleEvent(event)); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "slow consumer, resume with last_event_id")
+			}
+			if err := stream.Send(toArticleEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetBrief returns the latest daily brief of a topic
+func (s *NewsServer) GetBrief(ctx context.Context, req *newsv1.GetBriefRequest) (*newsv1.Brief, error) {
+	if req.GetTopic() == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+	brief, err := datastore.GetBrief(ctx, s.cache, req.GetTopic())
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no brief for topic %s yet", req.GetTopic())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get brief: %v", err)
+	}
+
+	resp := &newsv1.Brief{
+		Topic:       brief.Topic,
+		GeneratedAt: timestamppb.New(brief.GeneratedAt),
+	}
+	for _, article := range brief.Articles {
+		resp.Articles = append(resp.Articles, toArticle(article))
+	}
+	return resp, nil
+}
+
+func toArticle(article models.NewsArticle) *newsv1.Article {
+	msg := &newsv1.Article{
+		Id:          article.ID,
+		Title:       article.Title,
+		Url:         article.URL,
+		Description: article.Description,
+		Source:      &newsv1.Source{Id: article.Source.ID, Name: article.Source.Name},
+		Topic:       article.Topic,
+		Tags:        article.Tags,
+		Score:       article.Score,
+	}
+	if published, err := time.Parse(time.RFC3339, article.PublishedAt); err == nil {
+		msg.PublishedAt = timestamppb.New(published)
+	}
+	if article.Cluster != nil {
+		msg.Cluster = &newsv1.Cluster{
+			Id:      article.Cluster.ID,
+			Size:    int32(article.Cluster.Size),
+			Outlets: article.Cluster.Outlets,
+		}
+	}
+	return msg
+}
+
+func toArticleEvent(event broker.Event) *newsv1.ArticleEvent {
+	return &newsv1.ArticleEvent{
+		EventId: event.ID,
+		Article: toArticle(event.Article),
+	}
+}
+
+func newPageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func parsePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page token %q", token)
+	}
+	offset, err := strconv.Atoi(string(decoded))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page token %q", token)
+	}
+	return offset, nil
+}
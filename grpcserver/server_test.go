@@ -0,0 +1,192 @@
+package grpcserver
+
+import (
+	"context"
+	"devbriefs-news/broker"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	newsv1 "devbriefs-news/proto/news/v1"
+	"devbriefs-news/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeNewsAPI struct {
+	news map[string]models.NewsArticle
+}
+
+func (f *fakeNewsAPI) FetchEverythingHacking(context.Context) (map[string]models.NewsArticle, error) {
+	return f.news, nil
+}
+
+// startServer serves news over an in-memory listener and returns a connected client
+func startServer(t *testing.T, cache datastore.Cache, newsAPI *fakeNewsAPI, b *broker.Broker, opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server, _ := NewGRPCServer(NewNewsServer(cache, newsAPI, services.NewIngestor(cache), b), opts...)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func seed(t *testing.T, cache datastore.Cache, articles ...models.NewsArticle) {
+	t.Helper()
+	for _, article := range articles {
+		if err := datastore.SetArticle(context.Background(), cache, article); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListArticles(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	seed(t, cache,
+		models.NewsArticle{ID: "a1", Topic: "hacking", PublishedAt: "2024-05-01T10:00:00Z", Tags: []string{"breach"}},
+		models.NewsArticle{ID: "a2", Topic: "hacking", PublishedAt: "2024-05-03T10:00:00Z"},
+		models.NewsArticle{ID: "a3", Topic: "hacking", PublishedAt: "2024-05-02T10:00:00Z", Tags: []string{"breach"}},
+		models.NewsArticle{ID: "a4", Topic: "linux", PublishedAt: "2024-05-04T10:00:00Z"},
+	)
+	newsAPI := &fakeNewsAPI{news: map[string]models.NewsArticle{
+		"a5": {ID: "a5", Topic: "hacking", PublishedAt: "2024-05-05T10:00:00Z"},
+	}}
+	client := newsv1.NewNewsServiceClient(startServer(t, cache, newsAPI, broker.NewBroker(10, 10)))
+
+	tests := []struct {
+		name         string
+		req          *newsv1.ListArticlesRequest
+		expectedIDs  []string
+		expectedMore bool
+		expectedErr  codes.Code
+	}{
+		{name: "Topic", req: &newsv1.ListArticlesRequest{Topic: "hacking"}, expectedIDs: []string{"a2", "a3", "a1"}},
+		{name: "Tags", req: &newsv1.ListArticlesRequest{Topic: "hacking", Tags: []string{"breach"}}, expectedIDs: []string{"a3", "a1"}},
+		{name: "First page", req: &newsv1.ListArticlesRequest{Topic: "hacking", PageSize: 2}, expectedIDs: []string{"a2", "a3"}, expectedMore: true},
+		{name: "Last page", req: &newsv1.ListArticlesRequest{Topic: "hacking", PageSize: 2, PageToken: newPageToken(2)}, expectedIDs: []string{"a1"}},
+		{name: "Invalid sort", req: &newsv1.ListArticlesRequest{Sort: "title"}, expectedErr: codes.InvalidArgument},
+		{name: "Invalid page token", req: &newsv1.ListArticlesRequest{PageToken: "!"}, expectedErr: codes.InvalidArgument},
+		// must run last, as it ingests a5
+		{name: "Refresh", req: &newsv1.ListArticlesRequest{Topic: "hacking", PageSize: 1, Refresh: true}, expectedIDs: []string{"a5"}, expectedMore: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.ListArticles(context.Background(), tt.req)
+			if status.Code(err) != tt.expectedErr {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, article := range resp.GetArticles() {
+				ids = append(ids, article.GetId())
+			}
+			if len(ids) != len(tt.expectedIDs) {
+				t.Fatalf("expected %v, got %v", tt.expectedIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expectedIDs[i] {
+					t.Errorf("expected %v, got %v", tt.expectedIDs, ids)
+				}
+			}
+			if hasMore := resp.GetNextPageToken() != ""; hasMore != tt.expectedMore {
+				t.Errorf("unexpected next page token %q", resp.GetNextPageToken())
+			}
+		})
+	}
+}
+
+func TestGetArticleAndBrief(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	seed(t, cache, models.NewsArticle{ID: "a1", Title: "Okta breach", PublishedAt: "2024-05-01T10:00:00Z",
+		Cluster: &models.Cluster{ID: "a1", Size: 2, Outlets: []string{"A", "B"}}})
+	generatedAt := time.Date(2024, 5, 2, 6, 0, 0, 0, time.UTC)
+	if err := datastore.SetBrief(context.Background(), cache, models.Brief{Topic: "hacking", GeneratedAt: generatedAt,
+		Articles: []models.NewsArticle{{ID: "a1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	client := newsv1.NewNewsServiceClient(startServer(t, cache, &fakeNewsAPI{}, broker.NewBroker(10, 10)))
+
+	article, err := client.GetArticle(context.Background(), &newsv1.GetArticleRequest{Id: "a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.GetTitle() != "Okta breach" || article.GetCluster().GetSize() != 2 {
+		t.Errorf("expected the cached article, got %v", article)
+	}
+	if !article.GetPublishedAt().AsTime().Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the publication date, got %v", article.GetPublishedAt())
+	}
+	if _, err = client.GetArticle(context.Background(), &newsv1.GetArticleRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	brief, err := client.GetBrief(context.Background(), &newsv1.GetBriefRequest{Topic: "hacking"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !brief.GetGeneratedAt().AsTime().Equal(generatedAt) || len(brief.GetArticles()) != 1 {
+		t.Errorf("expected the cached brief, got %v", brief)
+	}
+	if _, err = client.GetBrief(context.Background(), &newsv1.GetBriefRequest{Topic: "linux"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+func TestStreamArticles(t *testing.T) {
+	b := broker.NewBroker(10, 10)
+	b.Publish([]models.NewsArticle{{ID: "a1", Topic: "hacking"}, {ID: "a2", Topic: "hacking"}})
+	conn := startServer(t, datastore.NewMemoryCache(), &fakeNewsAPI{}, b)
+	client := newsv1.NewNewsServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.StreamArticles(ctx, &newsv1.StreamArticlesRequest{Topics: []string{"hacking"}, LastEventId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.GetEventId() != 2 || event.GetArticle().GetId() != "a2" {
+		t.Errorf("expected a2 to be replayed, got %v", event)
+	}
+
+	// wait for the server to subscribe before publishing
+	for b.Subscribers() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	b.Publish([]models.NewsArticle{{ID: "a3", Topic: "linux"}, {ID: "a4", Topic: "hacking"}})
+	if event, err = stream.Recv(); err != nil || event.GetArticle().GetId() != "a4" {
+		t.Errorf("expected a4 to be streamed, got %v (%v)", event, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	conn := startServer(t, datastore.NewMemoryCache(), &fakeNewsAPI{}, broker.NewBroker(10, 10))
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: newsv1.NewsService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %v", resp.GetStatus())
+	}
+}
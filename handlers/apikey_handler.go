@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// apiKeyUsage is an API key as listed to admins, along with the requests it made today
+type apiKeyUsage struct {
+	models.APIKey
+	UsedToday int64 `json:"usedToday"`
+}
+
+// ListAPIKeys writes every API key, revoked ones included, without their hashes
+func ListAPIKeys(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	keys, err := datastore.GetAPIKeys(r.Context(), cache)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	listed := make([]apiKeyUsage, 0, len(keys))
+	for _, key := range keys {
+		used, err := datastore.GetQuotaUsage(r.Context(), cache, key.ID, now)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key.Hash = ""
+		listed = append(listed, apiKeyUsage{APIKey: key, UsedToday: used})
+	}
+	writeJSON(w, r, http.StatusOK, listed)
+}
+
+// RevokeAPIKey revokes an API key by ID, writing the revoked key
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	key, err := auth.Revoke(r.Context(), cache, id)
+	if errors.Is(err, datastore.ErrNotFound) {
+		writeError(w, r, fmt.Sprintf("api key %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key.Hash = ""
+	writeJSON(w, r, http.StatusOK, key)
+}
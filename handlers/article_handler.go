@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"devbriefs-news/datastore"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// GetArticle writes a cached article by ID
+func GetArticle(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	article, err := datastore.GetArticle(r.Context(), cache, id)
+	if errors.Is(err, datastore.ErrNotFound) {
+		writeError(w, r, fmt.Sprintf("article %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, article)
+}
+
+// GetBrief writes the latest daily brief of a topic
+func GetBrief(w http.ResponseWriter, r *http.Request, topic string, cache datastore.Cache) {
+	brief, err := datastore.GetBrief(r.Context(), cache, topic)
+	if errors.Is(err, datastore.ErrNotFound) {
+		writeError(w, r, fmt.Sprintf("no brief for topic %s yet", topic), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, brief)
+}
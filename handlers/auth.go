@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyHeader carries the API key of a request, when not sent as an Authorization: Bearer token
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyCtxKey is the context key of the API key a request was authenticated with, see RequireAPIKey
+type apiKeyCtxKey struct{}
+
+// RequireAPIKey authenticates the requests of a route group with an API key, sent as an Authorization: Bearer token or
+// in the X-API-Key header, which must have the given scope. Each request counts against the daily quota of the key,
+// requests over it get 429 Too Many Requests until the quota resets at UTC midnight. Requests with a missing or invalid
+// key are rate limited per client IP by failureLimit, unless it's nil.
+func RequireAPIKey(cache datastore.Cache, scope string, failureLimit *AuthFailureLimit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := c.Request
+		secret := requestAPIKey(r)
+		if secret == "" {
+			if failureLimit != nil && !allow(c, failureLimit.Limiter, failureLimit.Limit, "ip:"+c.ClientIP()) {
+				c.Abort()
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="devbriefs-news"`)
+			writeError(c.Writer, r, fmt.Sprintf("missing API key, send it as a Bearer token or in the %s header", apiKeyHeader), http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+
+		key, err := auth.Authenticate(r.Context(), cache, secret)
+		if errors.Is(err, auth.ErrInvalidKey) || errors.Is(err, auth.ErrRevokedKey) {
+			if failureLimit != nil && !allow(c, failureLimit.Limiter, failureLimit.Limit, "ip:"+c.ClientIP()) {
+				c.Abort()
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="devbriefs-news", error="invalid_token"`)
+			writeError(c.Writer, r, err.Error(), http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			writeError(c.Writer, r, err.Error(), http.StatusInternalServerError)
+			c.Abort()
+			return
+		}
+		if !auth.HasScope(key, scope) {
+			writeError(c.Writer, r, fmt.Sprintf("API key is missing the %s scope", scope), http.StatusForbidden)
+			c.Abort()
+			return
+		}
+
+		now := time.Now()
+		usage, err := auth.UseQuota(r.Context(), cache, key, now)
+		if err != nil && !errors.Is(err, auth.ErrQuotaExceeded) {
+			// the quota store being down shouldn't take the API down with it
+			slog.ErrorContext(r.Context(), "failed to count request of api key", "api_key_id", key.ID, logging.Err(err))
+		}
+		if usage.Limit > 0 {
+			c.Header("X-Quota-Limit", strconv.FormatInt(usage.Limit, 10))
+			c.Header("X-Quota-Remaining", strconv.FormatInt(usage.Remaining, 10))
+			c.Header("X-Quota-Reset", strconv.FormatInt(usage.Reset.Unix(), 10))
+		}
+		if errors.Is(err, auth.ErrQuotaExceeded) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(usage.Reset.Sub(now).Seconds()))))
+			writeError(c.Writer, r, fmt.Sprintf("daily quota of %d requests exceeded", usage.Limit), http.StatusTooManyRequests)
+			c.Abort()
+			return
+		}
+
+		c.Request = withAPIKey(r, key)
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the API key sent with a request, empty when there is none
+func requestAPIKey(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get(apiKeyHeader))
+}
+
+func withAPIKey(r *http.Request, key models.APIKey) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey{}, key))
+}
+
+// authenticatedKey returns the API key a request was authenticated with by RequireAPIKey
+func authenticatedKey(r *http.Request) (models.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyCtxKey{}).(models.APIKey)
+	return key, ok
+}
+
+// clientID returns the API client making the request, the owner of the API key it was authenticated with, empty when
+// the request wasn't authenticated
+func clientID(r *http.Request) string {
+	key, _ := authenticatedKey(r)
+	return key.ClientID
+}
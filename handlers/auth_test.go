@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	readKey, _, err := auth.Issue(ctx, cache, "team-a", "read", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminKey, _, err := auth.Issue(ctx, cache, "ops", "admin", []string{auth.ScopeAdmin}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limitedKey, _, err := auth.Issue(ctx, cache, "team-b", "limited", []string{auth.ScopeRead}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, revoked, err := auth.Issue(ctx, cache, "team-c", "revoked", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Revoke(ctx, cache, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/read", RequireAPIKey(cache, auth.ScopeRead, nil), func(c *gin.Context) {
+		c.String(http.StatusOK, clientID(c.Request))
+	})
+	engine.GET("/admin", RequireAPIKey(cache, auth.ScopeAdmin, nil), func(c *gin.Context) {
+		c.String(http.StatusOK, clientID(c.Request))
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string
+		value          string
+		expectedStatus int
+		expectedClient string
+	}{
+		{name: "Bearer token", path: "/read", header: "Authorization", value: "Bearer " + readKey, expectedStatus: http.StatusOK, expectedClient: "team-a"},
+		{name: "X-API-Key header", path: "/read", header: apiKeyHeader, value: readKey, expectedStatus: http.StatusOK, expectedClient: "team-a"},
+		{name: "Missing key", path: "/read", expectedStatus: http.StatusUnauthorized},
+		{name: "Basic auth isn't a key", path: "/read", header: "Authorization", value: "Basic dXNlcjpwYXNz", expectedStatus: http.StatusUnauthorized},
+		{name: "Unknown key", path: "/read", header: apiKeyHeader, value: "dbn_unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "Revoked key", path: "/read", header: apiKeyHeader, value: revokedKey, expectedStatus: http.StatusUnauthorized},
+		{name: "Read key on admin route", path: "/admin", header: apiKeyHeader, value: readKey, expectedStatus: http.StatusForbidden},
+		{name: "Admin key on admin route", path: "/admin", header: apiKeyHeader, value: adminKey, expectedStatus: http.StatusOK, expectedClient: "ops"},
+		{name: "Admin key reads", path: "/read", header: apiKeyHeader, value: adminKey, expectedStatus: http.StatusOK, expectedClient: "ops"},
+		{name: "Within quota", path: "/read", header: apiKeyHeader, value: limitedKey, expectedStatus: http.StatusOK, expectedClient: "team-b"},
+		{name: "Over quota", path: "/read", header: apiKeyHeader, value: limitedKey, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+
+			engine.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Body.String() != tt.expectedClient {
+				t.Errorf("expected client %s, got %s", tt.expectedClient, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header")
+			}
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				if rr.Header().Get("Retry-After") == "" || rr.Header().Get("X-Quota-Remaining") != "0" {
+					t.Errorf("expected Retry-After and no quota remaining, got %v", rr.Header())
+				}
+			}
+		})
+	}
+}
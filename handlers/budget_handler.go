@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"devbriefs-news/services"
+	"net/http"
+)
+
+// GetUpstreamBudgets writes how much of its daily budget each upstream provider used
+func GetUpstreamBudgets(w http.ResponseWriter, r *http.Request, accountant *services.QuotaAccountant) {
+	statuses, err := accountant.Status(r.Context())
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, statuses)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/openapi"
+	"devbriefs-news/services"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contractNewsAPI returns the same news on every fetch
+type contractNewsAPI struct{}
+
+func (contractNewsAPI) FetchEverythingHacking(context.Context) (map[string]models.NewsArticle, error) {
+	return map[string]models.NewsArticle{
+		"a1": {ID: "a1", Title: "Okta breach exposes sessions", URL: "https://example.com/okta", Topic: "hacking",
+			PublishedAt: "2024-05-01T10:00:00Z", Source: models.NewsSource{Name: "Example"}, Tags: []string{"breach"},
+			Cluster: &models.Cluster{ID: "a1", Size: 2, Outlets: []string{"Example", "Other"}}},
+	}, nil
+}
+
+// loadSpec loads and validates the OpenAPI document
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	if err != nil {
+		t.Fatalf("failed to load openapi.json: %v", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+	return doc
+}
+
+func newV1Engine(cache datastore.Cache) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	RegisterV1(engine.Group("/api/v1", V1(), RequireAPIKey(cache, auth.ScopeRead, nil)), Dependencies{
+		Cache:     cache,
+		NewsAPI:   contractNewsAPI{},
+		Ingestor:  services.NewIngestor(cache),
+		Confirmer: &recordingConfirmer{},
+	})
+	return engine
+}
+
+// TestOpenAPIRoutes fails when a /api/v1 route isn't documented, or a documented operation isn't routed
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	ginParam := regexp.MustCompile(`:(\w+)`)
+
+	var routed []string
+	for _, route := range newV1Engine(datastore.NewMemoryCache()).Routes() {
+		routed = append(routed, route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+	var documented []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+	sort.Strings(routed)
+	sort.Strings(documented)
+
+	if strings.Join(routed, "\n") != strings.Join(documented, "\n") {
+		t.Errorf("routes and openapi.json differ\nrouted:\n%s\ndocumented:\n%s", strings.Join(routed, "\n"), strings.Join(documented, "\n"))
+	}
+}
+
+// TestOpenAPIContract runs a request against each documented response of each operation, and validates both the
+// request and the response against the spec
+func TestOpenAPIContract(t *testing.T) {
+	doc := loadSpec(t)
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := datastore.NewMemoryCache()
+	ctx := context.Background()
+	article := models.NewsArticle{ID: "a2", Title: "LockBit ransomware returns", URL: "https://example.com/lockbit",
+		Description: "Again", PublishedAt: "2024-05-02T10:00:00Z", Source: models.NewsSource{ID: "example", Name: "Example"}}
+	if err = datastore.SetArticle(ctx, cache, article); err != nil {
+		t.Fatal(err)
+	}
+	brief := services.BuildBrief("hacking", []models.NewsArticle{article}, time.Now())
+	if err = datastore.SetBrief(ctx, cache, brief); err != nil {
+		t.Fatal(err)
+	}
+	engine := newV1Engine(cache)
+	apiKey, _, err := auth.Issue(ctx, cache, "team-a", "contract", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limitedKey, _, err := auth.Issue(ctx, cache, "team-a", "limited", []string{auth.ScopeRead}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the IDs of the resources created along the way, substituted in the paths of the following steps
+	ids := map[string]string{}
+	steps := []struct {
+		method         string
+		path           string
+		body           string
+		apiKey         string
+		expectedStatus int
+		saveID         string
+	}{
+		{method: http.MethodGet, path: "/api/v1/news", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/news", apiKey: "none", expectedStatus: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/v1/news", apiKey: limitedKey, expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/news", apiKey: limitedKey, expectedStatus: http.StatusTooManyRequests},
+		{method: http.MethodGet, path: "/api/v1/news?sort=score", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/news?sort=title", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/v1/articles/a2", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/articles/missing", expectedStatus: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v1/briefs/hacking", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/briefs/linux", expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/v1/watchlists", body: `{"name":"Suppliers","vendors":["Okta"]}`, expectedStatus: http.StatusCreated, saveID: "watchlist"},
+		{method: http.MethodPost, path: "/api/v1/watchlists", body: `{"name":"Suppliers"}`, expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/v1/watchlists", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/watchlists/{watchlist}", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/watchlists/{watchlist}/news", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/watchlists/{watchlist}/news?sort=title", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/v1/webhooks", body: `{"url":"https://example.com/hook","filter":{"tags":["breach"]}}`, expectedStatus: http.StatusCreated, saveID: "webhook"},
+		{method: http.MethodPost, path: "/api/v1/webhooks", body: `{"url":"ftp://example.com"}`, expectedStatus: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/v1/webhooks", body: `{"url":"http://169.254.169.254/latest/meta-data"}`, expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/v1/webhooks", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/webhooks/{webhook}/deliveries", expectedStatus: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/webhooks/{webhook}", expectedStatus: http.StatusNoContent},
+		{method: http.MethodGet, path: "/api/v1/webhooks/{webhook}/deliveries", expectedStatus: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/api/v1/webhooks/{webhook}", expectedStatus: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/api/v1/watchlists/{watchlist}", expectedStatus: http.StatusNoContent},
+		{method: http.MethodGet, path: "/api/v1/watchlists/{watchlist}", expectedStatus: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/api/v1/watchlists/{watchlist}", expectedStatus: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v1/watchlists/{watchlist}/news", expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/v1/subscribers", body: `{"email":"me@example.com","topics":["hacking"]}`, expectedStatus: http.StatusAccepted},
+		{method: http.MethodPost, path: "/api/v1/subscribers", body: `{"email":"me@example.com","topics":[],"token":"guess"}`, expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/v1/subscribers", body: `{"email":"me@example.com","topics":["made-up"]}`, expectedStatus: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/v1/subscribers", body: `{"email":"nope"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	exercised := make(map[string]bool)
+	for _, step := range steps {
+		path := step.path
+		for name, id := range ids {
+			path = strings.ReplaceAll(path, "{"+name+"}", id)
+		}
+		t.Run(step.method+" "+path, func(t *testing.T) {
+			req := httptest.NewRequest(step.method, "http://localhost:8080"+path, strings.NewReader(step.body))
+			switch step.apiKey {
+			case "":
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+			case "none":
+				// anonymous
+			default:
+				req.Header.Set(apiKeyHeader, step.apiKey)
+			}
+			if step.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				t.Fatalf("no documented operation: %v", err)
+			}
+			exercised[route.Method+" "+route.Path] = true
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+					IncludeResponseStatus: true,
+				},
+			}
+			// only valid requests must pass, invalid ones are how we get 400s
+			if err = openapi3filter.ValidateRequest(context.Background(), input); err != nil && step.expectedStatus != http.StatusBadRequest {
+				t.Errorf("request doesn't match the spec: %v", err)
+			}
+			req.Body = io.NopCloser(strings.NewReader(step.body))
+
+			rr := httptest.NewRecorder()
+			engine.ServeHTTP(rr, req)
+
+			if rr.Code != step.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, step.expectedStatus, rr.Body.String())
+			}
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 rr.Code,
+				Header:                 rr.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+			})
+			if err != nil {
+				t.Errorf("response doesn't match the spec: %v", err)
+			}
+
+			if step.saveID != "" {
+				var created struct {
+					Data struct {
+						ID string `json:"id"`
+					} `json:"data"`
+				}
+				if err = json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.Data.ID == "" {
+					t.Fatalf("expected the created resource in data, got %s", rr.Body.String())
+				}
+				ids[step.saveID] = created.Data.ID
+			}
+		})
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !exercised[method+" "+path] {
+				t.Errorf("%s %s isn't covered by the contract test", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"devbriefs-news/datastore"
+	"devbriefs-news/feeds"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// feedSize is the number of articles in a feed, newest first
+const feedSize = 50
+
+// GetTopicFeed writes the cached articles of a topic as an RSS 2.0, Atom 1.0 or JSON Feed 1.1 feed
+func GetTopicFeed(w http.ResponseWriter, r *http.Request, topic, format string, cache datastore.Cache) {
+	articles, err := datastore.GetArticles(r.Context(), cache)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var topicArticles []models.NewsArticle
+	for _, article := range articles {
+		if article.Topic == topic {
+			topicArticles = append(topicArticles, article)
+		}
+	}
+	changed, err := lastChanged(r.Context(), cache, topicArticles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeFeed(w, r, format, "public", changed, feeds.Feed{
+		ID:          "urn:devbriefs:topic:" + topic,
+		Title:       "DevBriefs - " + topic,
+		Description: fmt.Sprintf("Curated %s news", topic),
+		HomeURL:     requestBaseURL(r) + "/api/everything-hacking-news",
+		FeedURL:     requestBaseURL(r) + r.URL.Path,
+	}, topicArticles)
+}
+
+// GetWatchlistFeed writes the cached articles mentioning an entity of the watchlist as an RSS 2.0, Atom 1.0 or JSON
+// Feed 1.1 feed
+func GetWatchlistFeed(w http.ResponseWriter, r *http.Request, id, format string, cache datastore.Cache) {
+	watchlist, ok := ownedWatchlist(w, r, id, cache)
+	if !ok {
+		return
+	}
+	articles, err := datastore.GetArticles(r.Context(), cache)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	articles = services.FilterWatchlist(watchlist, articles)
+	changed, err := lastChanged(r.Context(), cache, articles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the feed also changes when the watchlist does, which is only ever created
+	if changed.Before(watchlist.CreatedAt) {
+		changed = watchlist.CreatedAt
+	}
+
+	// the feed is only served with the API key of its owner, so shared caches must not keep it
+	writeFeed(w, r, format, "private", changed, feeds.Feed{
+		ID:          "urn:devbriefs:watchlist:" + watchlist.ID,
+		Title:       "DevBriefs - " + watchlist.Name,
+		Description: fmt.Sprintf("News mentioning the entities of the %s watchlist", watchlist.Name),
+		HomeURL:     requestBaseURL(r) + "/api/watchlists/" + watchlist.ID + "/news",
+		FeedURL:     requestBaseURL(r) + r.URL.Path,
+	}, articles)
+}
+
+// lastChanged returns the last time articles were added to the topics of the articles of a feed, the zero time when
+// it was never recorded
+func lastChanged(ctx context.Context, cache datastore.Cache, articles []models.NewsArticle) (time.Time, error) {
+	var changed time.Time
+	seen := make(map[string]bool)
+	for _, article := range articles {
+		if seen[article.Topic] {
+			continue
+		}
+		seen[article.Topic] = true
+		at, err := datastore.GetTopicChanged(ctx, cache, article.Topic)
+		if errors.Is(err, datastore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if at.After(changed) {
+			changed = at
+		}
+	}
+	return changed, nil
+}
+
+// writeFeed renders the newest articles of a feed and serves it with an ETag and the time its articles last changed as
+// Last-Modified, answering conditional GETs with 304 Not Modified. That's when articles were last added rather than
+// the date of the newest one, which an article published earlier, e.g. backfilled, changes the feed without changing.
+// cacheControl is "public" or "private".
+func writeFeed(w http.ResponseWriter, r *http.Request, format, cacheControl string, changed time.Time, feed feeds.Feed, articles []models.NewsArticle) {
+	contentType, ok := feeds.ContentTypes[format]
+	if !ok {
+		http.Error(w, (&feeds.UnknownFormatError{Format: format}).Error(), http.StatusNotFound)
+		return
+	}
+
+	articles = services.SortArticles(articles, services.SortByPublishedAt, time.Now())
+	if len(articles) > feedSize {
+		articles = articles[:feedSize]
+	}
+	feed.Articles = articles
+	// the feed is as recent as its newest article, so it only changes when articles do
+	feed.Updated = time.Unix(0, 0).UTC()
+	if len(articles) > 0 {
+		if newest, err := time.Parse(time.RFC3339, articles[0].PublishedAt); err == nil {
+			feed.Updated = newest.UTC()
+		}
+	}
+
+	body, err := feeds.Render(feed, format)
+	var unknownFormat *feeds.UnknownFormatError
+	if errors.As(err, &unknownFormat) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", cacheControl+", max-age=300")
+	// ServeContent answers If-None-Match and If-Modified-Since for us, and leaves out Last-Modified for the zero time
+	http.ServeContent(w, r, "", changed, bytes.NewReader(body))
+}
+
+// requestBaseURL returns the scheme and host the request was made to, honoring the scheme set by our proxy
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
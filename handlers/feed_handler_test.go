@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetTopicFeed(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	for _, article := range []models.NewsArticle{
+		{ID: "a1", Title: "Okta breach", Topic: "hacking", PublishedAt: "2024-05-02T10:00:00Z"},
+		{ID: "a2", Title: "Kernel release", Topic: "linux", PublishedAt: "2024-05-03T10:00:00Z"},
+	} {
+		if err := datastore.SetArticle(context.Background(), cache, article); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		format         string
+		expectedStatus int
+		expectedType   string
+	}{
+		{name: "RSS", format: "rss", expectedStatus: http.StatusOK, expectedType: "application/rss+xml; charset=utf-8"},
+		{name: "Atom", format: "atom", expectedStatus: http.StatusOK, expectedType: "application/atom+xml; charset=utf-8"},
+		{name: "JSON Feed", format: "json", expectedStatus: http.StatusOK, expectedType: "application/feed+json; charset=utf-8"},
+		{name: "Unknown format", format: "opml", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/feeds/hacking/"+tt.format, nil)
+			rr := httptest.NewRecorder()
+
+			GetTopicFeed(rr, req, "hacking", tt.format, cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedType {
+				t.Errorf("expected content type %q, got %q", tt.expectedType, got)
+			}
+			if !strings.Contains(rr.Body.String(), "urn:devbriefs:article:a1") {
+				t.Errorf("expected the hacking article in the feed, got %s", rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "urn:devbriefs:article:a2") {
+				t.Errorf("expected the linux article to be left out, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTopicFeedConditional(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	article := models.NewsArticle{ID: "a1", Title: "Okta breach", Topic: "hacking", PublishedAt: "2024-05-02T10:00:00Z"}
+	if err := datastore.SetArticle(context.Background(), cache, article); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.SetTopicChanged(context.Background(), cache, "hacking", time.Date(2024, 5, 2, 10, 5, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	GetTopicFeed(rr, httptest.NewRequest(http.MethodGet, "/api/feeds/hacking/atom", nil), "hacking", "atom", cache)
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	if lastModified := rr.Header().Get("Last-Modified"); lastModified != "Thu, 02 May 2024 10:05:00 GMT" {
+		t.Errorf("expected Last-Modified to be when the topic last changed, got %q", lastModified)
+	}
+	if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "public, max-age=300" {
+		t.Errorf("expected a public feed, got %q", cacheControl)
+	}
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		backfill       bool
+		expectedStatus int
+	}{
+		{name: "Matching ETag", header: "If-None-Match", value: etag, expectedStatus: http.StatusNotModified},
+		{name: "Stale ETag", header: "If-None-Match", value: `"stale"`, expectedStatus: http.StatusOK},
+		{name: "Not modified since", header: "If-Modified-Since", value: "Thu, 02 May 2024 10:05:00 GMT", expectedStatus: http.StatusNotModified},
+		{name: "Modified since", header: "If-Modified-Since", value: "Thu, 02 May 2024 10:00:00 GMT", expectedStatus: http.StatusOK},
+		// an older article changes the feed but not the date of its newest article
+		{name: "ETag after a backfill", header: "If-None-Match", value: etag, backfill: true, expectedStatus: http.StatusOK},
+		{name: "If-Modified-Since after a backfill", header: "If-Modified-Since", value: "Thu, 02 May 2024 10:05:00 GMT", backfill: true, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.backfill {
+				backfilled := models.NewsArticle{ID: "a0", Title: "Older breach", Topic: "hacking", PublishedAt: "2024-05-01T10:00:00Z"}
+				if _, err := services.AddNewsToCache(context.Background(), cache, map[string]models.NewsArticle{"a0": backfilled}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/feeds/hacking/atom", nil)
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+
+			GetTopicFeed(rr, req, "hacking", "atom", cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestGetWatchlistFeed(t *testing.T) {
+	cache := datastore.NewMemoryCache()
+	ctx := context.Background()
+	watchlist := models.Watchlist{ID: "w1", ClientID: "team-a", Name: "Suppliers", Vendors: []string{"Okta"}, CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	if err := datastore.SetWatchlist(ctx, cache, watchlist); err != nil {
+		t.Fatal(err)
+	}
+	for _, article := range []models.NewsArticle{
+		{ID: "a1", Title: "Okta breach", PublishedAt: "2024-05-02T10:00:00Z"},
+		{ID: "a2", Title: "Kernel release", PublishedAt: "2024-05-03T10:00:00Z"},
+	} {
+		if err := datastore.SetArticle(ctx, cache, article); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		clientID       string
+		expectedStatus int
+	}{
+		{name: "Owner", clientID: "team-a", expectedStatus: http.StatusOK},
+		{name: "Other client", clientID: "team-b", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/watchlists/w1/feed/json", nil)
+			req = withAPIKey(req, models.APIKey{ClientID: tt.clientID})
+			rr := httptest.NewRecorder()
+
+			GetWatchlistFeed(rr, req, "w1", "json", cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if strings.Contains(rr.Body.String(), "urn:devbriefs:article:a2") {
+				t.Errorf("expected only articles mentioning the watchlist, got %s", rr.Body.String())
+			}
+			if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "private, max-age=300" {
+				t.Errorf("expected a private feed, got %q", cacheControl)
+			}
+			if lastModified := rr.Header().Get("Last-Modified"); lastModified != "Wed, 01 May 2024 00:00:00 GMT" {
+				t.Errorf("expected Last-Modified to be when the watchlist was created, got %q", lastModified)
+			}
+		})
+	}
+}
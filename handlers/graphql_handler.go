@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"devbriefs-news/graphqlapi"
+	"encoding/json"
+	"net/http"
+)
+
+// maxGraphQLBody is the largest GraphQL request body we accept, queries are small
+const maxGraphQLBody = 64 << 10
+
+// GraphQL runs a GraphQL request, either POSTed as JSON or sent as the "query", "operationName" and "variables" query
+// parameters of a GET. Query errors are reported in the "errors" of the 200 response, as GraphQL clients expect.
+func GraphQL(w http.ResponseWriter, r *http.Request, executor *graphqlapi.Executor) {
+	var req graphqlapi.Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeError(w, r, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			writeError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		writeError(w, r, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, executor.Execute(r.Context(), req))
+}
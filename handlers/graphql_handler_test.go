@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"devbriefs-news/datastore"
+	"devbriefs-news/graphqlapi"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGraphQL(t *testing.T) {
+	executor, err := graphqlapi.NewExecutor(datastore.NewMemoryCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "POST",
+			method:         http.MethodPost,
+			target:         "/api/graphql",
+			body:           `{"query":"query($topic: String) { articles(topic: $topic) { totalCount } }","variables":{"topic":"hacking"}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"articles":{"totalCount":0}}}`,
+		},
+		{
+			name:           "GET",
+			method:         http.MethodGet,
+			target:         "/api/graphql?query=" + url.QueryEscape("{ tags { name } }"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"tags":[]}}`,
+		},
+		{
+			name:           "Query error",
+			method:         http.MethodPost,
+			target:         "/api/graphql",
+			body:           `{"query":"{ unknown }"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"errors"`,
+		},
+		{
+			name:           "Invalid JSON",
+			method:         http.MethodPost,
+			target:         "/api/graphql",
+			body:           `{"query":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing query",
+			method:         http.MethodGet,
+			target:         "/api/graphql",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			GraphQL(rr, req, executor)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body containing %s, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
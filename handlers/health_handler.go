@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"devbriefs-news/health"
+	"net/http"
+)
+
+// Healthz is the liveness probe, answering as long as the process serves requests
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, map[string]health.Status{"status": health.StatusOK})
+}
+
+// Readyz is the readiness probe, writing the status of every dependency. It answers 503 Service Unavailable when one
+// of them failed, and 200 OK when they're all ok or degraded.
+func Readyz(w http.ResponseWriter, r *http.Request, checker *health.Checker) {
+	report := checker.Run(r.Context())
+	status := http.StatusOK
+	if report.Status == health.StatusFailed {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, status, report)
+}
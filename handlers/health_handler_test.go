@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/health"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Healthz(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         health.Status
+		expectedStatus int
+	}{
+		{name: "Ready", status: health.StatusOK, expectedStatus: http.StatusOK},
+		{name: "Degraded is still ready", status: health.StatusDegraded, expectedStatus: http.StatusOK},
+		{name: "Failed", status: health.StatusFailed, expectedStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(time.Second)
+			checker.Register("redis", func(context.Context) health.Result {
+				return health.Result{Status: health.StatusOK}
+			})
+			checker.Register("upstream_quota", func(context.Context) health.Result {
+				return health.Result{Status: tt.status, Message: "newsapi budget below 10 calls"}
+			})
+			rr := httptest.NewRecorder()
+
+			Readyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil), checker)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			var report health.Report
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status || len(report.Checks) != 2 || report.Checks[1].Name != "upstream_quota" {
+				t.Errorf("expected a breakdown per dependency, got %+v", report)
+			}
+		})
+	}
+}
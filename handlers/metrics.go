@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"devbriefs-news/metrics"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels the requests that matched no route, so scanners can't blow up the cardinality of the metrics
+const unmatchedRoute = "unmatched"
+
+// Metrics observes the latency of every request in metrics.HTTPRequestDuration by method, route template (e.g.
+// /api/watchlists/:id rather than the path requested) and status code. It goes first so requests rejected by the
+// other middlewares are observed too.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"devbriefs-news/metrics"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Metrics())
+	engine.GET("/api/metrics-test/:id", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/api/metrics-test/1", "/api/metrics-test/2", "/metrics-test-unknown"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := []string{
+		`devbriefs_http_request_duration_seconds_count{method="GET",route="/api/metrics-test/:id",status="418"} 2`,
+		`devbriefs_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"}`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("expected %s in\n%s", line, rr.Body.String())
+		}
+	}
+	if strings.Contains(rr.Body.String(), "metrics-test-unknown") {
+		t.Error("expected unmatched paths not to be labeled")
+	}
+}
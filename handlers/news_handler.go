@@ -3,34 +3,80 @@ package handlers
 import (
 	"context"
 	"devbriefs-news/api"
-	"devbriefs-news/datastore"
-	"encoding/json"
-	"log"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/codes"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func GetEveryHackingNews(ctx context.Context, w http.ResponseWriter, api api.NewsAPI, redisCache *datastore.RedisCache) {
+// GetEveryHackingNews fetches hacking news, stores them in cache and writes them keyed by article ID. When the "sort"
+// query parameter is set to "score" or "publishedAt", the articles are written as a list in that order instead, which
+// /api/v1 always does, newest first by default.
+//
+// The fetch runs in the context of the request, so it's cancelled when the client goes away.
+func GetEveryHackingNews(w http.ResponseWriter, r *http.Request, api api.NewsAPI, ingestor *services.Ingestor) {
+	ctx, span := tracer.Start(r.Context(), "handlers.GetEveryHackingNews")
+	defer span.End()
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" && isV1(r) {
+		sortBy = services.SortByPublishedAt
+	}
+	if sortBy != "" && sortBy != services.SortByScore && sortBy != services.SortByPublishedAt {
+		writeError(w, r, fmt.Sprintf("invalid sort %q, expected %q or %q", sortBy, services.SortByScore, services.SortByPublishedAt), http.StatusBadRequest)
+		return
+	}
+
 	news, err := api.FetchEverythingHacking(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if err != nil && ctx.Err() != nil {
+		// the client went away, there's nobody to answer
+		slog.DebugContext(ctx, "news fetch cancelled", logging.Err(err))
+		return
+	}
+	var budgetErr *services.BudgetError
+	if errors.As(err, &budgetErr) {
+		// nothing cached to serve instead of fetching
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(budgetErr.Reset).Seconds()))))
+		writeError(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	var circuitErr *resilience.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		// NewsAPI is down, don't make clients retry before we do
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(circuitErr.Until).Seconds()))))
+		writeError(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// store news in Cache
-	for k, v := range news {
-		jsonValue, err := json.Marshal(v)
-		if err != nil {
-			log.Printf("failed to marshal news data with key (%s) and value(%v): %v", k, v, err)
-			continue
-		}
-		if err = redisCache.Set(k, jsonValue); err != nil {
-			log.Println("failed to store news data:", err)
-		}
+	// store news in Cache, even if the client goes away meanwhile as the fetch was paid for
+	if _, err = ingestor.Ingest(context.WithoutCancel(ctx), news); err != nil {
+		slog.ErrorContext(ctx, "failed to store news data", logging.Err(err))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(news)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var response any = news
+	if sortBy != "" {
+		articles := make([]models.NewsArticle, 0, len(news))
+		for _, article := range news {
+			articles = append(articles, article)
+		}
+		response = services.SortArticles(articles, sortBy, time.Now())
 	}
+
+	writeJSON(w, r, http.StatusOK, response)
 }
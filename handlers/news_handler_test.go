@@ -1,30 +1,42 @@
 package handlers
 
 import (
+	"context"
+	"devbriefs-news/datastore"
 	"devbriefs-news/models"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 // MockGoogleNewsAPI is a mock implementation of the NewsAPI interface.
 type MockGoogleNewsAPI struct {
-	FetchEverythingHackingFunc func() ([]models.NewsArticle, error)
+	FetchEverythingHackingFunc func(ctx context.Context) (map[string]models.NewsArticle, error)
 }
 
-func (m *MockGoogleNewsAPI) FetchEverythingHacking() ([]models.NewsArticle, error) {
-	return m.FetchEverythingHackingFunc()
+func (m *MockGoogleNewsAPI) FetchEverythingHacking(ctx context.Context) (map[string]models.NewsArticle, error) {
+	return m.FetchEverythingHackingFunc(ctx)
 }
 
 func TestGetEveryHackingNews(t *testing.T) {
 	tests := []struct {
-		name           string
-		mockNews       []models.NewsArticle
-		mockError      error
-		expectedStatus int
-		expectedBody   string
+		name               string
+		mockNews           map[string]models.NewsArticle
+		mockError          error
+		expectedStatus     int
+		expectedBody       string
+		expectedRetryAfter bool
 	}{
+		{
+			name:           "FetchEverythingHacking returns news",
+			mockNews:       map[string]models.NewsArticle{"a1": {ID: "a1", Title: "Zero-day exploited", Topic: services.TopicHacking}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"a1":{"title":"Zero-day exploited","url":"","description":"","source":{"id":"","name":""},"publishedAt":"","id":"a1","topic":"hacking"}}` + "\n",
+		},
 		{
 			name:           "FetchEverythingHacking returns error",
 			mockNews:       nil,
@@ -32,15 +44,22 @@ func TestGetEveryHackingNews(t *testing.T) {
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   "fetch error\n",
 		},
+		{
+			name:               "Upstream circuit open",
+			mockError:          &resilience.CircuitOpenError{Provider: "newsapi", Until: time.Now().Add(30 * time.Second)},
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockAPI := &MockGoogleNewsAPI{
-				FetchEverythingHackingFunc: func() ([]models.NewsArticle, error) {
+				FetchEverythingHackingFunc: func(context.Context) (map[string]models.NewsArticle, error) {
 					return tt.mockNews, tt.mockError
 				},
 			}
+			cache := datastore.NewMemoryCache()
 
 			req, err := http.NewRequest("GET", "/api/everything-hacking-news", nil)
 			if err != nil {
@@ -49,7 +68,7 @@ func TestGetEveryHackingNews(t *testing.T) {
 
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				GetEveryHackingNews(w, mockAPI)
+				GetEveryHackingNews(w, r, mockAPI, services.NewIngestor(cache))
 			})
 
 			handler.ServeHTTP(rr, req)
@@ -58,9 +77,39 @@ func TestGetEveryHackingNews(t *testing.T) {
 				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
 			}
 
-			if body := rr.Body.String(); body != tt.expectedBody {
+			if body := rr.Body.String(); tt.expectedBody != "" && body != tt.expectedBody {
 				t.Errorf("handler returned unexpected body: got %v want %v", body, tt.expectedBody)
 			}
+
+			if retryAfter := rr.Header().Get("Retry-After"); (retryAfter != "") != tt.expectedRetryAfter {
+				t.Errorf("handler returned unexpected Retry-After: got %q", retryAfter)
+			}
+
+			// the news fetched are cached
+			for id := range tt.mockNews {
+				if _, err = datastore.GetArticle(context.Background(), cache, id); err != nil {
+					t.Errorf("expected article %s to be cached, got %v", id, err)
+				}
+			}
 		})
 	}
 }
+
+func TestGetEveryHackingNewsClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mockAPI := &MockGoogleNewsAPI{
+		FetchEverythingHackingFunc: func(ctx context.Context) (map[string]models.NewsArticle, error) {
+			// the client goes away during the fetch, which is cancelled
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/everything-hacking-news", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	GetEveryHackingNews(rr, req, mockAPI, services.NewIngestor(datastore.NewMemoryCache()))
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected no answer to a client gone, got %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"devbriefs-news/trustedproxy"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPHeader carries the client IP resolved by UseTrustedProxies, it's private to our service: incoming values
+// are always dropped
+const clientIPHeader = "X-Devbriefs-Client-IP"
+
+// cloudflareClientIPHeader is set by Cloudflare to the IP of the client it proxies
+const cloudflareClientIPHeader = "CF-Connecting-IP"
+
+// UseTrustedProxies makes c.ClientIP() return the real client IP of requests proxied by Cloudflare, checking the remote
+// address of each request against the current ranges of the manager, which can change at any time. It must be
+// registered before any middleware using the client IP. With rejectUntrusted, requests not coming from Cloudflare, or
+// from loopback for local health checks, get 403 Forbidden so the origin can't be reached around Cloudflare.
+//
+// gin's own trusted proxies can't be swapped while serving, so the engine trusts no proxy and reads the client IP
+// from a header set here, like it does on trusted platforms.
+func UseTrustedProxies(engine *gin.Engine, manager *trustedproxy.Manager, rejectUntrusted bool) error {
+	if err := engine.SetTrustedProxies(nil); err != nil {
+		return err
+	}
+	engine.TrustedPlatform = clientIPHeader
+	engine.Use(func(c *gin.Context) {
+		c.Request.Header.Del(clientIPHeader)
+
+		remote, err := netip.ParseAddrPort(c.Request.RemoteAddr)
+		if err == nil && manager.Trusted(remote.Addr()) {
+			if client, err := netip.ParseAddr(strings.TrimSpace(c.GetHeader(cloudflareClientIPHeader))); err == nil {
+				c.Request.Header.Set(clientIPHeader, client.Unmap().String())
+			}
+		} else if rejectUntrusted && (err != nil || !remote.Addr().IsLoopback()) {
+			writeError(c.Writer, c.Request, "requests must go through Cloudflare", http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	})
+	return nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/trustedproxy"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cloudflareClient serves a fixed list of Cloudflare ranges
+type cloudflareClient struct{}
+
+func (cloudflareClient) Do(*http.Request) (*http.Response, error) {
+	body := `{"result":{"ipv4_cidrs":["173.245.48.0/20"],"ipv6_cidrs":["2400:cb00::/32"]},"success":true}`
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestUseTrustedProxies(t *testing.T) {
+	manager := trustedproxy.NewManager(cloudflareClient{}, trustedproxy.CloudflareIPsURL, "")
+	if err := manager.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		rejectUntrusted bool
+		remoteAddr      string
+		headers         map[string]string
+		expectedStatus  int
+		expectedIP      string
+	}{
+		{
+			name:           "Proxied by Cloudflare over IPv4",
+			remoteAddr:     "173.245.48.10:443",
+			headers:        map[string]string{"CF-Connecting-IP": "203.0.113.7"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "Proxied by Cloudflare over IPv6",
+			remoteAddr:     "[2400:cb00::1]:443",
+			headers:        map[string]string{"CF-Connecting-IP": "2001:db8::7"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "2001:db8::7",
+		},
+		{
+			name:           "Spoofed headers from outside Cloudflare",
+			remoteAddr:     "198.51.100.1:5000",
+			headers:        map[string]string{"CF-Connecting-IP": "203.0.113.7", "X-Forwarded-For": "203.0.113.7", clientIPHeader: "203.0.113.7"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "198.51.100.1",
+		},
+		{
+			name:            "Rejected outside Cloudflare",
+			rejectUntrusted: true,
+			remoteAddr:      "198.51.100.1:5000",
+			expectedStatus:  http.StatusForbidden,
+		},
+		{
+			name:            "Loopback allowed when rejecting",
+			rejectUntrusted: true,
+			remoteAddr:      "127.0.0.1:5000",
+			expectedStatus:  http.StatusOK,
+			expectedIP:      "127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			if err := UseTrustedProxies(engine, manager, tt.rejectUntrusted); err != nil {
+				t.Fatal(err)
+			}
+			engine.GET("/ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+
+			engine.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Body.String() != tt.expectedIP {
+				t.Errorf("expected client IP %s, got %s", tt.expectedIP, rr.Body.String())
+			}
+		})
+	}
+}
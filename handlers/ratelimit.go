@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"devbriefs-news/logging"
+	"devbriefs-news/ratelimit"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit limits the requests of each client with a token bucket: per API key on routes using RequireAPIKey before
+// it, per client IP otherwise, which is how public routes are limited. c.ClientIP() is the real client IP as long as the
+// router only trusts the proxies in front of it. Responses carry the RateLimit-* headers of the IETF draft, and rejected
+// requests get 429 Too Many Requests with Retry-After. When the limiter fails, requests are let through rather than
+// failing the API.
+func RateLimit(limiter ratelimit.Limiter, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if apiKey, ok := authenticatedKey(c.Request); ok {
+			key = "apikey:" + apiKey.ID
+		}
+		if !allow(c, limiter, limit, key) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthFailureLimit rate limits per client IP the requests RequireAPIKey refuses for a missing or invalid key, so keys
+// can't be guessed faster than anonymous clients are allowed to call public routes
+type AuthFailureLimit struct {
+	Limiter ratelimit.Limiter
+	Limit   ratelimit.Limit
+}
+
+// allow takes a token from the bucket of key, setting the RateLimit-* headers, and answers 429 Too Many Requests when
+// the bucket is empty. It reports whether the request can go on, which it does when the limiter fails.
+func allow(c *gin.Context, limiter ratelimit.Limiter, limit ratelimit.Limit, key string) bool {
+	result, err := limiter.Allow(c.Request.Context(), key, limit)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to rate limit", "key", key, logging.Err(err))
+		return true
+	}
+	c.Header("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+strconv.Itoa(seconds(time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)))))
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+		writeError(c.Writer, c.Request, "rate limit exceeded, retry later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// seconds rounds a duration up to whole seconds, as headers expect
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/auth"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/ratelimit"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// brokenLimiter fails like a limiter whose store is down
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	engine := gin.New()
+	engine.GET("/ip", RateLimit(ratelimit.NewMemoryLimiter(), limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	keyLimiter := ratelimit.NewMemoryLimiter()
+	engine.GET("/key", func(c *gin.Context) {
+		// stands for RequireAPIKey
+		c.Request = withAPIKey(c.Request, models.APIKey{ID: c.GetHeader(apiKeyHeader)})
+	}, RateLimit(keyLimiter, limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/broken", RateLimit(brokenLimiter{}, limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name              string
+		path              string
+		remoteAddr        string
+		apiKey            string
+		expectedStatus    int
+		expectedRemaining string
+	}{
+		{name: "First request of an IP", path: "/ip", remoteAddr: "1.2.3.4:1000", expectedStatus: http.StatusOK, expectedRemaining: "1"},
+		{name: "Second request of the IP", path: "/ip", remoteAddr: "1.2.3.4:1001", expectedStatus: http.StatusOK, expectedRemaining: "0"},
+		{name: "Third request of the IP", path: "/ip", remoteAddr: "1.2.3.4:1002", expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0"},
+		{name: "Another IP", path: "/ip", remoteAddr: "5.6.7.8:1000", expectedStatus: http.StatusOK, expectedRemaining: "1"},
+		{name: "Key from an IP", path: "/key", remoteAddr: "1.2.3.4:1000", apiKey: "k1", expectedStatus: http.StatusOK, expectedRemaining: "1"},
+		{name: "Same key from another IP", path: "/key", remoteAddr: "5.6.7.8:1000", apiKey: "k1", expectedStatus: http.StatusOK, expectedRemaining: "0"},
+		{name: "Same key over the limit", path: "/key", remoteAddr: "9.9.9.9:1000", apiKey: "k1", expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0"},
+		{name: "Another key", path: "/key", remoteAddr: "1.2.3.4:1000", apiKey: "k2", expectedStatus: http.StatusOK, expectedRemaining: "1"},
+		{name: "Broken limiter lets requests through", path: "/broken", remoteAddr: "1.2.3.4:1000", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(apiKeyHeader, tt.apiKey)
+			rr := httptest.NewRecorder()
+
+			engine.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if got := rr.Header().Get("RateLimit-Remaining"); got != tt.expectedRemaining {
+				t.Errorf("expected RateLimit-Remaining %q, got %q", tt.expectedRemaining, got)
+			}
+			if tt.expectedRemaining != "" && (rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Policy") != "2;w=2") {
+				t.Errorf("expected RateLimit-Limit 2 and RateLimit-Policy 2;w=2, got %v", rr.Header())
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); (tt.expectedStatus == http.StatusTooManyRequests) != (retryAfter == "1") {
+				t.Errorf("expected Retry-After 1 on 429 only, got %q", retryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimitAsWired(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	apiKey, _, err := auth.Issue(ctx, cache, "team-a", "read", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as main wires it: an IP burst of 2, a key burst of 5
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewMemoryLimiter()
+	ipLimit := ratelimit.Limit{Rate: 0.001, Burst: 2}
+	engine := gin.New()
+	public := engine.Group("/api", RateLimit(limiter, ipLimit))
+	public.GET("/feed", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	authenticated := engine.Group("/api/v1", RequireAPIKey(cache, auth.ScopeRead, &AuthFailureLimit{Limiter: limiter, Limit: ipLimit}),
+		RateLimit(limiter, ratelimit.Limit{Rate: 0.001, Burst: 5}))
+	authenticated.GET("/news", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		remoteAddr     string
+		apiKey         string
+		expectedStatus int
+	}{
+		{name: "Key past the IP burst 1", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusOK},
+		{name: "Key past the IP burst 2", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusOK},
+		{name: "Key past the IP burst 3", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusOK},
+		{name: "Key past the IP burst 4", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusOK},
+		{name: "Key past the IP burst 5", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusOK},
+		{name: "Key over its burst", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: apiKey, expectedStatus: http.StatusTooManyRequests},
+		{name: "Public route from the IP of the key", path: "/api/feed", remoteAddr: "1.2.3.4:1000", expectedStatus: http.StatusOK},
+		{name: "Invalid key from the IP", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", apiKey: "dbn_unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing key over the IP burst", path: "/api/v1/news", remoteAddr: "1.2.3.4:1000", expectedStatus: http.StatusTooManyRequests},
+		{name: "Public route over the IP burst", path: "/api/feed", remoteAddr: "1.2.3.4:1000", expectedStatus: http.StatusTooManyRequests},
+		{name: "Invalid key from another IP", path: "/api/v1/news", remoteAddr: "5.6.7.8:1000", apiKey: "dbn_unknown", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+
+			engine.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
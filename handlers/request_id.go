@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"devbriefs-news/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries the ID of a request, from the client or our proxy when they set it, back in the response
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs we accept from clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, the one in its X-Request-ID header when valid or a new UUID, sent back in the
+// response header and put in the context of c.Request so every record logged with it carries the ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		ctx := logging.WithRequestID(c.Request.Context(), id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII characters, so clients can't forge log lines with them
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs every request once served, at error level for 5xx, warn for 4xx and info otherwise. Only the path is
+// logged, not the query which may hold credentials.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request served",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Duration(logging.KeyDuration, time.Since(start)),
+		)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"devbriefs-news/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		expectedID string
+	}{
+		{name: "Generated", expectedID: ""},
+		{name: "From the client", header: "edge-1234", expectedID: "edge-1234"},
+		{name: "Forged log line", header: "abc\ndef", expectedID: ""},
+		{name: "Too long", header: strings.Repeat("a", maxRequestIDLength+1), expectedID: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			engine.Use(RequestID())
+			var contextID string
+			engine.GET("/", func(c *gin.Context) {
+				contextID = logging.RequestID(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			engine.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(requestIDHeader)
+			if id != contextID {
+				t.Errorf("expected the response header %q to match the context %q", id, contextID)
+			}
+			if tt.expectedID == "" {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("expected a generated UUID, got %q", id)
+				}
+			} else if id != tt.expectedID {
+				t.Errorf("expected %q, got %q", tt.expectedID, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Envelope is the shape of every /api/v1 JSON response: the payload in data, list details in meta, and what went wrong
+// in errors, in which case data is null
+type Envelope struct {
+	Data   any        `json:"data"`
+	Meta   *Meta      `json:"meta,omitempty"`
+	Errors []APIError `json:"errors,omitempty"`
+}
+
+// Meta describes the payload of a response, only set for lists
+type Meta struct {
+	Count int `json:"count"` // The number of items in data
+}
+
+// APIError is an error of an /api/v1 response
+type APIError struct {
+	Code    string `json:"code"`    // The status of the response in snake case, e.g. "not_found"
+	Message string `json:"message"` // What went wrong, for humans
+}
+
+// v1Key is the context key marking requests made to /api/v1, see V1
+type v1Key struct{}
+
+// withV1 marks a request as made to /api/v1, so its responses are wrapped in an Envelope
+func withV1(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), v1Key{}, true))
+}
+
+func isV1(r *http.Request) bool {
+	v1, _ := r.Context().Value(v1Key{}).(bool)
+	return v1
+}
+
+// writeJSON writes v as a JSON response with the given status code, wrapped in an Envelope for /api/v1 requests
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if isV1(r) {
+		envelope := Envelope{Data: v}
+		if value := reflect.ValueOf(v); value.Kind() == reflect.Slice {
+			// a list is always a list, even when empty
+			if value.IsNil() {
+				envelope.Data = []any{}
+			}
+			envelope.Meta = &Meta{Count: value.Len()}
+		}
+		v = envelope
+	}
+	encodeJSON(w, status, v)
+}
+
+// writeError writes an error response like http.Error does, or an Envelope with the error for /api/v1 requests
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !isV1(r) {
+		http.Error(w, message, status)
+		return
+	}
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	encodeJSON(w, status, Envelope{Errors: []APIError{{Code: code, Message: message}}})
+}
+
+func encodeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"devbriefs-news/api"
+	"devbriefs-news/datastore"
+	"devbriefs-news/openapi"
+	"devbriefs-news/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Dependencies are what the /api/v1 handlers are wired with
+type Dependencies struct {
+	Cache    datastore.Cache
+	NewsAPI  api.NewsAPI
+	Ingestor *services.Ingestor
+	// Confirmer emails the confirmation of subscriptions, subscribing answers 503 without it
+	Confirmer SubscriptionConfirmer
+}
+
+// V1 marks the requests of a route group as /api/v1 ones, so their JSON responses are wrapped in an Envelope
+func V1() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = withV1(c.Request)
+		c.Next()
+	}
+}
+
+// RegisterV1 registers the /api/v1 routes on a group using the V1 middleware. Every route must be described in
+// openapi/openapi.json, which the contract test enforces.
+func RegisterV1(v1 gin.IRoutes, deps Dependencies) {
+	v1.GET("/news", func(c *gin.Context) {
+		GetEveryHackingNews(c.Writer, c.Request, deps.NewsAPI, deps.Ingestor)
+	})
+	v1.GET("/articles/:id", func(c *gin.Context) {
+		GetArticle(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+	v1.GET("/briefs/:topic", func(c *gin.Context) {
+		GetBrief(c.Writer, c.Request, c.Param("topic"), deps.Cache)
+	})
+
+	v1.POST("/watchlists", func(c *gin.Context) {
+		CreateWatchlist(c.Writer, c.Request, deps.Cache)
+	})
+	v1.GET("/watchlists", func(c *gin.Context) {
+		ListWatchlists(c.Writer, c.Request, deps.Cache)
+	})
+	v1.GET("/watchlists/:id", func(c *gin.Context) {
+		GetWatchlist(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+	v1.DELETE("/watchlists/:id", func(c *gin.Context) {
+		DeleteWatchlist(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+	v1.GET("/watchlists/:id/news", func(c *gin.Context) {
+		GetWatchlistNews(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+
+	v1.POST("/webhooks", func(c *gin.Context) {
+		CreateWebhook(c.Writer, c.Request, deps.Cache)
+	})
+	v1.GET("/webhooks", func(c *gin.Context) {
+		ListWebhooks(c.Writer, c.Request, deps.Cache)
+	})
+	v1.DELETE("/webhooks/:id", func(c *gin.Context) {
+		DeleteWebhook(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+	v1.GET("/webhooks/:id/deliveries", func(c *gin.Context) {
+		GetWebhookDeliveries(c.Writer, c.Request, c.Param("id"), deps.Cache)
+	})
+
+	v1.POST("/subscribers", func(c *gin.Context) {
+		Subscribe(c.Writer, c.Request, deps.Cache, deps.Confirmer)
+	})
+}
+
+// OpenAPI writes the OpenAPI 3 document of /api/v1
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openapi.Spec)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"devbriefs-news/broker"
+	"fmt"
+	"github.com/gin-contrib/sse"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// lastEventIDHeader is sent by EventSource clients when reconnecting, with the ID of the last event they got
+	lastEventIDHeader = "Last-Event-ID"
+	// streamRetry is how long EventSource clients wait before reconnecting, in milliseconds
+	streamRetry = 3000
+)
+
+// StreamArticles streams the articles ingested by the fetch pipeline as Server-Sent Events, optionally filtered by the
+// "topic" and "tag" query parameters. A client reconnecting with the Last-Event-ID header first gets the events it
+// missed that are still in the broker replay buffer. A heartbeat event is sent every heartbeat so proxies don't close
+// idle streams.
+func StreamArticles(w http.ResponseWriter, r *http.Request, b *broker.Broker, heartbeat time.Duration) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID, err := parseLastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := broker.Filter{
+		Topics: queryList(r, "topic"),
+		Tags:   queryList(r, "tag"),
+	}
+
+	sub, missed := b.Subscribe(filter, lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", sse.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// tell nginx-like proxies not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err = sse.Encode(w, sse.Event{Event: "ready", Retry: streamRetry, Data: "ok"}); err != nil {
+		return
+	}
+	for _, event := range missed {
+		if err = writeArticleEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// we were dropped for lagging behind, the client resumes from its Last-Event-ID when reconnecting
+				return
+			}
+			if err = writeArticleEvent(w, event); err != nil {
+				return
+			}
+		case now := <-ticker.C:
+			if err = sse.Encode(w, sse.Event{Event: "heartbeat", Data: now.UTC().Format(time.RFC3339)}); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeArticleEvent(w http.ResponseWriter, event broker.Event) error {
+	return sse.Encode(w, sse.Event{
+		Id:    strconv.FormatUint(event.ID, 10),
+		Event: "article",
+		Data:  event.Article,
+	})
+}
+
+// parseLastEventID reads the Last-Event-ID header, falling back to the "lastEventId" query parameter for clients that
+// can't set headers
+func parseLastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get(lastEventIDHeader)
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last event ID %q", value)
+	}
+	return id, nil
+}
+
+// queryList returns the values of a query parameter given either repeated or comma separated, e.g.
+// "?tag=ransomware&tag=breach" or "?tag=ransomware,breach"
+func queryList(r *http.Request, name string) []string {
+	var list []string
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"devbriefs-news/broker"
+	"devbriefs-news/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next Server-Sent Event of a stream, returning its fields
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			return fields
+		}
+		key, value, _ := strings.Cut(line, ":")
+		fields[key] = value
+	}
+}
+
+func TestStreamArticles(t *testing.T) {
+	b := broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize)
+	b.Publish([]models.NewsArticle{
+		{ID: "a1", Topic: "hacking"},
+		{ID: "a2", Topic: "linux"},
+		{ID: "a3", Topic: "hacking"},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamArticles(w, r, b, 50*time.Millisecond)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/stream?topic=hacking", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(lastEventIDHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", got)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if event := readEvent(t, reader); event["event"] != "ready" || event["retry"] != "3000" {
+		t.Errorf("expected a ready event with a retry delay, got %v", event)
+	}
+	// a2 is filtered out, a3 is replayed
+	if event := readEvent(t, reader); event["id"] != "3" || !strings.Contains(event["data"], `"id":"a3"`) {
+		t.Errorf("expected a3 to be replayed, got %v", event)
+	}
+
+	b.Publish([]models.NewsArticle{{ID: "a4", Topic: "hacking"}})
+	if event := readEvent(t, reader); event["event"] != "article" || event["id"] != "4" {
+		t.Errorf("expected a4 to be streamed, got %v", event)
+	}
+	if event := readEvent(t, reader); event["event"] != "heartbeat" {
+		t.Errorf("expected a heartbeat, got %v", event)
+	}
+}
+
+func TestStreamArticlesInvalidLastEventID(t *testing.T) {
+	b := broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize)
+	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	req.Header.Set(lastEventIDHeader, "abc")
+	rr := httptest.NewRecorder()
+
+	StreamArticles(rr, req, b, time.Second)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestQueryList(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/stream?tag=ransomware,%20breach&tag=phishing&tag=", nil)
+	got := queryList(req, "tag")
+	expected := []string{"ransomware", "breach", "phishing"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
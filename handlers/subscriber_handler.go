@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"devbriefs-news/datastore"
+	"devbriefs-news/delivery"
+	"devbriefs-news/logging"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"slices"
+	"time"
+)
+
+// SubscriptionConfirmer emails pending subscribers the link confirming their subscription, see delivery.EmailPublisher
+type SubscriptionConfirmer interface {
+	SendConfirmation(ctx context.Context, subscriber models.Subscriber) error
+}
+
+// subscriberRequest is the body expected when subscribing an email address to the daily briefs
+type subscriberRequest struct {
+	Email  string   `json:"email"`
+	Topics []string `json:"topics"`
+	Token  string   `json:"token"` // The token of the links emailed to the subscriber, to change its topics
+}
+
+// subscriptionResponse answers a subscription without telling whether the address was already subscribed
+type subscriptionResponse struct {
+	Email   string `json:"email"`
+	Message string `json:"message"`
+}
+
+// Subscribe subscribes an email address to the daily briefs. The subscription stays pending, without any brief sent,
+// until the address confirms it with the link emailed to it, so nobody can subscribe an address they don't own. The
+// topics of an existing subscription only change given the token of its links.
+func Subscribe(w http.ResponseWriter, r *http.Request, cache datastore.Cache, confirmer SubscriptionConfirmer) {
+	if confirmer == nil {
+		writeError(w, r, "email delivery is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	var body subscriberRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, fmt.Sprintf("invalid subscriber: %v", err), http.StatusBadRequest)
+		return
+	}
+	address, err := mail.ParseAddress(body.Email)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("invalid email %q", body.Email), http.StatusBadRequest)
+		return
+	}
+	for _, topic := range body.Topics {
+		if !slices.Contains(services.Topics, topic) {
+			writeError(w, r, fmt.Sprintf("unknown topic %q, expected one of %v", topic, services.Topics), http.StatusBadRequest)
+			return
+		}
+	}
+
+	subscriber, err := datastore.GetSubscriber(r.Context(), cache, address.Address)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		subscriber = models.Subscriber{Email: address.Address, Topics: body.Topics, Pending: true, CreatedAt: time.Now().UTC()}
+		if subscriber.UnsubscribeToken, err = delivery.NewUnsubscribeToken(); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err = datastore.SetSubscriber(r.Context(), cache, subscriber); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	case body.Token != "":
+		if !validToken(subscriber, body.Token) {
+			writeError(w, r, "invalid token", http.StatusForbidden)
+			return
+		}
+		subscriber.Topics = body.Topics
+		if err = datastore.SetSubscriber(r.Context(), cache, subscriber); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the token only travels in the emails
+		subscriber.UnsubscribeToken = ""
+		writeJSON(w, r, http.StatusOK, subscriber)
+		return
+	}
+
+	// a pending subscription gets its confirmation again, a confirmed one is left as is
+	if subscriber.Pending {
+		if err = confirmer.SendConfirmation(r.Context(), subscriber); err != nil {
+			slog.ErrorContext(r.Context(), "failed to email subscription confirmation", logging.Err(err))
+			writeError(w, r, "failed to email the confirmation, retry later", http.StatusBadGateway)
+			return
+		}
+	}
+	writeJSON(w, r, http.StatusAccepted, subscriptionResponse{
+		Email:   address.Address,
+		Message: "open the link emailed to the address to confirm its subscription, unless it's already confirmed",
+	})
+}
+
+// linkPage asks to confirm the action of a link we emailed with a form posting back to it, since mail scanners prefetch
+// links with GET requests
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>DevBriefs</title></head>
+<body>
+<form method="post">
+<p>{{.Question}}</p>
+<button type="submit">{{.Action}}</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmSubscription confirms a pending subscription, given the token of its confirmation link. GET answers a page
+// posting the confirmation, only POST confirms it.
+func ConfirmSubscription(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	subscriber, ok := linkSubscriber(w, r, cache, "invalid confirmation link")
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeLinkPage(w, fmt.Sprintf("Receive the DevBriefs daily briefs at %s?", subscriber.Email), "Confirm")
+		return
+	}
+
+	if subscriber.Pending {
+		subscriber.Pending = false
+		if err := datastore.SetSubscriber(r.Context(), cache, subscriber); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "%s will receive DevBriefs\n", subscriber.Email)
+}
+
+// Unsubscribe removes an email address from the subscribers, given the token of its unsubscribe links. GET answers a
+// page posting the unsubscription, only POST, also sent by one-click unsubscribe from mail clients (RFC 8058), removes
+// it.
+func Unsubscribe(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	subscriber, ok := linkSubscriber(w, r, cache, "invalid unsubscribe link")
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeLinkPage(w, fmt.Sprintf("Stop sending DevBriefs to %s?", subscriber.Email), "Unsubscribe")
+		return
+	}
+
+	if err := datastore.RemoveSubscriber(r.Context(), cache, subscriber.Email); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "%s won't receive DevBriefs anymore\n", subscriber.Email)
+}
+
+// linkSubscriber returns the subscriber of the email and token of a link we emailed, answering 404 when they don't match
+func linkSubscriber(w http.ResponseWriter, r *http.Request, cache datastore.Cache, invalid string) (models.Subscriber, bool) {
+	email, token := r.URL.Query().Get("email"), r.URL.Query().Get("token")
+	subscriber, err := datastore.GetSubscriber(r.Context(), cache, email)
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return subscriber, false
+	}
+	if err != nil || !validToken(subscriber, token) {
+		writeError(w, r, invalid, http.StatusNotFound)
+		return subscriber, false
+	}
+	return subscriber, true
+}
+
+// validToken reports whether token is the one of the links emailed to a subscriber
+func validToken(subscriber models.Subscriber, token string) bool {
+	return subscriber.UnsubscribeToken != "" && subtle.ConstantTimeCompare([]byte(subscriber.UnsubscribeToken), []byte(token)) == 1
+}
+
+func writeLinkPage(w http.ResponseWriter, question, action string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = linkPage.Execute(w, struct{ Question, Action string }{question, action})
+}
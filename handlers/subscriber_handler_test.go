@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingConfirmer records the subscribers it was asked to email a confirmation to
+type recordingConfirmer struct {
+	mu   sync.Mutex
+	sent []models.Subscriber
+}
+
+func (c *recordingConfirmer) SendConfirmation(_ context.Context, subscriber models.Subscriber) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, subscriber)
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	confirmer := &recordingConfirmer{}
+	confirmed := models.Subscriber{Email: "bob@example.com", Topics: []string{"hacking"}, UnsubscribeToken: "b0b"}
+	if err := datastore.SetSubscriber(ctx, cache, confirmed); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedSent   int
+		expectedTopics []string
+	}{
+		{name: "New address is pending", body: `{"email":"Alice <alice@example.com>","topics":["hacking"]}`, expectedStatus: http.StatusAccepted, expectedSent: 1, expectedTopics: []string{"hacking"}},
+		{name: "Pending address gets its confirmation again", body: `{"email":"alice@example.com"}`, expectedStatus: http.StatusAccepted, expectedSent: 2, expectedTopics: []string{"hacking"}},
+		{name: "Confirmed address without token is left as is", body: `{"email":"bob@example.com","topics":[]}`, expectedStatus: http.StatusAccepted, expectedSent: 2, expectedTopics: []string{"hacking"}},
+		{name: "Wrong token", body: `{"email":"bob@example.com","topics":[],"token":"guess"}`, expectedStatus: http.StatusForbidden, expectedSent: 2, expectedTopics: []string{"hacking"}},
+		{name: "Token changes the topics", body: `{"email":"bob@example.com","topics":[],"token":"b0b"}`, expectedStatus: http.StatusOK, expectedSent: 2},
+		{name: "Unknown topic", body: `{"email":"bob@example.com","topics":["made-up"],"token":"b0b"}`, expectedStatus: http.StatusBadRequest, expectedSent: 2},
+		{name: "Invalid email", body: `{"email":"nope"}`, expectedStatus: http.StatusBadRequest, expectedSent: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/subscribers", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			Subscribe(rr, req, cache, confirmer)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "b0b") {
+				t.Errorf("expected the token to stay out of the response, got %s", rr.Body.String())
+			}
+			if len(confirmer.sent) != tt.expectedSent {
+				t.Errorf("expected %d confirmations emailed, got %d", tt.expectedSent, len(confirmer.sent))
+			}
+			bob, err := datastore.GetSubscriber(ctx, cache, "bob@example.com")
+			if err != nil || strings.Join(bob.Topics, ",") != strings.Join(tt.expectedTopics, ",") || bob.Pending {
+				t.Errorf("expected bob confirmed with topics %v, got %+v (%v)", tt.expectedTopics, bob, err)
+			}
+		})
+	}
+
+	alice, err := datastore.GetSubscriber(ctx, cache, "alice@example.com")
+	if err != nil || !alice.Pending || alice.UnsubscribeToken == "" || strings.Join(alice.Topics, ",") != "hacking" {
+		t.Errorf("expected alice pending with a token and the hacking topic, got %+v (%v)", alice, err)
+	}
+	if confirmer.sent[0].UnsubscribeToken != alice.UnsubscribeToken {
+		t.Errorf("expected the confirmation to carry the token of alice")
+	}
+
+	rr := httptest.NewRecorder()
+	Subscribe(rr, httptest.NewRequest(http.MethodPost, "/api/subscribers", strings.NewReader(`{"email":"carol@example.com"}`)), cache, nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without email delivery, got %v", rr.Code)
+	}
+}
+
+func TestConfirmAndUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	if err := datastore.SetSubscriber(ctx, cache, models.Subscriber{Email: "alice@example.com", UnsubscribeToken: "t0k3n", Pending: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		handler         func(http.ResponseWriter, *http.Request, datastore.Cache)
+		method          string
+		token           string
+		expectedStatus  int
+		expectedPage    bool
+		expectedPending bool
+		expectedRemoved bool
+	}{
+		{name: "Confirm with the wrong token", handler: ConfirmSubscription, method: http.MethodGet, token: "guess", expectedStatus: http.StatusNotFound, expectedPending: true},
+		{name: "Prefetched confirmation link", handler: ConfirmSubscription, method: http.MethodGet, token: "t0k3n", expectedStatus: http.StatusOK, expectedPage: true, expectedPending: true},
+		{name: "Confirm", handler: ConfirmSubscription, method: http.MethodPost, token: "t0k3n", expectedStatus: http.StatusOK},
+		{name: "Unsubscribe with the wrong token", handler: Unsubscribe, method: http.MethodPost, token: "guess", expectedStatus: http.StatusNotFound},
+		{name: "Prefetched unsubscribe link", handler: Unsubscribe, method: http.MethodGet, token: "t0k3n", expectedStatus: http.StatusOK, expectedPage: true},
+		{name: "One-click unsubscribe", handler: Unsubscribe, method: http.MethodPost, token: "t0k3n", expectedStatus: http.StatusOK, expectedRemoved: true},
+		{name: "Already unsubscribed", handler: Unsubscribe, method: http.MethodGet, token: "t0k3n", expectedStatus: http.StatusNotFound, expectedRemoved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"email": {"alice@example.com"}, "token": {tt.token}}
+			req := httptest.NewRequest(tt.method, "/api/unsubscribe?"+query.Encode(), strings.NewReader("List-Unsubscribe=One-Click"))
+			rr := httptest.NewRecorder()
+
+			tt.handler(rr, req, cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if page := strings.Contains(rr.Body.String(), `<form method="post">`); page != tt.expectedPage {
+				t.Errorf("expected a page posting back %v, got %s", tt.expectedPage, rr.Body.String())
+			}
+			subscriber, err := datastore.GetSubscriber(ctx, cache, "alice@example.com")
+			if removed := errors.Is(err, datastore.ErrNotFound); removed != tt.expectedRemoved {
+				t.Fatalf("expected subscriber removed %v, got %v", tt.expectedRemoved, err)
+			}
+			if !tt.expectedRemoved && subscriber.Pending != tt.expectedPending {
+				t.Errorf("expected pending %v, got %+v", tt.expectedPending, subscriber)
+			}
+		})
+	}
+}
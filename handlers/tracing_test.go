@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Tracing())
+	engine.GET("/api/tracing-test/:id", func(c *gin.Context) {
+		// spans of the handlers are children of the request's
+		_, span := tracer.Start(c.Request.Context(), "handler")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tracing-test/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	handler, server := spans[0], spans[1]
+	if server.Name() != "GET /api/tracing-test/:id" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("expected a server span named after the route, got %s %s", server.SpanKind(), server.Name())
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected the trace of the caller continued, got trace %s parent %s", server.SpanContext().TraceID(), server.Parent().SpanID())
+	}
+	if handler.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("expected the handler span to be a child of the server span")
+	}
+	if server.Status().Code.String() != "Error" {
+		t.Errorf("expected a 500 to set the error status, got %s", server.Status().Code)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"devbriefs-news/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// watchlistRequest is the body expected when creating a watchlist
+type watchlistRequest struct {
+	Name     string   `json:"name"`
+	Vendors  []string `json:"vendors"`
+	Products []string `json:"products"`
+	Domains  []string `json:"domains"`
+}
+
+// CreateWatchlist persists a new watchlist owned by the requesting API client
+func CreateWatchlist(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	owner := clientID(r)
+	if owner == "" {
+		writeError(w, r, "missing API key", http.StatusUnauthorized)
+		return
+	}
+
+	var body watchlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, fmt.Sprintf("invalid watchlist: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" || len(body.Vendors)+len(body.Products)+len(body.Domains) == 0 {
+		writeError(w, r, "a watchlist needs a name and at least one vendor, product or domain", http.StatusBadRequest)
+		return
+	}
+
+	watchlist := models.Watchlist{
+		ID:        uuid.NewString(),
+		ClientID:  owner,
+		Name:      body.Name,
+		Vendors:   body.Vendors,
+		Products:  body.Products,
+		Domains:   body.Domains,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := datastore.SetWatchlist(r.Context(), cache, watchlist); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, watchlist)
+}
+
+// ListWatchlists writes the watchlists owned by the requesting API client
+func ListWatchlists(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	owner := clientID(r)
+	if owner == "" {
+		writeError(w, r, "missing API key", http.StatusUnauthorized)
+		return
+	}
+
+	watchlists, err := datastore.GetWatchlists(r.Context(), cache, owner)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, watchlists)
+}
+
+// GetWatchlist writes a watchlist owned by the requesting API client
+func GetWatchlist(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	watchlist, ok := ownedWatchlist(w, r, id, cache)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, watchlist)
+}
+
+// DeleteWatchlist removes a watchlist owned by the requesting API client
+func DeleteWatchlist(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	if _, ok := ownedWatchlist(w, r, id, cache); !ok {
+		return
+	}
+	if err := datastore.RemoveWatchlist(r.Context(), cache, id); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWatchlistNews writes the cached articles mentioning an entity of the watchlist, ranked by score unless the
+// "sort" query parameter asks for "publishedAt"
+func GetWatchlistNews(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = services.SortByScore
+	}
+	if sortBy != services.SortByScore && sortBy != services.SortByPublishedAt {
+		writeError(w, r, fmt.Sprintf("invalid sort %q, expected %q or %q", sortBy, services.SortByScore, services.SortByPublishedAt), http.StatusBadRequest)
+		return
+	}
+
+	watchlist, ok := ownedWatchlist(w, r, id, cache)
+	if !ok {
+		return
+	}
+
+	articles, err := datastore.GetArticles(r.Context(), cache)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matched := services.FilterWatchlist(watchlist, articles)
+	writeJSON(w, r, http.StatusOK, services.SortArticles(matched, sortBy, time.Now()))
+}
+
+// ownedWatchlist loads a watchlist, writing a 404 when it doesn't exist or belongs to another API client
+func ownedWatchlist(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) (models.Watchlist, bool) {
+	watchlist, err := datastore.GetWatchlist(r.Context(), cache, id)
+	if errors.Is(err, datastore.ErrNotFound) || (err == nil && watchlist.ClientID != clientID(r)) {
+		writeError(w, r, fmt.Sprintf("watchlist %s not found", id), http.StatusNotFound)
+		return watchlist, false
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return watchlist, false
+	}
+	return watchlist, true
+}
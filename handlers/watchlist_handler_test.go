@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateWatchlist(t *testing.T) {
+	tests := []struct {
+		name           string
+		clientID       string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Valid watchlist",
+			clientID:       "team-a",
+			body:           `{"name":"Suppliers","vendors":["Okta"],"domains":["example.com"]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Missing client",
+			body:           `{"name":"Suppliers","vendors":["Okta"]}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Nothing to watch",
+			clientID:       "team-a",
+			body:           `{"name":"Suppliers"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			clientID:       "team-a",
+			body:           `{"name":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := datastore.NewMemoryCache()
+			req := httptest.NewRequest(http.MethodPost, "/api/watchlists", strings.NewReader(tt.body))
+			if tt.clientID != "" {
+				req = withAPIKey(req, models.APIKey{ClientID: tt.clientID})
+			}
+			rr := httptest.NewRecorder()
+
+			CreateWatchlist(rr, req, cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var created models.Watchlist
+			if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+				t.Fatalf("could not decode watchlist: %v", err)
+			}
+			stored, err := datastore.GetWatchlist(context.Background(), cache, created.ID)
+			if err != nil {
+				t.Fatalf("expected watchlist to be persisted: %v", err)
+			}
+			if stored.ClientID != tt.clientID {
+				t.Errorf("expected watchlist owned by %s, got %s", tt.clientID, stored.ClientID)
+			}
+		})
+	}
+}
+
+func TestGetWatchlistNews(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	watchlist := models.Watchlist{ID: "w1", ClientID: "team-a", Name: "Suppliers", Vendors: []string{"Okta"}}
+	if err := datastore.SetWatchlist(ctx, cache, watchlist); err != nil {
+		t.Fatalf("could not store watchlist: %v", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, article := range []models.NewsArticle{
+		{ID: "a1", Title: "Okta support system breached", PublishedAt: now},
+		{ID: "a2", Title: "Unrelated ransomware story", PublishedAt: now},
+	} {
+		if err := datastore.SetArticle(ctx, cache, article); err != nil {
+			t.Fatalf("could not store article: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		clientID       string
+		id             string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{
+			name:           "Owner gets matching articles",
+			clientID:       "team-a",
+			id:             "w1",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []string{"a1"},
+		},
+		{
+			name:           "Other client can't see the watchlist",
+			clientID:       "team-b",
+			id:             "w1",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Unknown watchlist",
+			clientID:       "team-a",
+			id:             "missing",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/watchlists/"+tt.id+"/news", nil)
+			req = withAPIKey(req, models.APIKey{ClientID: tt.clientID})
+			rr := httptest.NewRecorder()
+
+			GetWatchlistNews(rr, req, tt.id, cache)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var articles []models.NewsArticle
+			if err := json.NewDecoder(rr.Body).Decode(&articles); err != nil {
+				t.Fatalf("could not decode articles: %v", err)
+			}
+			if len(articles) != len(tt.expectedIDs) {
+				t.Fatalf("expected %d articles, got %d", len(tt.expectedIDs), len(articles))
+			}
+			for i, id := range tt.expectedIDs {
+				if articles[i].ID != id || len(articles[i].Mentions) == 0 {
+					t.Errorf("expected article %s flagged with mentions, got %+v", id, articles[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"devbriefs-news/datastore"
+	"devbriefs-news/delivery"
+	"devbriefs-news/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookRequest is the body expected when registering a webhook, a secret is generated when none is given
+type webhookRequest struct {
+	URL    string               `json:"url"`
+	Secret string               `json:"secret"`
+	Filter models.WebhookFilter `json:"filter"`
+}
+
+// CreateWebhook registers a webhook owned by the requesting API client. The response is the only time the secret is
+// returned.
+func CreateWebhook(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	owner := clientID(r)
+	if owner == "" {
+		writeError(w, r, "missing API key", http.StatusUnauthorized)
+		return
+	}
+
+	var body webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, fmt.Sprintf("invalid webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(body.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		writeError(w, r, fmt.Sprintf("invalid webhook url %q, expected an absolute http(s) url", body.URL), http.StatusBadRequest)
+		return
+	}
+	if err = delivery.CheckWebhookHost(u.Hostname()); err != nil {
+		writeError(w, r, fmt.Sprintf("invalid webhook url %q: %v", body.URL, err), http.StatusBadRequest)
+		return
+	}
+	for _, id := range body.Filter.Watchlists {
+		if watchlist, err := datastore.GetWatchlist(r.Context(), cache, id); err != nil || watchlist.ClientID != owner {
+			writeError(w, r, fmt.Sprintf("watchlist %s not found", id), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if body.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body.Secret = hex.EncodeToString(secret)
+	}
+
+	webhook := models.Webhook{
+		ID:        uuid.NewString(),
+		ClientID:  owner,
+		URL:       body.URL,
+		Secret:    body.Secret,
+		Filter:    body.Filter,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = datastore.SetWebhook(r.Context(), cache, webhook); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, webhook)
+}
+
+// ListWebhooks writes the webhooks owned by the requesting API client, without their secrets
+func ListWebhooks(w http.ResponseWriter, r *http.Request, cache datastore.Cache) {
+	owner := clientID(r)
+	if owner == "" {
+		writeError(w, r, "missing API key", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := datastore.GetWebhooks(r.Context(), cache)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	owned := make([]models.Webhook, 0)
+	for _, webhook := range webhooks {
+		if webhook.ClientID == owner {
+			webhook.Secret = ""
+			owned = append(owned, webhook)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, owned)
+}
+
+// DeleteWebhook removes a webhook owned by the requesting API client
+func DeleteWebhook(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	if _, ok := ownedWebhook(w, r, id, cache); !ok {
+		return
+	}
+	if err := datastore.RemoveWebhook(r.Context(), cache, id); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries writes the delivery log of a webhook owned by the requesting API client
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) {
+	if _, ok := ownedWebhook(w, r, id, cache); !ok {
+		return
+	}
+	deliveries, err := datastore.GetWebhookDeliveries(r.Context(), cache, id)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, deliveries)
+}
+
+// ownedWebhook loads a webhook, writing a 404 when it doesn't exist or belongs to another API client
+func ownedWebhook(w http.ResponseWriter, r *http.Request, id string, cache datastore.Cache) (models.Webhook, bool) {
+	webhook, err := datastore.GetWebhook(r.Context(), cache, id)
+	if errors.Is(err, datastore.ErrNotFound) || (err == nil && webhook.ClientID != clientID(r)) {
+		writeError(w, r, fmt.Sprintf("webhook %s not found", id), http.StatusNotFound)
+		return webhook, false
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return webhook, false
+	}
+	return webhook, true
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"devbriefs-news/broker"
+	"devbriefs-news/models"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// message types of the live feed protocol, see LiveFeed
+const (
+	msgSubscribe   = "subscribe"
+	msgUnsubscribe = "unsubscribe"
+	msgAck         = "ack"
+	msgPing        = "ping"
+	msgSubscribed  = "subscribed"
+	msgArticle     = "article"
+	msgPong        = "pong"
+	msgError       = "error"
+)
+
+const (
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingPeriod   = wsPongWait * 9 / 10
+	wsMaxMessage   = 4096
+	wsIncomingSize = 16
+)
+
+// liveMessage is the JSON message exchanged over the live feed in both directions, only the fields relevant to its type
+// are set
+type liveMessage struct {
+	Type        string              `json:"type"`
+	Topics      []string            `json:"topics,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	LastEventID uint64              `json:"lastEventId,omitempty"` // subscribe: resume after this event
+	EventID     uint64              `json:"eventId,omitempty"`     // article: the event ID, ack: the last event processed
+	Article     *models.NewsArticle `json:"article,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// LiveFeed serves the articles ingested by the fetch pipeline over WebSocket, with a small JSON protocol:
+//
+//   - {"type":"subscribe","topics":["hacking"],"tags":["ransomware"],"lastEventId":42} adds topics and tags to the
+//     subscription, an empty subscribe receives every article. The server answers with the resulting "subscribed"
+//     filter, then sends {"type":"article","eventId":43,"article":{...}} for each matching article.
+//   - {"type":"unsubscribe","topics":["hacking"]} removes topics and tags, an empty unsubscribe stops every article.
+//   - {"type":"ack","eventId":43} acknowledges the articles up to an event. A client with more than MaxUnacked articles
+//     unacknowledged, or lagging behind the broker, is dropped with a 1008 close code and can resume with lastEventId.
+//   - {"type":"ping"} is answered with {"type":"pong"}.
+type LiveFeed struct {
+	MaxConnections          int // The total number of connections, further upgrades get 503 Service Unavailable
+	MaxConnectionsPerClient int // The number of connections per client, further upgrades get 429 Too Many Requests
+	MaxUnacked              int // The number of articles a client can have in flight before being dropped
+
+	broker   *broker.Broker
+	upgrader websocket.Upgrader
+
+	mu          sync.Mutex
+	connections map[string]int
+	total       int
+}
+
+// NewLiveFeed returns a live feed of the articles published by a broker
+func NewLiveFeed(b *broker.Broker) *LiveFeed {
+	return &LiveFeed{
+		MaxConnections:          1000,
+		MaxConnectionsPerClient: 5,
+		MaxUnacked:              256,
+		broker:                  b,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+		},
+		connections: make(map[string]int),
+	}
+}
+
+// ServeWS upgrades the request to a WebSocket and serves the live feed until either side closes it. Connections are
+// counted per API client, or per remoteIP when the client didn't identify itself.
+func (l *LiveFeed) ServeWS(w http.ResponseWriter, r *http.Request, remoteIP string) {
+	client := clientID(r)
+	if client == "" {
+		client = remoteIP
+	}
+	if status := l.acquire(client); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer l.release(client)
+
+	// the upgrader already wrote an error response when failing
+	conn, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	l.serve(conn)
+}
+
+// Connections returns the number of open connections
+func (l *LiveFeed) Connections() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// acquire counts a new connection of a client, returning the status to reject it with when over a limit
+func (l *LiveFeed) acquire(client string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.total >= l.MaxConnections {
+		return http.StatusServiceUnavailable
+	}
+	if l.connections[client] >= l.MaxConnectionsPerClient {
+		return http.StatusTooManyRequests
+	}
+	l.total++
+	l.connections[client]++
+	return 0
+}
+
+func (l *LiveFeed) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.connections[client]--; l.connections[client] <= 0 {
+		delete(l.connections, client)
+	}
+}
+
+// serve runs the protocol of a connection. Messages are read by their own goroutine and everything else, writes
+// included, happens here, as a WebSocket connection supports one concurrent reader and one concurrent writer.
+func (l *LiveFeed) serve(conn *websocket.Conn) {
+	incoming := make(chan liveMessage, wsIncomingSize)
+	done := make(chan struct{})
+	defer close(done)
+	go readLiveMessages(conn, incoming, done)
+
+	var (
+		sub      *broker.Subscription
+		events   <-chan broker.Event // nil, so never ready, while unsubscribed
+		filter   broker.Filter
+		inFlight []uint64 // the IDs of the articles sent and not acknowledged yet
+	)
+	defer func() {
+		if sub != nil {
+			sub.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var reply *liveMessage
+		select {
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			switch msg.Type {
+			case msgSubscribe:
+				filter.Topics = union(filter.Topics, msg.Topics)
+				filter.Tags = union(filter.Tags, msg.Tags)
+				if len(msg.Topics) == 0 && len(msg.Tags) == 0 {
+					filter = broker.Filter{}
+				}
+				var missed []broker.Event
+				if sub == nil {
+					sub, missed = l.broker.Subscribe(filter, msg.LastEventID)
+					events = sub.Events()
+				} else {
+					sub.SetFilter(filter)
+				}
+				if err := writeLiveMessage(conn, liveMessage{Type: msgSubscribed, Topics: filter.Topics, Tags: filter.Tags}); err != nil {
+					return
+				}
+				for _, event := range missed {
+					if !l.sendArticle(conn, event, &inFlight) {
+						return
+					}
+				}
+				continue
+			case msgUnsubscribe:
+				filter.Topics = difference(filter.Topics, msg.Topics)
+				filter.Tags = difference(filter.Tags, msg.Tags)
+				if (len(msg.Topics) == 0 && len(msg.Tags) == 0) || (len(filter.Topics) == 0 && len(filter.Tags) == 0) {
+					filter = broker.Filter{}
+					if sub != nil {
+						sub.Close()
+					}
+					sub, events, inFlight = nil, nil, nil
+				} else if sub != nil {
+					sub.SetFilter(filter)
+				}
+				reply = &liveMessage{Type: msgSubscribed, Topics: filter.Topics, Tags: filter.Tags}
+			case msgAck:
+				// acks are cumulative, and sent IDs increase
+				acked := 0
+				for acked < len(inFlight) && inFlight[acked] <= msg.EventID {
+					acked++
+				}
+				inFlight = inFlight[acked:]
+				continue
+			case msgPing:
+				reply = &liveMessage{Type: msgPong}
+			default:
+				reply = &liveMessage{Type: msgError, Error: "unknown message type " + msg.Type}
+			}
+		case event, ok := <-events:
+			if !ok {
+				closeSlowConsumer(conn)
+				return
+			}
+			if !l.sendArticle(conn, event, &inFlight) {
+				return
+			}
+			continue
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		if err := writeLiveMessage(conn, *reply); err != nil {
+			return
+		}
+	}
+}
+
+// sendArticle writes an article event, returning false when the connection should be closed, either because writing
+// failed or because the client has too many articles unacknowledged
+func (l *LiveFeed) sendArticle(conn *websocket.Conn, event broker.Event, inFlight *[]uint64) bool {
+	if len(*inFlight) >= l.MaxUnacked {
+		closeSlowConsumer(conn)
+		return false
+	}
+	article := event.Article
+	if err := writeLiveMessage(conn, liveMessage{Type: msgArticle, EventID: event.ID, Article: &article}); err != nil {
+		return false
+	}
+	*inFlight = append(*inFlight, event.ID)
+	return true
+}
+
+// readLiveMessages reads the messages of a client until the connection fails or done is closed, then closes incoming.
+// A message that isn't valid JSON ends the connection.
+func readLiveMessages(conn *websocket.Conn, incoming chan<- liveMessage, done <-chan struct{}) {
+	defer close(incoming)
+	conn.SetReadLimit(wsMaxMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg liveMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		// any message shows the client is alive, not only pongs
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		select {
+		case incoming <- msg:
+		case <-done:
+			return
+		}
+	}
+}
+
+func writeLiveMessage(conn *websocket.Conn, msg liveMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(msg)
+}
+
+func closeSlowConsumer(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer, resume with lastEventId")
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+}
+
+// union returns list with the items of add it doesn't contain yet, ignoring case
+func union(list, add []string) []string {
+	for _, item := range add {
+		if !slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, item) }) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// difference returns list without the items of remove, ignoring case
+func difference(list, remove []string) []string {
+	var kept []string
+	for _, item := range list {
+		if !slices.ContainsFunc(remove, func(s string) bool { return strings.EqualFold(s, item) }) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
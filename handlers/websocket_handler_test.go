@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"devbriefs-news/broker"
+	"devbriefs-news/models"
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialLiveFeed starts a live feed server and connects a client to it
+func dialLiveFeed(t *testing.T, feed *LiveFeed) (*websocket.Conn, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed.ServeWS(w, r, "192.0.2.1")
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial live feed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, server
+}
+
+func exchange(t *testing.T, conn *websocket.Conn, msg liveMessage) liveMessage {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatalf("failed to write %s: %v", msg.Type, err)
+	}
+	return readLiveMessage(t, conn)
+}
+
+func readLiveMessage(t *testing.T, conn *websocket.Conn) liveMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg liveMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return msg
+}
+
+// waitForSubscribers waits until the broker has n subscribers, as the server subscribes asynchronously
+func waitForSubscribers(t *testing.T, b *broker.Broker, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, b.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLiveFeedProtocol(t *testing.T) {
+	b := broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize)
+	b.Publish([]models.NewsArticle{{ID: "a1", Topic: "hacking"}, {ID: "a2", Topic: "hacking"}})
+	conn, _ := dialLiveFeed(t, NewLiveFeed(b))
+
+	if msg := exchange(t, conn, liveMessage{Type: msgPing}); msg.Type != msgPong {
+		t.Errorf("expected a pong, got %+v", msg)
+	}
+
+	msg := exchange(t, conn, liveMessage{Type: msgSubscribe, Topics: []string{"hacking"}, LastEventID: 1})
+	if msg.Type != msgSubscribed || len(msg.Topics) != 1 || msg.Topics[0] != "hacking" {
+		t.Errorf("expected to be subscribed to hacking, got %+v", msg)
+	}
+	if msg = readLiveMessage(t, conn); msg.Type != msgArticle || msg.EventID != 2 || msg.Article.ID != "a2" {
+		t.Errorf("expected a2 to be replayed, got %+v", msg)
+	}
+
+	b.Publish([]models.NewsArticle{{ID: "a3", Topic: "linux"}, {ID: "a4", Topic: "hacking"}})
+	if msg = readLiveMessage(t, conn); msg.Type != msgArticle || msg.Article.ID != "a4" {
+		t.Errorf("expected a4 to be pushed, got %+v", msg)
+	}
+
+	msg = exchange(t, conn, liveMessage{Type: msgUnsubscribe, Topics: []string{"hacking"}})
+	if msg.Type != msgSubscribed || len(msg.Topics) != 0 {
+		t.Errorf("expected to be unsubscribed, got %+v", msg)
+	}
+	waitForSubscribers(t, b, 0)
+
+	if msg = exchange(t, conn, liveMessage{Type: "publish"}); msg.Type != msgError {
+		t.Errorf("expected an error for an unknown message type, got %+v", msg)
+	}
+}
+
+func TestLiveFeedDropsSlowConsumers(t *testing.T) {
+	b := broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize)
+	feed := NewLiveFeed(b)
+	feed.MaxUnacked = 2
+	conn, _ := dialLiveFeed(t, feed)
+
+	exchange(t, conn, liveMessage{Type: msgSubscribe})
+	b.Publish([]models.NewsArticle{{ID: "a1"}, {ID: "a2"}})
+	readLiveMessage(t, conn)
+	if msg := readLiveMessage(t, conn); msg.EventID != 2 {
+		t.Fatalf("expected event 2, got %+v", msg)
+	}
+
+	// acknowledging makes room for one more article
+	if err := conn.WriteJSON(liveMessage{Type: msgAck, EventID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, conn, liveMessage{Type: msgPing})
+	b.Publish([]models.NewsArticle{{ID: "a3"}})
+	if msg := readLiveMessage(t, conn); msg.EventID != 3 {
+		t.Fatalf("expected event 3, got %+v", msg)
+	}
+
+	b.Publish([]models.NewsArticle{{ID: "a4"}})
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("expected the connection to be closed with a policy violation, got %v", err)
+	}
+}
+
+func TestLiveFeedConnectionLimits(t *testing.T) {
+	tests := []struct {
+		name                    string
+		maxConnections          int
+		maxConnectionsPerClient int
+		expectedStatus          int
+	}{
+		{name: "Total limit", maxConnections: 1, maxConnectionsPerClient: 5, expectedStatus: http.StatusServiceUnavailable},
+		{name: "Client limit", maxConnections: 5, maxConnectionsPerClient: 1, expectedStatus: http.StatusTooManyRequests},
+		{name: "Under the limits", maxConnections: 5, maxConnectionsPerClient: 5, expectedStatus: http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := NewLiveFeed(broker.NewBroker(broker.DefaultReplaySize, broker.DefaultBufferSize))
+			feed.MaxConnections = tt.maxConnections
+			feed.MaxConnectionsPerClient = tt.maxConnectionsPerClient
+			_, server := dialLiveFeed(t, feed)
+
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err == nil {
+				conn.Close()
+			}
+			if resp == nil || resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %v, got %v (%v)", tt.expectedStatus, resp, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package health
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/trustedproxy"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Thresholds from which a dependency is degraded or failed
+type Thresholds struct {
+	FetchDegradedAfter time.Duration // The age of the last successful fetch of a topic from which it's degraded
+	FetchFailedAfter   time.Duration // and failed
+	QuotaDegradedBelow int64         // The calls left in the budget of an upstream provider below which it's degraded
+	QuotaFailedBelow   int64         // and failed
+}
+
+// DefaultThresholds tolerate missing one daily refresh, and consider an upstream degraded once ad-hoc fetches are
+// served from cache (with the default reserve of 10 calls) but never failed, as the cached articles are still served
+var DefaultThresholds = Thresholds{
+	FetchDegradedAfter: 26 * time.Hour,
+	FetchFailedAfter:   72 * time.Hour,
+	QuotaDegradedBelow: 10,
+	QuotaFailedBelow:   0,
+}
+
+// Pinger is a dependency that can be pinged, e.g. datastore.RedisCache
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Redis fails while Redis can't be pinged
+func Redis(pinger Pinger) Check {
+	return func(ctx context.Context) Result {
+		start := time.Now()
+		if err := pinger.Ping(ctx); err != nil {
+			return Result{Status: StatusFailed, Message: err.Error()}
+		}
+		return Result{Status: StatusOK, Details: map[string]any{"latency": time.Since(start).String()}}
+	}
+}
+
+// Fetch checks the age of the last successful fetch of a topic, see datastore.RecordFetch. A topic never fetched is
+// degraded, as it is right after the first deployment until the daily refresh runs, and so is a topic never fetched
+// successfully until FetchFailedAfter has passed since its first failure.
+func Fetch(cache datastore.Cache, topic string, thresholds Thresholds) Check {
+	return func(ctx context.Context) Result {
+		status, err := datastore.GetFetchStatus(ctx, cache, topic)
+		if errors.Is(err, datastore.ErrNotFound) {
+			return Result{Status: StatusDegraded, Message: "never fetched"}
+		}
+		if err != nil {
+			return Result{Status: StatusFailed, Message: err.Error()}
+		}
+
+		details := map[string]any{"provider": status.Provider}
+		failedSince := status.LastFailure != nil && (status.LastSuccess == nil || status.LastFailure.After(*status.LastSuccess))
+		if failedSince {
+			details["lastFailure"] = status.LastFailure
+			details["lastError"] = status.LastError
+		}
+		if status.LastSuccess == nil {
+			result := Result{Status: StatusDegraded, Message: "never fetched successfully", Details: details}
+			if status.FirstFailure != nil {
+				details["firstFailure"] = status.FirstFailure
+				if time.Since(*status.FirstFailure) >= thresholds.FetchFailedAfter {
+					result.Status = StatusFailed
+				}
+			}
+			return result
+		}
+
+		age := time.Since(*status.LastSuccess)
+		details["lastSuccess"] = status.LastSuccess
+		details["age"] = age.Round(time.Second).String()
+		result := Result{Status: StatusOK, Details: details}
+		switch {
+		case age >= thresholds.FetchFailedAfter:
+			result.Status, result.Message = StatusFailed, fmt.Sprintf("last successful fetch is older than %s", thresholds.FetchFailedAfter)
+		case age >= thresholds.FetchDegradedAfter:
+			result.Status, result.Message = StatusDegraded, fmt.Sprintf("last successful fetch is older than %s", thresholds.FetchDegradedAfter)
+		case failedSince:
+			result.Status, result.Message = StatusDegraded, "last fetch failed"
+		}
+		return result
+	}
+}
+
+// CloudflareRanges checks the trusted proxy ranges are loaded, and were fetched within staleAfter. Without them every
+// client IP is Cloudflare's, so the check fails when required, i.e. when requests not coming through Cloudflare are
+// rejected, and is only degraded otherwise.
+func CloudflareRanges(manager *trustedproxy.Manager, required bool, staleAfter time.Duration) Check {
+	return func(context.Context) Result {
+		ranges := manager.Ranges()
+		if len(ranges.IPv4) == 0 && len(ranges.IPv6) == 0 {
+			status := StatusDegraded
+			if required {
+				status = StatusFailed
+			}
+			return Result{Status: status, Message: "cloudflare ranges not loaded"}
+		}
+
+		result := Result{Status: StatusOK, Details: map[string]any{
+			"ipv4":    len(ranges.IPv4),
+			"ipv6":    len(ranges.IPv6),
+			"fetched": ranges.Fetched,
+		}}
+		if time.Since(ranges.Fetched) >= staleAfter {
+			result.Status, result.Message = StatusDegraded, fmt.Sprintf("cloudflare ranges are older than %s", staleAfter)
+		}
+		return result
+	}
+}
+
+// UpstreamQuota checks the calls left today in the budget of every upstream provider
+func UpstreamQuota(accountant *services.QuotaAccountant, thresholds Thresholds) Check {
+	return func(ctx context.Context) Result {
+		statuses, err := accountant.Status(ctx)
+		if err != nil {
+			return Result{Status: StatusFailed, Message: err.Error()}
+		}
+
+		result := Result{Status: StatusOK, Details: make(map[string]any, len(statuses))}
+		for _, status := range statuses {
+			result.Details[status.Provider] = map[string]any{
+				"remaining": status.Remaining,
+				"limit":     status.Limit,
+				"reset":     status.Reset,
+			}
+			switch {
+			case status.Remaining < thresholds.QuotaFailedBelow:
+				result.Status, result.Message = StatusFailed, fmt.Sprintf("%s budget below %d calls", status.Provider, thresholds.QuotaFailedBelow)
+			case status.Remaining < thresholds.QuotaDegradedBelow && result.Status == StatusOK:
+				result.Status, result.Message = StatusDegraded, fmt.Sprintf("%s budget below %d calls", status.Provider, thresholds.QuotaDegradedBelow)
+			}
+		}
+		return result
+	}
+}
+
+// Circuits checks the circuit breakers of the upstream providers, degraded while one isn't closed as its fetches fail
+// fast, but not failed as cached articles are still served
+func Circuits(breakers ...*resilience.Breaker) Check {
+	return func(context.Context) Result {
+		result := Result{Status: StatusOK, Details: make(map[string]any, len(breakers))}
+		for _, breaker := range breakers {
+			state, until := breaker.State()
+			details := map[string]any{"state": state.String()}
+			if state == resilience.StateOpen {
+				details["until"] = until
+			}
+			result.Details[breaker.Provider()] = details
+			if state != resilience.StateClosed {
+				result.Status, result.Message = StatusDegraded, fmt.Sprintf("%s circuit %s", breaker.Provider(), state)
+			}
+		}
+		return result
+	}
+}
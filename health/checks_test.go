@@ -0,0 +1,157 @@
+package health
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/trustedproxy"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) Ping(context.Context) error {
+	return p.err
+}
+
+func TestRedis(t *testing.T) {
+	if result := Redis(fakePinger{})(context.Background()); result.Status != StatusOK {
+		t.Errorf("expected ok, got %s", result.Status)
+	}
+	if result := Redis(fakePinger{err: errors.New("connection refused")})(context.Background()); result.Status != StatusFailed {
+		t.Errorf("expected failed, got %s", result.Status)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	thresholds := Thresholds{FetchDegradedAfter: 26 * time.Hour, FetchFailedAfter: 72 * time.Hour}
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		fetches        []error     // the outcome of each fetch
+		ages           []time.Time // and when it happened
+		expectedStatus Status
+	}{
+		{name: "Never fetched", expectedStatus: StatusDegraded},
+		{name: "Fresh", fetches: []error{nil}, ages: []time.Time{now.Add(-time.Hour)}, expectedStatus: StatusOK},
+		{name: "Stale", fetches: []error{nil}, ages: []time.Time{now.Add(-30 * time.Hour)}, expectedStatus: StatusDegraded},
+		{name: "Too old", fetches: []error{nil}, ages: []time.Time{now.Add(-80 * time.Hour)}, expectedStatus: StatusFailed},
+		{
+			name:           "Failing since the last success",
+			fetches:        []error{nil, errors.New("HTTP request failed with status code 401")},
+			ages:           []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Hour)},
+			expectedStatus: StatusDegraded,
+		},
+		{name: "Never succeeded yet", fetches: []error{errors.New("apiKeyInvalid")}, ages: []time.Time{now}, expectedStatus: StatusDegraded},
+		{
+			name:           "Never succeeded since the first failure",
+			fetches:        []error{errors.New("apiKeyInvalid"), errors.New("apiKeyInvalid")},
+			ages:           []time.Time{now.Add(-80 * time.Hour), now.Add(-time.Hour)},
+			expectedStatus: StatusFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := datastore.NewMemoryCache()
+			for i, err := range tt.fetches {
+				if recordErr := datastore.RecordFetch(ctx, cache, services.TopicHacking, "newsapi", tt.ages[i], err); recordErr != nil {
+					t.Fatal(recordErr)
+				}
+			}
+
+			result := Fetch(cache, services.TopicHacking, thresholds)(ctx)
+
+			if result.Status != tt.expectedStatus {
+				t.Errorf("expected status %s, got %s (%s)", tt.expectedStatus, result.Status, result.Message)
+			}
+		})
+	}
+}
+
+// cloudflareClient serves a fixed list of Cloudflare ranges
+type cloudflareClient struct{}
+
+func (cloudflareClient) Do(*http.Request) (*http.Response, error) {
+	body := `{"result":{"ipv4_cidrs":["173.245.48.0/20"],"ipv6_cidrs":["2400:cb00::/32"]},"success":true}`
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestCloudflareRanges(t *testing.T) {
+	ctx := context.Background()
+	manager := trustedproxy.NewManager(cloudflareClient{}, trustedproxy.CloudflareIPsURL, "")
+
+	if result := CloudflareRanges(manager, false, time.Hour)(ctx); result.Status != StatusDegraded {
+		t.Errorf("expected unloaded ranges degraded, got %s", result.Status)
+	}
+	if result := CloudflareRanges(manager, true, time.Hour)(ctx); result.Status != StatusFailed {
+		t.Errorf("expected unloaded ranges failed when required, got %s", result.Status)
+	}
+
+	if err := manager.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if result := CloudflareRanges(manager, true, time.Hour)(ctx); result.Status != StatusOK {
+		t.Errorf("expected loaded ranges ok, got %s", result.Status)
+	}
+	if result := CloudflareRanges(manager, true, 0)(ctx); result.Status != StatusDegraded {
+		t.Errorf("expected stale ranges degraded, got %s", result.Status)
+	}
+}
+
+func TestUpstreamQuota(t *testing.T) {
+	ctx := context.Background()
+	thresholds := Thresholds{QuotaDegradedBelow: 3, QuotaFailedBelow: 1}
+
+	tests := []struct {
+		name           string
+		calls          int
+		expectedStatus Status
+	}{
+		{name: "Plenty left", calls: 0, expectedStatus: StatusOK},
+		{name: "Running low", calls: 3, expectedStatus: StatusDegraded},
+		{name: "Exhausted", calls: 5, expectedStatus: StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountant := services.NewQuotaAccountant(datastore.NewMemoryCache(), map[string]services.Budget{"newsapi": {Limit: 5}})
+			for range tt.calls {
+				if err := accountant.Acquire(services.WithPriority(ctx, services.PriorityScheduled), "newsapi"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result := UpstreamQuota(accountant, thresholds)(ctx)
+
+			if result.Status != tt.expectedStatus {
+				t.Errorf("expected status %s, got %s (%s)", tt.expectedStatus, result.Status, result.Message)
+			}
+		})
+	}
+}
+
+func TestCircuits(t *testing.T) {
+	breaker := resilience.NewBreaker("newsapi", resilience.BreakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	check := Circuits(breaker)
+	if result := check(context.Background()); result.Status != StatusOK {
+		t.Errorf("expected ok, got %s", result.Status)
+	}
+
+	breaker.Failure()
+	result := check(context.Background())
+	if result.Status != StatusDegraded {
+		t.Errorf("expected degraded, got %s", result.Status)
+	}
+	if result.Message != "newsapi circuit open" {
+		t.Errorf("expected the open circuit in the message, got %q", result.Message)
+	}
+}
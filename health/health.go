@@ -0,0 +1,106 @@
+// Package health checks the dependencies of our service for the liveness and readiness probes of the orchestrator
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status of a dependency, or of the whole service, from best to worst
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // Working, but not as it should, e.g. serving stale articles
+	StatusFailed   Status = "failed"   // Not working, the instance shouldn't receive traffic
+)
+
+// DefaultCheckTimeout bounds how long a single check can take
+const DefaultCheckTimeout = 2 * time.Second
+
+var severity = map[Status]int{StatusOK: 0, StatusDegraded: 1, StatusFailed: 2}
+
+// Result is the outcome of checking a dependency
+type Result struct {
+	Name    string         `json:"name"`
+	Status  Status         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Report is the status of the service, the worst of its dependencies
+type Report struct {
+	Status    Status    `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Check checks a dependency, its Result's Name is filled in by the Checker
+type Check func(ctx context.Context) Result
+
+// Checker runs the checks of every dependency
+type Checker struct {
+	checks  map[string]Check
+	timeout time.Duration
+	now     func() time.Time
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		checks:  make(map[string]Check),
+		timeout: timeout,
+		now:     time.Now,
+	}
+}
+
+// Register adds the check of a dependency, it must be called before Run
+func (c *Checker) Register(name string, check Check) {
+	c.checks[name] = check
+}
+
+// Run runs every check concurrently, each bounded by the timeout of the Checker, and returns them sorted by name. A
+// check timing out fails.
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make([]Result, 0, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			result.Name = name
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{Status: StatusOK, CheckedAt: c.now().UTC(), Checks: results}
+	for _, result := range results {
+		if severity[result.Status] > severity[report.Status] {
+			report.Status = result.Status
+		}
+	}
+	return report
+}
+
+// run runs a check, failing it once the timeout elapses even if the check itself ignores its context
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan Result, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return Result{Status: StatusFailed, Message: "check timed out"}
+	}
+}
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func staticCheck(status Status) Check {
+	return func(context.Context) Result {
+		return Result{Status: status}
+	}
+}
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name           string
+		checks         map[string]Check
+		expectedStatus Status
+	}{
+		{name: "Healthy", checks: map[string]Check{"a": staticCheck(StatusOK), "b": staticCheck(StatusOK)}, expectedStatus: StatusOK},
+		{name: "Degraded", checks: map[string]Check{"a": staticCheck(StatusDegraded), "b": staticCheck(StatusOK)}, expectedStatus: StatusDegraded},
+		{name: "Failed", checks: map[string]Check{"a": staticCheck(StatusDegraded), "b": staticCheck(StatusFailed)}, expectedStatus: StatusFailed},
+		{name: "Timed out", checks: map[string]Check{"a": func(context.Context) Result {
+			time.Sleep(time.Second)
+			return Result{Status: StatusOK}
+		}}, expectedStatus: StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(50 * time.Millisecond)
+			for name, check := range tt.checks {
+				checker.Register(name, check)
+			}
+
+			report := checker.Run(context.Background())
+
+			if report.Status != tt.expectedStatus {
+				t.Errorf("expected status %s, got %s", tt.expectedStatus, report.Status)
+			}
+			if len(report.Checks) != len(tt.checks) || report.Checks[0].Name != "a" {
+				t.Errorf("expected every check named and sorted, got %+v", report.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package logging sets up our structured logger, and the fields and redaction shared by every package logging with it
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Formats of the logs
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Keys of the fields our logs share
+const (
+	KeyRequestID = "request_id"
+	KeyTraceID   = "trace_id"
+	KeyTopic     = "topic"
+	KeyProvider  = "provider"
+	KeyArticleID = "article_id"
+	KeyDuration  = "duration"
+	KeyError     = "error"
+)
+
+// redacted replaces the values of sensitiveParams in logged URLs
+const redacted = "REDACTED"
+
+// sensitiveParams are the query parameters carrying credentials of upstream providers, e.g. apiKey
+var sensitiveParams = []string{"apikey", "api_key", "key", "token"}
+
+// New creates a logger writing records of level and above to w, in format. Records logged with a context carry the
+// request and trace IDs in it.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr}
+	var handler slog.Handler
+	switch format {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %q or %q", format, FormatJSON, FormatText)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel parses a level name (debug, info, warn or error), empty meaning info
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return level, nil
+	}
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// replaceAttr logs durations in milliseconds, e.g. "duration":12.5, rather than in nanoseconds
+func replaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindDuration {
+		return slog.Float64(attr.Key, float64(attr.Value.Duration())/float64(time.Millisecond))
+	}
+	return attr
+}
+
+// contextHandler adds the request and trace IDs of the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		record.AddAttrs(slog.String(KeyTraceID, spanContext.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestIDCtxKey struct{}
+
+// WithRequestID returns a copy of ctx carrying a request ID, logged with every record logged with it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// Err is the error field of a record, with the credentials of any URL in its message redacted
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Any(KeyError, nil)
+	}
+	return slog.String(KeyError, RedactError(err).Error())
+}
+
+// RedactURL replaces the values of the query parameters carrying credentials, e.g. apiKey, so the URL can be logged
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	changed := false
+	for param := range query {
+		if isSensitive(param) {
+			query.Set(param, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// RedactError redacts the URL of a *url.Error, which net/http returns with the whole URL requested in its message
+func RedactError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	redactedURL := RedactURL(urlErr.URL)
+	if redactedURL == urlErr.URL {
+		return err
+	}
+	if err == error(urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: redactedURL, Err: urlErr.Err}
+	}
+	// the message of err may wrap the url.Error in more context, keep it but with the URL redacted
+	return &redactedError{msg: strings.ReplaceAll(err.Error(), urlErr.URL, redactedURL), err: err}
+}
+
+// redactedError is an error whose message had its URLs redacted, unwrapping to the original
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+func isSensitive(param string) bool {
+	for _, sensitive := range sensitiveParams {
+		if strings.EqualFold(param, sensitive) {
+			return true
+		}
+	}
+	return false
+}
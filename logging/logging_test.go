@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{
+			url:      "https://newsapi.org/v2/everything?q=hacker&apiKey=secret",
+			expected: "https://newsapi.org/v2/everything?apiKey=REDACTED&q=hacker",
+		},
+		{url: "https://example.com/?API_KEY=secret", expected: "https://example.com/?API_KEY=REDACTED"},
+		{url: "https://example.com/?q=hacker", expected: "https://example.com/?q=hacker"},
+		{url: "https://example.com/feed", expected: "https://example.com/feed"},
+	}
+	for _, tt := range tests {
+		if got := RedactURL(tt.url); got != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	urlErr := &url.Error{Op: "Get", URL: "https://newsapi.org/v2/everything?apiKey=secret", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "URL error", err: urlErr},
+		{name: "Wrapped URL error", err: fmt.Errorf("error making HTTP request: %w", urlErr)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RedactError(tt.err)
+			if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "apiKey=REDACTED") {
+				t.Errorf("expected the key redacted, got %v", err)
+			}
+			var redactedURLErr *url.Error
+			if !errors.As(err, &redactedURLErr) {
+				t.Error("expected the url.Error kept in the chain")
+			}
+		})
+	}
+
+	other := errors.New("timeout")
+	if RedactError(other) != other {
+		t.Error("expected errors without URL left as is")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+
+	var out bytes.Buffer
+	logger, err := New(&out, FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "req-1"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	logger.DebugContext(ctx, "filtered out")
+	logger.InfoContext(ctx, "fetched", KeyDuration, 1500*time.Microsecond,
+		Err(errors.New(`Get "https://newsapi.org/v2/everything?apiKey=secret": timeout`)))
+
+	var record map[string]any
+	if err = json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %s", out.String())
+	}
+	expected := map[string]any{
+		"msg":        "fetched",
+		KeyRequestID: "req-1",
+		KeyTraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		KeyDuration:  1.5,
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    slog.Level
+		expectedErr bool
+	}{
+		{name: "", expected: slog.LevelInfo},
+		{name: "debug", expected: slog.LevelDebug},
+		{name: "WARN", expected: slog.LevelWarn},
+		{name: "verbose", expectedErr: true},
+	}
+	for _, tt := range tests {
+		level, err := ParseLevel(tt.name)
+		if (err != nil) != tt.expectedErr {
+			t.Errorf("%q: expected error %v, got %v", tt.name, tt.expectedErr, err)
+		}
+		if err == nil && level != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.name, tt.expected, level)
+		}
+	}
+}
@@ -3,60 +3,263 @@ package main
 import (
 	"context"
 	"devbriefs-news/api"
+	"devbriefs-news/app"
 	"devbriefs-news/datastore"
+	"devbriefs-news/delivery"
+	"devbriefs-news/grpcserver"
 	"devbriefs-news/handlers"
+	"devbriefs-news/health"
+	"devbriefs-news/logging"
+	"devbriefs-news/metrics"
 	"devbriefs-news/models"
-	"encoding/json"
+	"devbriefs-news/ratelimit"
+	"devbriefs-news/resilience"
+	"devbriefs-news/services"
+	"devbriefs-news/tracing"
+	"devbriefs-news/trustedproxy"
+	"devbriefs-news/upstream"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/semper-proficiens/go-utils/system/config"
 	utilTime "github.com/semper-proficiens/go-utils/system/time"
-	"github.com/semper-proficiens/go-utils/web/jsonhandler"
-	"github.com/semper-proficiens/go-utils/web/securehttp"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
 	"time"
 )
 
-const cloudFlareAPI = "https://api.cloudflare.com/client/v4/ips"
+// dailyRoutineRetryDelay is how long the daily routine waits before fetching again after a failed fetch
+const dailyRoutineRetryDelay = 15 * time.Minute
 
 func main() {
 	// Load configuration
 	envVars := config.LoadEnvVars()
-	googleAPIKey := envVars["GOOGLE_NEWS_API_KEY"]
-
-	// let's instantiate our custom secure client
-	sc, err := securehttp.NewSecureHTTPClient()
+	// logs are JSON by default, LOG_FORMAT=text is easier to read locally
+	logFormat := envVars["LOG_FORMAT"]
+	if logFormat == "" {
+		logFormat = logging.FormatJSON
+	}
+	logLevel, err := logging.ParseLevel(envVars["LOG_LEVEL"])
 	if err != nil {
-		log.Fatalf("failed to create secure http client: %v", err)
+		fatal("failed to load LOG_LEVEL", err)
 	}
+	logger, err := logging.New(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		fatal("failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
 
-	// pass key and secure client to our google-news api
-	googleNewAPI, err := api.NewGoogleNewsAPI(googleAPIKey, sc)
+	googleAPIKey := envVars["GOOGLE_NEWS_API_KEY"]
+	// NEWSAPI_URL points at a fake NewsAPI in development, see cmd/fakenewsapi
+	newsAPIURL := envVars["NEWSAPI_URL"]
+	if newsAPIURL == "" {
+		newsAPIURL = services.NewsAPIURL
+	}
+	chatChannels, err := delivery.ParseChatChannels(envVars["CHAT_CHANNELS"])
+	if err != nil {
+		fatal("failed to load chat channels", err)
+	}
+	smtpConfig, emailEnabled, err := delivery.ParseSMTPConfig(envVars)
+	if err != nil {
+		fatal("failed to load smtp config", err)
+	}
+	unsubscribeURL := envVars["UNSUBSCRIBE_URL"]
+	if unsubscribeURL == "" {
+		unsubscribeURL = "http://localhost:8080/api/unsubscribe"
+	}
+	confirmURL := envVars["CONFIRM_URL"]
+	if confirmURL == "" {
+		confirmURL = "http://localhost:8080/api/subscribers/confirm"
+	}
+	redisAddr := envVars["REDIS_ADDR"]
+	if redisAddr == "" {
+		redisAddr = "192.168.0.229:6379"
+	}
+	cloudflareRangesFile := envVars["CLOUDFLARE_RANGES_FILE"]
+	if cloudflareRangesFile == "" {
+		cloudflareRangesFile = "cloudflare_ips.json"
+	}
+	cloudflareRefreshInterval := trustedproxy.DefaultRefreshInterval
+	if value := envVars["CLOUDFLARE_REFRESH_INTERVAL"]; value != "" {
+		if cloudflareRefreshInterval, err = time.ParseDuration(value); err != nil {
+			fatal("failed to load CLOUDFLARE_REFRESH_INTERVAL", err)
+		}
+	}
+	// the NewsAPI developer plan allows 100 requests a day
+	newsAPIBudget := services.Budget{Limit: 100, Reserve: 10}
+	if value := envVars["NEWSAPI_DAILY_BUDGET"]; value != "" {
+		if newsAPIBudget.Limit, err = strconv.ParseInt(value, 10, 64); err != nil {
+			fatal("failed to load NEWSAPI_DAILY_BUDGET", err)
+		}
+	}
+	if value := envVars["NEWSAPI_SCHEDULED_RESERVE"]; value != "" {
+		if newsAPIBudget.Reserve, err = strconv.ParseInt(value, 10, 64); err != nil {
+			fatal("failed to load NEWSAPI_SCHEDULED_RESERVE", err)
+		}
+	}
+	// from when /readyz reports a dependency degraded or failed
+	healthThresholds := health.DefaultThresholds
+	if value := envVars["HEALTH_FETCH_DEGRADED_AFTER"]; value != "" {
+		if healthThresholds.FetchDegradedAfter, err = time.ParseDuration(value); err != nil {
+			fatal("failed to load HEALTH_FETCH_DEGRADED_AFTER", err)
+		}
+	}
+	if value := envVars["HEALTH_FETCH_FAILED_AFTER"]; value != "" {
+		if healthThresholds.FetchFailedAfter, err = time.ParseDuration(value); err != nil {
+			fatal("failed to load HEALTH_FETCH_FAILED_AFTER", err)
+		}
+	}
+	if value := envVars["HEALTH_QUOTA_DEGRADED_BELOW"]; value != "" {
+		if healthThresholds.QuotaDegradedBelow, err = strconv.ParseInt(value, 10, 64); err != nil {
+			fatal("failed to load HEALTH_QUOTA_DEGRADED_BELOW", err)
+		}
+	}
+	if value := envVars["HEALTH_QUOTA_FAILED_BELOW"]; value != "" {
+		if healthThresholds.QuotaFailedBelow, err = strconv.ParseInt(value, 10, 64); err != nil {
+			fatal("failed to load HEALTH_QUOTA_FAILED_BELOW", err)
+		}
+	}
+	// how often a failed NewsAPI call is retried, and after how many failed calls in a row NewsAPI isn't called for a
+	// while
+	retryPolicy := resilience.DefaultRetryPolicy
+	if value := envVars["NEWSAPI_MAX_ATTEMPTS"]; value != "" {
+		if retryPolicy.MaxAttempts, err = strconv.Atoi(value); err != nil {
+			fatal("failed to load NEWSAPI_MAX_ATTEMPTS", err)
+		}
+	}
+	// how long NewsAPI is waited for, by default and per topic, e.g. NEWSAPI_TOPIC_TIMEOUTS=hacking=2s
+	newsTimeouts := api.FetchTimeouts{Default: api.DefaultFetchTimeout}
+	if value := envVars["NEWSAPI_TIMEOUT"]; value != "" {
+		if newsTimeouts.Default, err = time.ParseDuration(value); err != nil {
+			fatal("failed to load NEWSAPI_TIMEOUT", err)
+		}
+	}
+	if newsTimeouts.Topics, err = api.ParseTopicTimeouts(envVars["NEWSAPI_TOPIC_TIMEOUTS"]); err != nil {
+		fatal("failed to load NEWSAPI_TOPIC_TIMEOUTS", err)
+	}
+	breakerSettings := resilience.DefaultBreakerSettings
+	if value := envVars["NEWSAPI_BREAKER_THRESHOLD"]; value != "" {
+		if breakerSettings.FailureThreshold, err = strconv.Atoi(value); err != nil {
+			fatal("failed to load NEWSAPI_BREAKER_THRESHOLD", err)
+		}
+	}
+	if value := envVars["NEWSAPI_BREAKER_OPEN_TIMEOUT"]; value != "" {
+		if breakerSettings.OpenTimeout, err = time.ParseDuration(value); err != nil {
+			fatal("failed to load NEWSAPI_BREAKER_OPEN_TIMEOUT", err)
+		}
+	}
+	// rate limits are "<requests per second>,<burst>"
+	ipLimitEnv := envVars["RATE_LIMIT_IP"]
+	if ipLimitEnv == "" {
+		ipLimitEnv = "10,40"
+	}
+	ipLimit, err := ratelimit.ParseLimit(ipLimitEnv)
 	if err != nil {
-		log.Fatalf("failed to create google api: %v", err)
+		fatal("failed to load RATE_LIMIT_IP", err)
+	}
+	apiKeyLimitEnv := envVars["RATE_LIMIT_API_KEY"]
+	if apiKeyLimitEnv == "" {
+		apiKeyLimitEnv = "20,100"
+	}
+	apiKeyLimit, err := ratelimit.ParseLimit(apiKeyLimitEnv)
+	if err != nil {
+		fatal("failed to load RATE_LIMIT_API_KEY", err)
+	}
+	grpcAddr := envVars["GRPC_ADDR"]
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	metricsAddr := envVars["METRICS_ADDR"]
+	if metricsAddr == "" {
+		metricsAddr = ":2112"
+	}
+	// spans are exported with "otlp" (to OTEL_EXPORTER_OTLP_ENDPOINT, e.g. a local collector), "stdout" or "none"
+	tracesExporter := envVars["OTEL_TRACES_EXPORTER"]
+	if tracesExporter == "" {
+		tracesExporter = tracing.ExporterNone
 	}
 
-	// Set up Gin router for production
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	// let's instantiate our custom secure client, identifying us to the providers and refusing oversized responses
+	sc := upstream.NewClient(upstream.NewSecureHTTPClient())
 
 	// start our main context
 	ctx := context.Background()
 
+	shutdownTracing, err := tracing.Setup(ctx, tracesExporter, os.Stdout)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer func() {
+		if err = shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush spans", logging.Err(err))
+		}
+	}()
+
+	// only Cloudflare, in front of us, is trusted to tell the client IP. Its IPv4 and IPv6 ranges are refreshed
+	// periodically, and persisted to fall back on when Cloudflare is unreachable at startup
+	proxyManager := trustedproxy.NewManager(sc, trustedproxy.CloudflareIPsURL, cloudflareRangesFile)
+	if err = proxyManager.Load(ctx); err != nil {
+		slog.Warn("trusting no proxy until cloudflare ranges are fetched", logging.Err(err))
+	}
+	go proxyManager.Run(ctx, cloudflareRefreshInterval)
+	cloudflareOnly := envVars["CLOUDFLARE_ONLY"] == "true"
+
 	// init cache
 	redisClient := redis.NewClient(&redis.Options{
-		Addr:     "192.168.0.229:6379",
+		Addr:     redisAddr,
 		Password: "", // no password set
 		DB:       0,  // use default DB
 	})
 	defer func() {
 		if err = redisClient.Close(); err != nil {
-			log.Fatalf("failed to close redis client: %v", err)
+			fatal("failed to close redis client", err)
 		}
 	}()
 
+	// every Redis command gets a span, without its arguments which hold whole articles
+	if err = redisotel.InstrumentTracing(redisClient, redisotel.WithDBStatement(false)); err != nil {
+		fatal("failed to trace redis", err)
+	}
+
 	redisCache := datastore.NewRedisCache(redisClient)
 
+	// the fetch pipeline calls NewsAPI within its daily budget, retrying transient failures until its circuit opens
+	pipeline, err := app.NewPipeline(redisCache, sc, app.PipelineConfig{
+		NewsAPIKey: googleAPIKey,
+		NewsAPIURL: newsAPIURL,
+		Budget:     newsAPIBudget,
+		Timeouts:   newsTimeouts,
+		Retry:      retryPolicy,
+		Breaker:    breakerSettings,
+	})
+	if err != nil {
+		fatal("failed to create google api", err)
+	}
+	newsAPI, ingestor := pipeline.NewsAPI, pipeline.Ingestor
+	metrics.Registry.MustRegister(pipeline.Accountant.Collector())
+
+	// every article the fetch pipeline didn't know about yet is pushed to the matching webhooks, which can only reach
+	// public addresses
+	webhookDispatcher := delivery.NewWebhookDispatcher(redisCache, delivery.NewWebhookClient(10*time.Second))
+	ingestor.OnIngest(webhookDispatcher.Enqueue)
+	go webhookDispatcher.Run(ctx)
+
+	// the daily brief is posted to Slack and Teams channels, CHAT_DRY_RUN=true prints the payloads instead
+	chatPublisher := delivery.NewChatPublisher(chatChannels, &http.Client{Timeout: 10 * time.Second})
+	chatPublisher.DryRun = envVars["CHAT_DRY_RUN"] == "true"
+	chatPublisher.Out = os.Stdout
+
+	// and emailed to its subscribers when SMTP_HOST is set, who confirm their subscription with a link emailed to them
+	emailPublisher := delivery.NewEmailPublisher(smtpConfig, redisCache, unsubscribeURL, confirmURL)
+	var subscriptionConfirmer handlers.SubscriptionConfirmer
+	if emailEnabled {
+		subscriptionConfirmer = emailPublisher
+	}
+
 	//redisCache.Scan()
 
 	//if err = redisCache.Set("key0", "value0"); err != nil {
@@ -83,65 +286,135 @@ func main() {
 	// we want to run this every day at 6am EST
 	waitTime, err := utilTime.TimeUntilNextRun("America/New_York", 06, 00)
 	if err != nil {
-		log.Println("failed to obtain a valid wait time:", err)
+		slog.Error("failed to obtain a valid wait time", logging.Err(err))
 	}
 
-	var news map[string]any
+	var news map[string]models.NewsArticle
 	go func() {
 		for {
-			log.Println("Sleeping for", waitTime)
+			slog.Info("daily routine sleeping", logging.KeyDuration, waitTime)
 			time.Sleep(waitTime)
-			news, err = googleNewAPI.FetchEverythingHacking(ctx)
+			news, err = newsAPI.FetchEverythingHacking(services.WithPriority(ctx, services.PriorityScheduled))
+			var budgetErr *services.BudgetError
+			if errors.As(err, &budgetErr) {
+				// defer the refresh until the budget resets
+				slog.Warn("deferring daily routine until the upstream budget resets", logging.KeyProvider, budgetErr.Provider, "reset", budgetErr.Reset)
+				waitTime = time.Until(budgetErr.Reset)
+				continue
+			}
+			var circuitErr *resilience.CircuitOpenError
+			if errors.As(err, &circuitErr) {
+				// NewsAPI is down, try again once its circuit lets a trial call through
+				slog.Warn("deferring daily routine until the upstream circuit closes", logging.KeyProvider, circuitErr.Provider, "until", circuitErr.Until)
+				waitTime = time.Until(circuitErr.Until)
+				continue
+			}
 			if err != nil {
-				log.Fatalf("failed to fetch hacking news in daily routine: %v", err)
+				slog.Error("failed to fetch hacking news in daily routine", logging.KeyTopic, services.TopicHacking, logging.Err(err))
+				waitTime = dailyRoutineRetryDelay
+				continue
 			}
 
 			// store news in Cache
-			for k, v := range news {
-				jsonValue, err := json.Marshal(v)
-				if err != nil {
-					log.Printf("failed to marshal news data with key (%s) and value(%v): %v", k, v, err)
-					continue
-				}
-				if err = redisCache.Set(k, jsonValue); err != nil {
-					log.Println("failed to store news data:", err)
-				}
+			if _, err = ingestor.Ingest(ctx, news); err != nil {
+				slog.Error("failed to store news data", logging.KeyTopic, services.TopicHacking, logging.Err(err))
 			}
 
-			log.Println("News Articles were refreshed as part of daily routine")
+			slog.Info("news articles were refreshed as part of daily routine", logging.KeyTopic, services.TopicHacking, "articles", len(news))
+			metrics.SchedulerLastSuccess.WithLabelValues("daily_refresh").SetToCurrentTime()
+
+			// select the most relevant articles for today's brief
+			articles := make([]models.NewsArticle, 0, len(news))
+			for _, article := range news {
+				articles = append(articles, article)
+			}
+			brief := services.BuildBrief("hacking", articles, time.Now())
+			if err = datastore.SetBrief(ctx, redisCache, brief); err != nil {
+				slog.Error("failed to store brief", logging.KeyTopic, brief.Topic, logging.Err(err))
+			}
+			if err = chatPublisher.Publish(ctx, brief); err != nil {
+				slog.Error("failed to post brief to chat", logging.KeyTopic, brief.Topic, logging.Err(err))
+			}
+			if emailEnabled {
+				if err = emailPublisher.Publish(ctx, brief); err != nil {
+					slog.Error("failed to email brief", logging.KeyTopic, brief.Topic, logging.Err(err))
+				}
+			}
 
 			waitTime, err = utilTime.TimeUntilNextRun("America/New_York", 00, 20)
 			if err != nil {
-				log.Println("failed to obtain a valid wait time:", err)
+				slog.Error("failed to obtain a valid wait time", logging.Err(err))
 			}
 		}
 	}()
 
-	r.GET("/api/everything-hacking-news", func(c *gin.Context) {
-		handlers.GetEveryHackingNews(ctx, c.Writer, googleNewAPI, redisCache)
+	// the HTTP API, with requests rate limited in buckets shared in Redis by every instance, or kept in memory while
+	// Redis is down
+	gin.SetMode(gin.ReleaseMode)
+	r, err := app.NewRouter(app.RouterConfig{
+		Cache:          redisCache,
+		Pipeline:       pipeline,
+		Confirmer:      subscriptionConfirmer,
+		RateLimiter:    ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(redisClient), ratelimit.NewMemoryLimiter()),
+		IPLimit:        ipLimit,
+		APIKeyLimit:    apiKeyLimit,
+		ProxyManager:   proxyManager,
+		CloudflareOnly: cloudflareOnly,
 	})
-
-	// let's make sure we're always getting valid CloudFlare IPv4 addresses
-	// to initiate our gin router allowed proxies
-	resp, err := sc.Get(cloudFlareAPI)
 	if err != nil {
-		log.Fatalf("Failed to get response: %v", err)
+		fatal("failed to set up router", err)
 	}
-	defer securehttp.ResponseBodyCloser(resp.Body)
 
-	var ipRanges models.CloudflareIPRanges
-	if err = jsonhandler.UnmarshalJSONResponse(resp, &ipRanges); err != nil {
-		log.Fatalf("Failed to unmarshal response: %v", err)
-	}
+	// the readiness probe checks every dependency, from Redis to the upstream budgets
+	healthChecker := health.NewChecker(health.DefaultCheckTimeout)
+	healthChecker.Register("redis", health.Redis(redisCache))
+	healthChecker.Register("fetch_"+services.TopicHacking, health.Fetch(redisCache, services.TopicHacking, healthThresholds))
+	healthChecker.Register("cloudflare_ranges", health.CloudflareRanges(proxyManager, cloudflareOnly, 4*cloudflareRefreshInterval))
+	healthChecker.Register("upstream_quota", health.UpstreamQuota(pipeline.Accountant, healthThresholds))
+	healthChecker.Register("upstream_circuits", health.Circuits(pipeline.Breaker))
 
-	// Set trusted proxies to Cloudflare IP ranges
-	if err = r.SetTrustedProxies(ipRanges.Result.IPv4CIDRs); err != nil {
-		log.Fatalf("Failed to set trusted proxies: %v", err)
+	// the gRPC API is served on its own port, over the same cache and fetch pipeline
+	grpcAuthenticator := grpcserver.NewAuthenticator(redisCache)
+	grpcServer, grpcHealth := grpcserver.NewGRPCServer(grpcserver.NewNewsServer(redisCache, newsAPI, ingestor, pipeline.Broker), grpcAuthenticator.ServerOptions()...)
+	grpcListener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		fatal("failed to listen for gRPC", err, "addr", grpcAddr)
 	}
+	// its health service reports the same status as the readiness probe
+	go grpcserver.ReportHealth(ctx, grpcHealth, healthChecker, grpcserver.DefaultHealthInterval)
+	go func() {
+		slog.Info("starting gRPC server", "addr", grpcAddr)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			fatal("failed to start gRPC server", err)
+		}
+	}()
+
+	// Prometheus metrics and the liveness and readiness probes are served on their own port, not exposed through
+	// Cloudflare nor subject to CLOUDFLARE_ONLY
+	go func() {
+		slog.Info("serving metrics and probes", "addr", metricsAddr)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			handlers.Healthz(w, r)
+		})
+		mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			handlers.Readyz(w, r, healthChecker)
+		})
+		if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+			fatal("failed to serve metrics", err)
+		}
+	}()
 
 	// Start server using Gin's built-in method
-	log.Println("Starting server on :8080")
+	slog.Info("starting server", "addr", ":8080")
 	if err = r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatal("failed to start server", err)
 	}
 }
+
+// fatal logs err along with args and exits
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, logging.Err(err))...)
+	os.Exit(1)
+}
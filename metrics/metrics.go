@@ -0,0 +1,89 @@
+// Package metrics holds the Prometheus metrics of our service, registered in Registry and served by Handler
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Registry holds our metrics, along with the Go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	// UpstreamFetchDuration is the latency of the calls to the news providers, by provider, topic and outcome
+	// (success or error)
+	UpstreamFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "devbriefs_upstream_fetch_duration_seconds",
+		Help: "Latency of the fetches from upstream news providers.",
+	}, []string{"provider", "topic", "outcome"})
+
+	// UpstreamRetries counts the calls to upstream providers retried, UpstreamCircuitState is the state of their circuit
+	// breaker (0 closed, 1 half-open, 2 open), see resilience.Breaker
+	UpstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devbriefs_upstream_retries_total",
+		Help: "Calls to upstream providers retried after a transient failure.",
+	}, []string{"provider"})
+	UpstreamCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "devbriefs_upstream_circuit_state",
+		Help: "State of the circuit breaker of each upstream provider: 0 closed, 1 half-open, 2 open.",
+	}, []string{"provider"})
+
+	// ArticlesIngested counts the fetched articles we didn't have yet, ArticlesDeduplicated the ones already cached
+	ArticlesIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devbriefs_articles_ingested_total",
+		Help: "Fetched articles added to the cache.",
+	}, []string{"topic"})
+	ArticlesDeduplicated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devbriefs_articles_deduplicated_total",
+		Help: "Fetched articles that were already cached.",
+	}, []string{"topic"})
+
+	// CacheLookups counts the cache reads by result (hit or miss), CacheErrors the failed Redis commands by operation
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devbriefs_cache_lookups_total",
+		Help: "Cache reads by result.",
+	}, []string{"result"})
+	CacheErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devbriefs_redis_errors_total",
+		Help: "Failed Redis commands by operation.",
+	}, []string{"operation"})
+
+	// SchedulerLastSuccess is the Unix time each background job last succeeded at
+	SchedulerLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "devbriefs_scheduler_last_success_timestamp_seconds",
+		Help: "Unix time of the last success of each background job.",
+	}, []string{"job"})
+
+	// HTTPRequestDuration is the latency of the HTTP requests by method, route template and status code
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "devbriefs_http_request_duration_seconds",
+		Help: "Latency of the HTTP requests.",
+	}, []string{"method", "route", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		UpstreamFetchDuration,
+		UpstreamRetries,
+		UpstreamCircuitState,
+		ArticlesIngested,
+		ArticlesDeduplicated,
+		CacheLookups,
+		CacheErrors,
+		SchedulerLastSuccess,
+		HTTPRequestDuration,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format. A collector failing, e.g. while Redis is down, only
+// leaves its metrics out of the scrape.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+		Registry:      Registry,
+	})
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // NewsArticle represents a single news article fetched from the Google News API from 'everything' endpoint
 type NewsArticle struct {
 	Title       string     `json:"title"`       // The title of the news article
@@ -7,6 +9,28 @@ type NewsArticle struct {
 	Description string     `json:"description"` // A brief description of the news article
 	Source      NewsSource `json:"source"`      // The source of the news article
 	PublishedAt string     `json:"publishedAt"` // The publication date of the news article
+
+	// fields below are not part of the Google News API response, we fill them in ourselves
+	ID       string   `json:"id,omitempty"`       // The md5 hash of the title, also used as the cache key
+	Topic    string   `json:"topic,omitempty"`    // The topic the article was fetched for, e.g. "hacking"
+	Tags     []string `json:"tags,omitempty"`     // The tags derived from the article keywords, e.g. "ransomware"
+	Cluster  *Cluster `json:"cluster,omitempty"`  // The coverage of this story across outlets
+	Score    float64  `json:"score,omitempty"`    // The relevance score, only set when articles are ranked
+	Mentions []string `json:"mentions,omitempty"` // The watched entities mentioned, only set when matched to a watchlist
+}
+
+// Cluster represents a story covered by several outlets, collapsed into a single article by our dedup
+type Cluster struct {
+	ID      string   `json:"id"`      // The ID of the article kept as representative of the story
+	Size    int      `json:"size"`    // The number of distinct outlets that covered the story
+	Outlets []string `json:"outlets"` // The names of the outlets that covered the story
+}
+
+// Brief represents the daily digest of the most relevant articles for a topic
+type Brief struct {
+	Topic       string        `json:"topic"`       // The topic the brief was built for, e.g. "hacking"
+	GeneratedAt time.Time     `json:"generatedAt"` // When the brief was built
+	Articles    []NewsArticle `json:"articles"`    // The selected articles, most relevant first
 }
 
 // NewsSource represents the source of a news article.
@@ -21,4 +45,80 @@ type CloudflareIPRanges struct {
 		IPv4CIDRs []string `json:"ipv4_cidrs"`
 		IPv6CIDRs []string `json:"ipv6_cidrs"`
 	} `json:"result"`
+	Success bool `json:"success"`
+}
+
+// Watchlist represents the vendors, products and domains an API client wants to keep an eye on
+type Watchlist struct {
+	ID        string    `json:"id"`                 // The ID of the watchlist
+	ClientID  string    `json:"clientId"`           // The API client owning the watchlist
+	Name      string    `json:"name"`               // A human friendly name, e.g. "Suppliers"
+	Vendors   []string  `json:"vendors,omitempty"`  // Company names, e.g. "Okta"
+	Products  []string  `json:"products,omitempty"` // Product names, e.g. "MOVEit Transfer"
+	Domains   []string  `json:"domains,omitempty"`  // Root domains, e.g. "example.com"
+	CreatedAt time.Time `json:"createdAt"`          // When the watchlist was created
+}
+
+// Webhook represents an URL an API client wants us to POST newly ingested articles matching its filter to
+type Webhook struct {
+	ID        string        `json:"id"`               // The ID of the webhook
+	ClientID  string        `json:"clientId"`         // The API client owning the webhook
+	URL       string        `json:"url"`              // The URL we POST the payloads to
+	Secret    string        `json:"secret,omitempty"` // The key used to sign payloads, only returned on creation
+	Filter    WebhookFilter `json:"filter"`           // The articles the webhook is interested in
+	CreatedAt time.Time     `json:"createdAt"`        // When the webhook was registered
+}
+
+// WebhookFilter selects the articles delivered to a webhook. Empty fields match every article.
+type WebhookFilter struct {
+	Topics     []string `json:"topics,omitempty"`     // Any of these topics
+	Tags       []string `json:"tags,omitempty"`       // Any of these tags
+	Watchlists []string `json:"watchlists,omitempty"` // Mentioning an entity of any of these watchlist IDs
+	MinScore   float64  `json:"minScore,omitempty"`   // A relevance score of at least this much
+}
+
+// WebhookDelivery represents one attempt at delivering a payload to a webhook
+type WebhookDelivery struct {
+	ID          string        `json:"id"`              // The ID of the payload, shared by all attempts
+	WebhookID   string        `json:"webhookId"`       // The webhook the payload was sent to
+	Attempt     int           `json:"attempt"`         // The attempt number, starting at 1
+	ArticleIDs  []string      `json:"articleIds"`      // The articles in the payload
+	StatusCode  int           `json:"statusCode"`      // The status code returned by the receiver, 0 if it didn't answer
+	Error       string        `json:"error,omitempty"` // Why the attempt failed
+	Success     bool          `json:"success"`         // Whether the receiver accepted the payload
+	Duration    time.Duration `json:"duration"`        // How long the attempt took
+	AttemptedAt time.Time     `json:"attemptedAt"`     // When the attempt was made
+}
+
+// Subscriber represents an email address the daily briefs of some topics are sent to
+type Subscriber struct {
+	Email            string    `json:"email"`                      // The address briefs are sent to
+	Topics           []string  `json:"topics,omitempty"`           // The topics of the briefs sent, all of them when empty
+	UnsubscribeToken string    `json:"unsubscribeToken,omitempty"` // The secret included in confirmation and unsubscribe links
+	Pending          bool      `json:"pending,omitempty"`          // Until the address confirms it subscribed, no brief is sent
+	CreatedAt        time.Time `json:"createdAt"`                  // When the address subscribed
+}
+
+// APIKey represents a key an API client authenticates with. Only the SHA-256 hash of the key is stored, the key itself
+// is shown once when issued.
+type APIKey struct {
+	ID        string     `json:"id"`                  // The ID of the key, to refer to it without knowing it
+	ClientID  string     `json:"clientId"`            // The API client the key belongs to, owning watchlists and webhooks
+	Name      string     `json:"name"`                // A human friendly name, e.g. "CI"
+	Hash      string     `json:"hash,omitempty"`      // The hex SHA-256 hash of the key
+	Prefix    string     `json:"prefix"`              // The first characters of the key, to recognize it
+	Scopes    []string   `json:"scopes"`              // What the key can be used for: read, admin
+	Quota     int64      `json:"quota,omitempty"`     // The requests allowed per UTC day, unlimited when 0
+	CreatedAt time.Time  `json:"createdAt"`           // When the key was issued
+	RevokedAt *time.Time `json:"revokedAt,omitempty"` // When the key was revoked, it can't be used anymore
+}
+
+// FetchStatus represents the outcome of the latest fetches of a topic from an upstream provider
+type FetchStatus struct {
+	Topic        string     `json:"topic"`                  // The topic fetched, e.g. "hacking"
+	Provider     string     `json:"provider"`               // The upstream provider fetched from, e.g. "newsapi"
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`  // When a fetch last succeeded
+	LastFailure  *time.Time `json:"lastFailure,omitempty"`  // When a fetch last failed
+	LastError    string     `json:"lastError,omitempty"`    // The error of the last failed fetch
+	FirstFailure *time.Time `json:"firstFailure,omitempty"` // When a fetch first failed
 }
@@ -0,0 +1,9 @@
+package openapi
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 document of /api/v1, served at /api/openapi.json. It's written by hand, the contract test of
+// the handlers package fails when the routes or responses drift from it.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"context"
+	"devbriefs-news/logging"
+	"log/slog"
+	"sync/atomic"
+)
+
+// FallbackLimiter limits with its primary limiter, switching to its fallback while the primary fails, e.g. a
+// RedisLimiter falling back to a MemoryLimiter while Redis is down, so the service stays limited, per instance.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	failing  atomic.Bool
+}
+
+func NewFallbackLimiter(primary, fallback Limiter) *FallbackLimiter {
+	return &FallbackLimiter{primary: primary, fallback: fallback}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	result, err := l.primary.Allow(ctx, key, limit)
+	if err == nil {
+		if l.failing.CompareAndSwap(true, false) {
+			slog.InfoContext(ctx, "rate limiter recovered, limiting with the primary limiter again")
+		}
+		return result, nil
+	}
+	// log when switching only, not on every request
+	if l.failing.CompareAndSwap(false, true) {
+		slog.WarnContext(ctx, "rate limiter failed, falling back", logging.Err(err))
+	}
+	return l.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst tokens, refilled at Rate tokens per second, and each request takes one
+type Limit struct {
+	Rate  float64 // Tokens added per second
+	Burst int     // The most tokens the bucket holds, the requests a client can make at once
+}
+
+// ParseLimit parses a limit written as "<rate per second>,<burst>", e.g. "10,40"
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, found := strings.Cut(s, ",")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected <rate per second>,<burst>", s)
+	}
+	var limit Limit
+	var err error
+	if limit.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || limit.Rate <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate in limit %q", s)
+	}
+	if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || limit.Burst < 1 {
+		return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+	}
+	return limit, nil
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int           // The burst of the bucket
+	Remaining  int           // The whole tokens left
+	RetryAfter time.Duration // When not allowed, the time until a token is available
+	Reset      time.Duration // The time until the bucket is full again
+}
+
+// Limiter takes tokens from the bucket of a key, e.g. a client IP
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ErrInvalidLimit is returned when allowing a request with a limit that can't refill or hold a token
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return fmt.Errorf("%w: rate %v, burst %d", ErrInvalidLimit, l.Rate, l.Burst)
+	}
+	return nil
+}
+
+// newResult describes a bucket left with tokens after a request was allowed or not
+func newResult(limit Limit, allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+	return result
+}
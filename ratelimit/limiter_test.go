@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  Limit
+		expectErr bool
+	}{
+		{name: "Rate and burst", input: "10,40", expected: Limit{Rate: 10, Burst: 40}},
+		{name: "Fractional rate", input: "0.5, 5", expected: Limit{Rate: 0.5, Burst: 5}},
+		{name: "Missing burst", input: "10", expectErr: true},
+		{name: "Zero rate", input: "0,10", expectErr: true},
+		{name: "Zero burst", input: "10,0", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, err := ParseLimit(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if limit != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, limit)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	// a burst, then the bucket is empty
+	for i, expectedRemaining := range []int{2, 1, 0} {
+		result, err := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v, %v", i+1, result, err)
+		}
+		if result.Remaining != expectedRemaining {
+			t.Errorf("request %d: expected %d remaining, got %d", i+1, expectedRemaining, result.Remaining)
+		}
+	}
+	result, _ := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+	if result.Allowed {
+		t.Fatal("expected the 4th request rejected")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected to retry after 500ms, got %v", result.RetryAfter)
+	}
+	if result.Reset != 1500*time.Millisecond {
+		t.Errorf("expected full after 1.5s, got %v", result.Reset)
+	}
+
+	// other keys have their own bucket
+	if result, _ = limiter.Allow(ctx, "ip:5.6.7.8", limit); !result.Allowed {
+		t.Error("expected another key allowed")
+	}
+
+	// a token is back after 500ms
+	now = now.Add(500 * time.Millisecond)
+	if result, _ = limiter.Allow(ctx, "ip:1.2.3.4", limit); !result.Allowed {
+		t.Error("expected allowed once refilled")
+	}
+	if result, _ = limiter.Allow(ctx, "ip:1.2.3.4", limit); result.Allowed {
+		t.Error("expected rejected again")
+	}
+
+	// and the bucket never holds more than its burst
+	now = now.Add(time.Hour)
+	if result, _ = limiter.Allow(ctx, "ip:1.2.3.4", limit); result.Remaining != 2 {
+		t.Errorf("expected 2 remaining after a full refill, got %d", result.Remaining)
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 1}
+
+	if _, err := limiter.Allow(context.Background(), "idle", limit); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	for range sweepEvery {
+		if _, err := limiter.Allow(context.Background(), "busy", limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("expected the refilled bucket swept")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("expected the busy bucket kept")
+	}
+}
+
+// failingLimiter fails every request until it's repaired
+type failingLimiter struct {
+	err error
+}
+
+func (f *failingLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	if f.err != nil {
+		return Result{}, f.err
+	}
+	return Result{Allowed: true, Limit: 99, Remaining: 99}, nil
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	primary := &failingLimiter{err: errors.New("connection refused")}
+	limiter := NewFallbackLimiter(primary, NewMemoryLimiter())
+	limit := Limit{Rate: 1, Burst: 1}
+
+	// the fallback limits while the primary fails
+	if result, err := limiter.Allow(context.Background(), "k", limit); err != nil || !result.Allowed || result.Limit != 1 {
+		t.Fatalf("expected allowed by the fallback, got %+v, %v", result, err)
+	}
+	if result, _ := limiter.Allow(context.Background(), "k", limit); result.Allowed {
+		t.Error("expected the fallback to reject the 2nd request")
+	}
+
+	primary.err = nil
+	if result, err := limiter.Allow(context.Background(), "k", limit); err != nil || result.Limit != 99 {
+		t.Errorf("expected the primary used once repaired, got %+v, %v", result, err)
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	if _, err := NewMemoryLimiter().Allow(context.Background(), "k", Limit{}); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("expected %v, got %v", ErrInvalidLimit, err)
+	}
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func newRedisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisLimiter(client), server
+}
+
+func TestRedisLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter, server := newRedisLimiter(t)
+	// the script reads the clock of Redis
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i, expectedRemaining := range []int{2, 1, 0} {
+		result, err := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v, %v", i+1, result, err)
+		}
+		if result.Remaining != expectedRemaining {
+			t.Errorf("request %d: expected %d remaining, got %d", i+1, expectedRemaining, result.Remaining)
+		}
+	}
+	result, err := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+	if err != nil || result.Allowed {
+		t.Fatalf("expected the 4th request rejected, got %+v, %v", result, err)
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected to retry after 500ms, got %v", result.RetryAfter)
+	}
+
+	// the bucket is namespaced, and expires once it would be full again
+	if !server.Exists(keyPrefix + "ip:1.2.3.4") {
+		t.Errorf("expected the bucket at %s, got keys %v", keyPrefix+"ip:1.2.3.4", server.Keys())
+	}
+	if ttl := server.TTL(keyPrefix + "ip:1.2.3.4"); ttl != 2500*time.Millisecond {
+		t.Errorf("expected the bucket to expire in 2.5s, got %v", ttl)
+	}
+
+	// another instance of the service shares the bucket
+	otherClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = otherClient.Close() })
+	other := NewRedisLimiter(otherClient)
+	if result, _ = other.Allow(ctx, "ip:1.2.3.4", limit); result.Allowed {
+		t.Error("expected another instance to reject the request too")
+	}
+
+	server.SetTime(now.Add(500 * time.Millisecond))
+	if result, _ = limiter.Allow(ctx, "ip:1.2.3.4", limit); !result.Allowed {
+		t.Error("expected allowed once refilled")
+	}
+}
+
+func TestFallbackLimiterRedisDown(t *testing.T) {
+	ctx := context.Background()
+	primary, server := newRedisLimiter(t)
+	server.SetTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	limiter := NewFallbackLimiter(primary, NewMemoryLimiter())
+	limit := Limit{Rate: 1, Burst: 1}
+
+	if result, err := limiter.Allow(ctx, "k", limit); err != nil || !result.Allowed {
+		t.Fatalf("expected allowed, got %+v, %v", result, err)
+	}
+
+	// the requests are limited per instance while Redis is down
+	server.Close()
+	if result, err := limiter.Allow(ctx, "k", limit); err != nil || !result.Allowed {
+		t.Fatalf("expected allowed by the fallback, got %+v, %v", result, err)
+	}
+	if result, _ := limiter.Allow(ctx, "k", limit); result.Allowed {
+		t.Error("expected the fallback to reject the 2nd request")
+	}
+
+	// and with the bucket in Redis again once it's back, which is still empty
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := limiter.Allow(ctx, "k", limit); err != nil || result.Allowed {
+		t.Errorf("expected Redis to reject the request, got %+v, %v", result, err)
+	}
+	if !server.Exists(keyPrefix + "k") {
+		t.Error("expected the bucket in Redis")
+	}
+}
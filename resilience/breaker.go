@@ -0,0 +1,177 @@
+package resilience
+
+import (
+	"devbriefs-news/metrics"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// State of a circuit breaker, exposed as the devbriefs_upstream_circuit_state gauge
+type State int
+
+const (
+	StateClosed   State = iota // Calls go through
+	StateHalfOpen              // A single trial call goes through, closing the circuit when it succeeds
+	StateOpen                  // Calls fail fast until the open timeout elapses
+)
+
+func (s State) String() string {
+	switch s {
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// ErrCircuitOpen is wrapped by the CircuitOpenError of a call refused by an open circuit
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned instead of calling a provider whose circuit is open
+type CircuitOpenError struct {
+	Provider string
+	Until    time.Time // When a trial call will be let through
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s circuit open until %s", e.Provider, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// BreakerSettings tell when a circuit opens and for how long
+type BreakerSettings struct {
+	FailureThreshold int           // The consecutive failures opening the circuit
+	OpenTimeout      time.Duration // How long the circuit stays open before a trial call
+}
+
+// DefaultBreakerSettings open the circuit of a provider after 5 failed calls in a row, for 30 seconds
+var DefaultBreakerSettings = BreakerSettings{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// Breaker is the circuit breaker of an upstream provider. Once the provider failed FailureThreshold calls in a row,
+// calls fail fast with a CircuitOpenError for OpenTimeout, then a single trial call decides whether the circuit closes
+// again or stays open for another OpenTimeout.
+type Breaker struct {
+	provider string
+	settings BreakerSettings
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool // Whether the trial call of the half-open circuit is in flight
+	now      func() time.Time
+}
+
+func NewBreaker(provider string, settings BreakerSettings) *Breaker {
+	b := &Breaker{
+		provider: provider,
+		settings: settings,
+		now:      time.Now,
+	}
+	metrics.UpstreamCircuitState.WithLabelValues(provider).Set(float64(StateClosed))
+	return b
+}
+
+// Provider is the name of the upstream provider of the breaker
+func (b *Breaker) Provider() string {
+	return b.provider
+}
+
+// State returns the state of the circuit, and until when it's open
+func (b *Breaker) State() (State, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.reopensAt()) {
+		return StateHalfOpen, time.Time{}
+	}
+	if b.state == StateOpen {
+		return b.state, b.reopensAt()
+	}
+	return b.state, time.Time{}
+}
+
+// Allow reserves a call, or returns a CircuitOpenError when the circuit is open or its trial call is in flight. Every
+// allowed call must be followed by Success, Failure or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.refusal(); err != nil {
+		return err
+	}
+	if b.state == StateOpen {
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		b.trial = true
+	}
+	return nil
+}
+
+// Check returns the CircuitOpenError Allow would return, without reserving a call, so callers can skip what precedes
+// a call the circuit would refuse, e.g. charging it to a budget
+func (b *Breaker) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refusal()
+}
+
+// refusal returns the CircuitOpenError of a call the circuit doesn't let through, with b.mu held
+func (b *Breaker) refusal() error {
+	switch {
+	case b.state == StateOpen && b.now().Before(b.reopensAt()):
+		return &CircuitOpenError{Provider: b.provider, Until: b.reopensAt()}
+	case b.state == StateHalfOpen && b.trial:
+		return &CircuitOpenError{Provider: b.provider, Until: b.now().Add(b.settings.OpenTimeout)}
+	}
+	return nil
+}
+
+// Success records a call that succeeded, closing the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.trial = 0, false
+	b.setState(StateClosed)
+}
+
+// Failure records a call that failed, opening the circuit when it was the trial call or one failure too many
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.trial = false
+		b.openedAt = b.now()
+		b.setState(StateOpen)
+	}
+}
+
+// Release records a call given up by its caller, which tells nothing about the provider, freeing the trial call of a
+// half-open circuit for the next one
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *Breaker) reopensAt() time.Time {
+	return b.openedAt.Add(b.settings.OpenTimeout)
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("upstream circuit changed state", "provider", b.provider, "from", b.state.String(), "to", state.String())
+	b.state = state
+	metrics.UpstreamCircuitState.WithLabelValues(b.provider).Set(float64(state))
+}
@@ -0,0 +1,81 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker opening after 2 failures for a minute, and a function moving its clock forward
+func newTestBreaker() (*Breaker, func(time.Duration)) {
+	breaker := NewBreaker("test", BreakerSettings{FailureThreshold: 2, OpenTimeout: time.Minute})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+	return breaker, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	breaker, _ := newTestBreaker()
+
+	breaker.Failure()
+	if state, _ := breaker.State(); state != StateClosed {
+		t.Fatalf("expected closed after a single failure, got %s", state)
+	}
+	// a success resets the count
+	breaker.Success()
+	breaker.Failure()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected the call to be allowed, got %v", err)
+	}
+
+	breaker.Failure()
+	if state, _ := breaker.State(); state != StateOpen {
+		t.Fatalf("expected open after 2 failures in a row, got %s", state)
+	}
+	err := breaker.Allow()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || circuitErr.Until != breaker.now().Add(time.Minute) {
+		t.Errorf("expected the circuit to be open for a minute, got %v", err)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name          string
+		trialSucceeds bool
+		expectedState State
+	}{
+		{name: "Trial succeeds", trialSucceeds: true, expectedState: StateClosed},
+		{name: "Trial fails", trialSucceeds: false, expectedState: StateOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker, advance := newTestBreaker()
+			breaker.Failure()
+			breaker.Failure()
+
+			advance(time.Minute)
+			if state, _ := breaker.State(); state != StateHalfOpen {
+				t.Fatalf("expected half-open once the open timeout elapsed, got %s", state)
+			}
+			if err := breaker.Allow(); err != nil {
+				t.Fatalf("expected the trial call to be allowed, got %v", err)
+			}
+			if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("expected a single trial call, got %v", err)
+			}
+
+			if tt.trialSucceeds {
+				breaker.Success()
+			} else {
+				breaker.Failure()
+			}
+			if state, _ := breaker.State(); state != tt.expectedState {
+				t.Errorf("expected %s, got %s", tt.expectedState, state)
+			}
+		})
+	}
+}
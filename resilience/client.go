@@ -0,0 +1,130 @@
+// Package resilience retries the failed calls to upstream providers and stops calling them while they're down
+package resilience
+
+import (
+	"context"
+	"devbriefs-news/metrics"
+	"devbriefs-news/upstream"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Client wraps the HTTP client of an upstream provider, retrying idempotent failures (timeouts, connection resets,
+// 5xx and 429) with exponential backoff and jitter, or after the Retry-After the provider asked for. Calls go through
+// the circuit breaker of the provider, so they fail fast with a CircuitOpenError while it's down. Retries stop as soon
+// as the context of the request is done.
+//
+// Only GETs are made, which are idempotent.
+type Client struct {
+	// BeforeRetry, when set, is called with the context of the request before every retry, which is given up when it
+	// returns an error. It lets retries count against the budget of the provider.
+	BeforeRetry func(ctx context.Context) error
+
+	client  upstream.Doer
+	breaker *Breaker
+	policy  RetryPolicy
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func NewClient(client upstream.Doer, breaker *Breaker, policy RetryPolicy) *Client {
+	return &Client{
+		client:  client,
+		breaker: breaker,
+		policy:  policy,
+		sleep:   sleep,
+	}
+}
+
+// Do sends req, returning a 2xx response or the error of the last attempt. The wrapped client must return the
+// responses other than 2xx as an upstream.StatusError, as upstream.Client does.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := c.client.Do(req.Clone(ctx))
+		if err == nil {
+			c.breaker.Success()
+			return resp, nil
+		}
+
+		if errors.Is(ctx.Err(), context.Canceled) {
+			// the caller gave up, which tells nothing about the provider
+			c.breaker.Release()
+			return nil, err
+		}
+		transient, wait := classify(err)
+		if !transient {
+			// the provider answered, it's our request that failed
+			c.breaker.Success()
+			return nil, err
+		}
+		if attempt >= c.policy.MaxAttempts || wait > c.policy.MaxRetryAfter || ctx.Err() != nil {
+			c.breaker.Failure()
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.policy.backoff(attempt)
+		}
+		if sleepErr := c.sleep(ctx, wait); sleepErr != nil {
+			c.giveUp(ctx)
+			return nil, fmt.Errorf("%w, not retried: %w", err, sleepErr)
+		}
+		if c.BeforeRetry != nil {
+			if retryErr := c.BeforeRetry(ctx); retryErr != nil {
+				c.giveUp(ctx)
+				return nil, fmt.Errorf("%w, not retried: %w", err, retryErr)
+			}
+		}
+		metrics.UpstreamRetries.WithLabelValues(c.breaker.Provider()).Inc()
+	}
+}
+
+// giveUp records a call failing transiently that won't be retried, unless its caller gave up
+func (c *Client) giveUp(ctx context.Context) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		c.breaker.Release()
+		return
+	}
+	c.breaker.Failure()
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// classify tells whether an error is transient, and how long the provider asked to wait before retrying
+func classify(err error) (transient bool, wait time.Duration) {
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode), statusErr.RetryAfter
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF), 0
+}
+
+// retryableStatus tells whether a status code is worth retrying: rate limited or a server error that may not last
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
@@ -0,0 +1,199 @@
+package resilience
+
+import (
+	"context"
+	"devbriefs-news/upstream"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// scriptedClient answers the calls with responses, one per call, then the last one over and over
+type scriptedClient struct {
+	responses []scriptedResponse
+	calls     int
+}
+
+type scriptedResponse struct {
+	status     int // returned as a response, unless err is set
+	retryAfter string
+	err        error
+}
+
+func (c *scriptedClient) Do(*http.Request) (*http.Response, error) {
+	r := c.responses[min(c.calls, len(c.responses)-1)]
+	c.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	resp := &http.Response{StatusCode: r.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}
+	if r.retryAfter != "" {
+		resp.Header.Set("Retry-After", r.retryAfter)
+	}
+	return resp, nil
+}
+
+// newTestClient returns a client retrying calls to inner, and the delays it slept for
+func newTestClient(inner *scriptedClient, breaker *Breaker) (*Client, *[]time.Duration) {
+	client := NewClient(upstream.NewClient(inner), breaker, RetryPolicy{
+		MaxAttempts:   3,
+		BaseDelay:     10 * time.Millisecond,
+		MaxDelay:      20 * time.Millisecond,
+		MaxRetryAfter: 5 * time.Second,
+	})
+	var slept []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return ctx.Err()
+	}
+	return client, &slept
+}
+
+func newRequest(ctx context.Context) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://newsapi.org/v2/everything", nil)
+	return req
+}
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name           string
+		responses      []scriptedResponse
+		expectedCalls  int
+		expectedStatus int // of the failed response, 0 when it succeeds
+		expectedSleeps []time.Duration
+	}{
+		{
+			name:          "Success",
+			responses:     []scriptedResponse{{status: http.StatusOK}},
+			expectedCalls: 1,
+		},
+		{
+			name:          "Retries a 503",
+			responses:     []scriptedResponse{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}},
+			expectedCalls: 2,
+		},
+		{
+			name:          "Retries a connection reset",
+			responses:     []scriptedResponse{{err: fmt.Errorf("error making HTTP request: %w", syscall.ECONNRESET)}, {status: http.StatusOK}},
+			expectedCalls: 2,
+		},
+		{
+			name:           "Honours Retry-After",
+			responses:      []scriptedResponse{{status: http.StatusTooManyRequests, retryAfter: "2"}, {status: http.StatusOK}},
+			expectedCalls:  2,
+			expectedSleeps: []time.Duration{2 * time.Second},
+		},
+		{
+			name:           "Retry-After too long",
+			responses:      []scriptedResponse{{status: http.StatusTooManyRequests, retryAfter: "3600"}},
+			expectedCalls:  1,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "Doesn't retry a 401",
+			responses:      []scriptedResponse{{status: http.StatusUnauthorized}},
+			expectedCalls:  1,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Gives up after max attempts",
+			responses:      []scriptedResponse{{status: http.StatusInternalServerError}},
+			expectedCalls:  3,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &scriptedClient{responses: tt.responses}
+			client, slept := newTestClient(inner, NewBreaker("test", DefaultBreakerSettings))
+
+			resp, err := client.Do(newRequest(context.Background()))
+			if inner.calls != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, inner.calls)
+			}
+			if tt.expectedStatus == 0 {
+				if err != nil || resp.StatusCode != http.StatusOK {
+					t.Fatalf("expected a 200 response, got %v", err)
+				}
+			} else {
+				var statusErr *upstream.StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.expectedStatus {
+					t.Fatalf("expected a %d status error, got %v", tt.expectedStatus, err)
+				}
+			}
+			if tt.expectedSleeps != nil && fmt.Sprint(*slept) != fmt.Sprint(tt.expectedSleeps) {
+				t.Errorf("expected sleeps %v, got %v", tt.expectedSleeps, *slept)
+			}
+			for _, d := range *slept {
+				if tt.expectedSleeps == nil && d > 20*time.Millisecond {
+					t.Errorf("expected backoffs up to 20ms, got %v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestClientOpensCircuit(t *testing.T) {
+	inner := &scriptedClient{responses: []scriptedResponse{{status: http.StatusBadGateway}}}
+	breaker := NewBreaker("test", BreakerSettings{FailureThreshold: 2, OpenTimeout: time.Minute})
+	client, _ := newTestClient(inner, breaker)
+
+	for range 2 {
+		if _, err := client.Do(newRequest(context.Background())); err == nil {
+			t.Fatal("expected the call to fail")
+		}
+	}
+	calls := inner.calls
+	_, err := client.Do(newRequest(context.Background()))
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if inner.calls != calls {
+		t.Errorf("expected the open circuit to fail fast, got %d more calls", inner.calls-calls)
+	}
+}
+
+func TestClientBeforeRetry(t *testing.T) {
+	inner := &scriptedClient{responses: []scriptedResponse{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}}}
+	client, _ := newTestClient(inner, NewBreaker("test", DefaultBreakerSettings))
+	budgetErr := errors.New("budget exhausted")
+	client.BeforeRetry = func(context.Context) error { return budgetErr }
+
+	_, err := client.Do(newRequest(context.Background()))
+	if inner.calls != 1 {
+		t.Errorf("expected the retry to be given up, got %d calls", inner.calls)
+	}
+	var statusErr *upstream.StatusError
+	if !errors.As(err, &statusErr) || !strings.Contains(err.Error(), budgetErr.Error()) {
+		t.Errorf("expected the 503 and why it wasn't retried, got %v", err)
+	}
+}
+
+func TestClientCancelled(t *testing.T) {
+	inner := &scriptedClient{responses: []scriptedResponse{{status: http.StatusServiceUnavailable}}}
+	breaker := NewBreaker("test", BreakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	client, _ := newTestClient(inner, breaker)
+
+	// the client of the request goes away while waiting to retry
+	ctx, cancel := context.WithCancel(context.Background())
+	client.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	_, err := client.Do(newRequest(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the retry to be cancelled, got %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected no retry once cancelled, got %d calls", inner.calls)
+	}
+	if state, _ := breaker.State(); state != StateClosed {
+		t.Errorf("expected a cancelled call not to open the circuit, got %s", state)
+	}
+}
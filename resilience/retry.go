@@ -0,0 +1,35 @@
+package resilience
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy tells how often and how long apart a failed call is retried
+type RetryPolicy struct {
+	MaxAttempts   int           // The attempts of a call, the first included
+	BaseDelay     time.Duration // The delay before the first retry, doubled on every retry
+	MaxDelay      time.Duration // The longest delay between two attempts
+	MaxRetryAfter time.Duration // The longest Retry-After we wait for, a 429 asking for longer isn't retried
+}
+
+// DefaultRetryPolicy retries twice, after up to 100ms then 200ms
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	BaseDelay:     100 * time.Millisecond,
+	MaxDelay:      2 * time.Second,
+	MaxRetryAfter: 5 * time.Second,
+}
+
+// backoff returns the delay before retrying after attempt failed, exponential with full jitter so clients failing
+// together don't retry together
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return rand.N(delay + 1)
+}
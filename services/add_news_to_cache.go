@@ -1 +1,85 @@
 package services
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"devbriefs-news/logging"
+	"devbriefs-news/metrics"
+	"devbriefs-news/models"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"time"
+)
+
+// AddNewsToCache stores articles in cache and returns the ones that weren't cached yet. Failing to store an article
+// is only logged, so one bad article doesn't prevent the rest from being cached. Articles are counted in
+// metrics.ArticlesIngested or metrics.ArticlesDeduplicated by topic, and the topics of the added ones are marked as
+// changed for the Last-Modified of their feeds.
+func AddNewsToCache(ctx context.Context, cache datastore.Cache, news map[string]models.NewsArticle) ([]models.NewsArticle, error) {
+	ctx, span := tracer.Start(ctx, "services.AddNewsToCache")
+	defer span.End()
+
+	var added []models.NewsArticle
+	for _, article := range news {
+		_, err := cache.Get(ctx, datastore.ArticleKey(article.ID))
+		if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+			return added, err
+		}
+		isNew := errors.Is(err, datastore.ErrNotFound)
+
+		if err = datastore.SetArticle(ctx, cache, article); err != nil {
+			slog.ErrorContext(ctx, "failed to store news data", logging.KeyArticleID, article.ID, logging.KeyTopic, article.Topic, logging.Err(err))
+			continue
+		}
+		if isNew {
+			added = append(added, article)
+			metrics.ArticlesIngested.WithLabelValues(article.Topic).Inc()
+		} else {
+			metrics.ArticlesDeduplicated.WithLabelValues(article.Topic).Inc()
+		}
+	}
+	changed := make(map[string]bool)
+	for _, article := range added {
+		if changed[article.Topic] {
+			continue
+		}
+		changed[article.Topic] = true
+		if err := datastore.SetTopicChanged(ctx, cache, article.Topic, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "failed to record topic change", logging.KeyTopic, article.Topic, logging.Err(err))
+		}
+	}
+	span.SetAttributes(attribute.Int("articles.fetched", len(news)), attribute.Int("articles.added", len(added)))
+	return added, nil
+}
+
+// IngestHook is called with the articles the fetch pipeline just added to the cache
+type IngestHook func(articles []models.NewsArticle)
+
+// Ingestor adds fetched news to the cache and notifies its hooks about the articles we didn't know about yet
+type Ingestor struct {
+	cache datastore.Cache
+	hooks []IngestHook
+}
+
+func NewIngestor(cache datastore.Cache) *Ingestor {
+	return &Ingestor{
+		cache: cache,
+	}
+}
+
+// OnIngest registers a hook, hooks must not block as they're called from the fetch pipeline
+func (i *Ingestor) OnIngest(hook IngestHook) {
+	i.hooks = append(i.hooks, hook)
+}
+
+// Ingest stores news in cache and calls every hook with the new articles, if any
+func (i *Ingestor) Ingest(ctx context.Context, news map[string]models.NewsArticle) ([]models.NewsArticle, error) {
+	added, err := AddNewsToCache(ctx, i.cache, news)
+	if len(added) > 0 {
+		for _, hook := range i.hooks {
+			hook(added)
+		}
+	}
+	return added, err
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"crypto/md5"
+	"devbriefs-news/models"
+	"fmt"
+	"github.com/semper-proficiens/go-utils/nlp"
+	"net/url"
+	"strings"
+)
+
+// ArticleID returns the identifier we use for an article, the md5 hash of its title
+func ArticleID(title string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(title)))
+}
+
+// clusterArticles sets the ID and Cluster of every unique article. Each article in "all" is assigned to the unique
+// article it is most similar to (as long as it's above the threshold), so the cluster size tells how many distinct
+// outlets covered the same story.
+func clusterArticles(unique, all []models.NewsArticle, threshold float64) []models.NewsArticle {
+	clustered := make([]models.NewsArticle, len(unique))
+	for i, article := range unique {
+		article.ID = ArticleID(article.Title)
+		article.Cluster = &models.Cluster{ID: article.ID}
+		clustered[i] = article
+	}
+
+	for _, article := range all {
+		best, bestScore := -1, threshold
+		for i, u := range clustered {
+			if score := nlp.CalculateSimilarity(article.Title, u.Title); score >= bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		cluster := clustered[best].Cluster
+		outlet := outletName(article)
+		if !containsFold(cluster.Outlets, outlet) {
+			cluster.Outlets = append(cluster.Outlets, outlet)
+			cluster.Size = len(cluster.Outlets)
+		}
+	}
+
+	return clustered
+}
+
+// outletName returns the name of the outlet that published an article, falling back to the host of its URL
+func outletName(article models.NewsArticle) string {
+	if article.Source.Name != "" {
+		return article.Source.Name
+	}
+	u, err := url.Parse(article.URL)
+	if err != nil {
+		return article.URL
+	}
+	return u.Hostname()
+}
+
+// containsFold reports whether value is in values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,16 +2,35 @@ package services
 
 import (
 	"context"
+	"devbriefs-news/logging"
 	"devbriefs-news/models"
+	"devbriefs-news/upstream"
 	"github.com/semper-proficiens/go-utils/nlp"
 	"github.com/semper-proficiens/go-utils/web/jsonhandler"
 	"github.com/semper-proficiens/go-utils/web/securehttp"
 	"github.com/semper-proficiens/go-utils/web/urlcleaner"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Topics are the topics we fetch news for, which subscribers can follow
+var Topics = []string{TopicHacking}
+
 const (
+	// TopicHacking is the only topic we fetch news for at the moment
+	TopicHacking = "hacking"
+
+	// NewsAPIURL is where NewsAPI is served, a fake NewsAPI (see cmd/fakenewsapi) can be used instead
+	NewsAPIURL = "https://newsapi.org"
+
 	hackingQuery = `
     "data breach" OR 
     "hacker" OR 
@@ -25,32 +44,71 @@ const (
     -"my"
     `
 	newsLanguage = "en"
-	//only root domains, not fqdn (e.g. talosintelligence.com vs blog.talosintelligence.com)
-	newsDomains  = "thehackernews.com,hackread.com,talosintelligence.com,bleepingcomputer.com,cisa.gov,csoonline.com,threatpost.com,krebsonsecurity.com,wired.com,zdnet.com,virtualattacks.com"
 	newsSortBy   = "publishedAt" // options: "relevancy" to q, "publishedAt" for newest (default)
 	newsPageSize = "10"
+	// dedupThreshold is the title similarity score from which two articles are considered the same story
+	dedupThreshold = 0.6
 )
 
+var tracer = otel.Tracer("devbriefs-news/services")
+
+// newsDomains are the outlets we query and how much we trust them when ranking articles (see Scorer).
+// Only root domains, not fqdn (e.g. talosintelligence.com vs blog.talosintelligence.com)
+var newsDomains = map[string]float64{
+	"cisa.gov":              1.0,
+	"krebsonsecurity.com":   0.9,
+	"talosintelligence.com": 0.9,
+	"bleepingcomputer.com":  0.8,
+	"thehackernews.com":     0.8,
+	"csoonline.com":         0.7,
+	"threatpost.com":        0.7,
+	"wired.com":             0.6,
+	"zdnet.com":             0.6,
+	"hackread.com":          0.5,
+	"virtualattacks.com":    0.4,
+}
+
+// newsDomainsParam returns newsDomains as the comma separated list expected by the 'domains' query parameter
+func newsDomainsParam() string {
+	domains := make([]string, 0, len(newsDomains))
+	for d := range newsDomains {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return strings.Join(domains, ",")
+}
+
 // FetchEverythingNews is function used to hit the News API 'everything' endpoint. It expects
 // a newsType argument that will be mapped to some query logic associated to that newsType.
 //
 // For now only "hacking" news logic exists, so "newsType" will only accept "hacking" as an argument, and will default to
 // a hacking query.
 //
-// e.g. FetchEverythingNews(ctx, "hacking")
+// The request is made in ctx, so it's cancelled with it, and our key is sent in the X-Api-Key header rather than in
+// the URL, where it could end up in logs.
+//
+// e.g. FetchEverythingNews(ctx, "hacking", apiKey, NewsAPIURL, client)
 // Official doc https://newsapi.org/docs/endpoints/everything
-func FetchEverythingNews(ctx context.Context, newsType string, apiKey string, client securehttp.CustomHTTPClientInterface) ([]models.NewsArticle, error) {
+func FetchEverythingNews(ctx context.Context, newsType string, apiKey string, newsAPIURL string, client upstream.Doer) (articles []models.NewsArticle, err error) {
+	ctx, span := tracer.Start(ctx, "services.FetchEverythingNews", trace.WithAttributes(attribute.String("news.type", newsType)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
 	// by default newsType will be a hacking query
-	var query string
+	var query, topic string
 	switch newsType {
-	case "hacking":
-		query = hackingQuery
+	case TopicHacking:
+		query, topic = hackingQuery, TopicHacking
 	default:
-		query = hackingQuery
+		query, topic = hackingQuery, TopicHacking
 	}
 
-	baseURL, err := urlcleaner.UrlParser(query, "https://newsapi.org/v2/everything", 500)
+	baseURL, err := urlcleaner.UrlParser(query, strings.TrimSuffix(newsAPIURL, "/")+"/v2/everything", 500)
 	if err != nil {
 		return nil, err
 	}
@@ -65,19 +123,42 @@ func FetchEverythingNews(ctx context.Context, newsType string, apiKey string, cl
 	params.Add("searchin", "title")
 	params.Add("language", newsLanguage)
 	params.Add("sortBy", newsSortBy)
-	params.Add("domains", newsDomains)
+	params.Add("domains", newsDomainsParam())
 	params.Add("pageSize", newsPageSize)
 	params.Add("from", fromDate)
 	params.Add("to", toDate)
-	params.Add("apiKey", apiKey)
 
 	// Add the query parameters to the URL
 	baseURL.RawQuery = params.Encode()
 
-	resp, err := client.Get(baseURL.String())
+	// don't spend a NewsAPI call on a fetch nobody waits for anymore
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Api-Key", apiKey)
+
+	_, httpSpan := tracer.Start(ctx, "GET /v2/everything", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(http.MethodGet),
+		semconv.ServerAddress(baseURL.Hostname()),
+		semconv.URLPath(baseURL.Path),
+	))
+	resp, err := client.Do(req)
+	if err != nil {
+		// in case the key ends up in a URL again, as it used to
+		err = logging.RedactError(err)
+		httpSpan.RecordError(err)
+		httpSpan.SetStatus(codes.Error, err.Error())
+		httpSpan.End()
+		return nil, err
+	}
+	httpSpan.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	httpSpan.End()
 	// close connection
 	defer securehttp.ResponseBodyCloser(resp.Body)
 
@@ -90,7 +171,15 @@ func FetchEverythingNews(ctx context.Context, newsType string, apiKey string, cl
 		return nil, err
 	}
 
-	uniqueArticles := nlp.RemoveDuplicates(result.Articles, 0.6, "Title")
+	_, dedupSpan := tracer.Start(ctx, "services.dedup")
+	uniqueArticles := nlp.RemoveDuplicates(result.Articles, dedupThreshold, "Title")
+	uniqueArticles = clusterArticles(uniqueArticles, result.Articles, dedupThreshold)
+	dedupSpan.SetAttributes(attribute.Int("articles.fetched", len(result.Articles)), attribute.Int("articles.unique", len(uniqueArticles)))
+	dedupSpan.End()
+	for i := range uniqueArticles {
+		uniqueArticles[i].Topic = topic
+		uniqueArticles[i].Tags = TagArticle(uniqueArticles[i])
+	}
 
 	//for _, ua := range uniqueArticles {
 	//	log.Printf("Title: %s, URL: %s, Date: %s", ua.Title, ua.URL, ua.PublishedAt)
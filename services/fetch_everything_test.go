@@ -1,94 +1,128 @@
 package services
 
 import (
-	"devbriefs-news/api"
-	"devbriefs-news/models"
-	"encoding/json"
+	"context"
+	"devbriefs-news/upstream"
+	"devbriefs-news/upstream/upstreamtest"
 	"errors"
-	"io"
 	"net/http"
-	"reflect"
-	"strings"
+	"os"
 	"testing"
 )
 
-// MockHTTPClient is a mock implementation of the CustomHTTPClientInterface.
+// newsAPIFixtures are the NewsAPI responses replayed by the tests, recorded with
+//
+//	UPSTREAM_RECORD=1 GOOGLE_NEWS_API_KEY=$apiKey go test ./services -run TestFetchEverythingNews/Successful
+const newsAPIFixtures = "testdata/newsapi"
+
+// MockHTTPClient is a mock implementation of upstream.Doer
 type MockHTTPClient struct {
-	GetFunc func(url string) (*http.Response, error)
+	DoFunc func(req *http.Request) (*http.Response, error)
+}
+
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return m.DoFunc(req)
 }
 
-func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
-	return m.GetFunc(url)
+// newsAPIKey is the key recording the fixtures, or a fake one replaying them
+func newsAPIKey() string {
+	if key := os.Getenv("GOOGLE_NEWS_API_KEY"); key != "" && os.Getenv(upstreamtest.RecordEnv) == "1" {
+		return key
+	}
+	return "test-api-key"
 }
 
-func TestFetchEverythingHacking(t *testing.T) {
+func TestFetchEverythingNews(t *testing.T) {
 	tests := []struct {
-		name           string
-		query          string
-		mockGetFunc    func(url string) (*http.Response, error)
-		expectedResult []models.NewsArticle
-		expectedError  error
+		name             string
+		client           func(t *testing.T) upstream.Doer
+		cancelled        bool
+		expectedArticles int
+		expectedErr      error
+		expectedStatus   int // of the upstream.StatusError returned, if any
 	}{
 		{
-			name:  "Successful fetch and parse",
-			query: hackingQuery,
-			mockGetFunc: func(url string) (*http.Response, error) {
-				articles := []models.NewsArticle{
-					{Title: "Test News 1"},
-					{Title: "Test News 2"},
-				}
-				body, _ := json.Marshal(map[string]interface{}{"articles": articles})
-				return &http.Response{
-					StatusCode: http.StatusOK,
-					Body:       io.NopCloser(strings.NewReader(string(body))),
-				}, nil
+			name: "Successful fetch and parse",
+			client: func(t *testing.T) upstream.Doer {
+				return upstream.NewClient(upstreamtest.Client(t, newsAPIFixtures, newsAPIKey()))
 			},
-			expectedResult: []models.NewsArticle{
-				{Title: "Test News 1"},
+			// the 2 articles about the Fortinet flaw are the same story
+			expectedArticles: 4,
+		},
+		{
+			name: "HTTP request fails",
+			client: func(*testing.T) upstream.Doer {
+				return &MockHTTPClient{DoFunc: func(*http.Request) (*http.Response, error) {
+					return nil, errors.New("http request error")
+				}}
 			},
-			expectedError: nil,
+			expectedErr: errors.New("http request error"),
 		},
 		{
-			name:  "HTTP request fails",
-			query: hackingQuery,
-			mockGetFunc: func(url string) (*http.Response, error) {
-				return nil, errors.New("http request error")
+			name: "Invalid API key",
+			client: func(t *testing.T) upstream.Doer {
+				fixtures, err := upstreamtest.Load(newsAPIFixtures)
+				if err != nil {
+					t.Fatal(err)
+				}
+				handler := upstreamtest.NewHandler(fixtures)
+				handler.APIKey = "another-api-key"
+				return upstream.NewClient(&http.Client{Transport: &upstreamtest.Transport{Handler: handler}})
 			},
-			expectedResult: nil,
-			expectedError:  errors.New("http request error"),
+			expectedStatus: http.StatusUnauthorized,
 		},
 		{
-			name:  "Encoded query exceeds max length",
-			query: strings.Repeat("a", 501),
-			mockGetFunc: func(url string) (*http.Response, error) {
-				return nil, nil
+			name: "Cancelled",
+			client: func(t *testing.T) upstream.Doer {
+				return &MockHTTPClient{DoFunc: func(*http.Request) (*http.Response, error) {
+					t.Error("expected no request once cancelled")
+					return nil, errors.New("unexpected request")
+				}}
 			},
-			expectedResult: nil,
-			expectedError:  errors.New("encoded query exceeds the maximum length of 500 characters"),
+			cancelled:   true,
+			expectedErr: context.Canceled,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockHTTPClient := &MockHTTPClient{
-				GetFunc: tt.mockGetFunc,
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
 			}
 
-			api := &api.GoogleNewsAPI{
-				APIKey:     "test-api-key",
-				HTTPClient: mockHTTPClient,
+			articles, err := FetchEverythingNews(ctx, TopicHacking, newsAPIKey(), NewsAPIURL, tt.client(t))
+			switch {
+			case tt.expectedStatus != 0:
+				var statusErr *upstream.StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.expectedStatus {
+					t.Fatalf("expected a %d status error, got %v", tt.expectedStatus, err)
+				}
+				return
+			case tt.expectedErr != nil:
+				if err == nil || (!errors.Is(err, tt.expectedErr) && err.Error() != tt.expectedErr.Error()) {
+					t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("expected no error, got %v", err)
 			}
 
-			result, err := TestFetchEverythingHacking()
-
-			if !reflect.DeepEqual(result, tt.expectedResult) {
-				t.Errorf("expected result %v, got %v", tt.expectedResult, result)
+			if len(articles) != tt.expectedArticles {
+				t.Fatalf("expected %d articles, got %d", tt.expectedArticles, len(articles))
 			}
-
-			if err != nil && tt.expectedError != nil && err.Error() != tt.expectedError.Error() {
-				t.Errorf("expected error %v, got %v", tt.expectedError, err)
-			} else if (err != nil && tt.expectedError == nil) || (err == nil && tt.expectedError != nil) {
-				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			clustered := 0
+			for _, article := range articles {
+				if article.ID == "" || article.Topic != TopicHacking {
+					t.Errorf("expected an ID and the hacking topic, got %q and %q", article.ID, article.Topic)
+				}
+				if article.Cluster != nil && article.Cluster.Size == 2 {
+					clustered++
+				}
+			}
+			if clustered != 1 {
+				t.Errorf("expected the Fortinet story to be covered by 2 outlets, got %d stories covered by 2", clustered)
 			}
 		})
 	}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SortByScore       = "score"
+	SortByPublishedAt = "publishedAt"
+
+	// briefSize is the number of articles selected for a daily brief
+	briefSize = 5
+	// maxKeywordScore caps the keyword contribution so a title stuffed with buzzwords can't dominate the ranking
+	maxKeywordScore = 2.0
+)
+
+// keywordWeights are matched case-insensitively against the title and description of an article
+var keywordWeights = map[string]float64{
+	"zero-day":           1.0,
+	"actively exploited": 1.0,
+	"ransomware":         0.8,
+	"data breach":        0.8,
+	"supply chain":       0.7,
+	"backdoor":           0.6,
+	"malware":            0.4,
+	"phishing":           0.3,
+}
+
+var (
+	cvePattern  = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+	cvssPattern = regexp.MustCompile(`(?i)\bCVSS(?:v3)?(?:\s+score)?(?:\s+of)?[:\s]+(\d{1,2}(?:\.\d)?)`)
+)
+
+// Scorer ranks articles by relevance. The score of an article is its recency decay multiplied by the sum of its source
+// weight, cluster size, keyword weights and CVE severity, so an old story never outranks a fresh one of the same weight.
+type Scorer struct {
+	HalfLife            time.Duration      // The age at which an article keeps half of its score
+	SourceWeights       map[string]float64 // The weight of each root domain, see newsDomains
+	DefaultSourceWeight float64            // The weight of a domain missing from SourceWeights
+	KeywordWeights      map[string]float64 // The weight of each keyword found in the title or description
+	ClusterWeight       float64            // The weight of log2 of the number of outlets that covered the story
+	SeverityWeight      float64            // The weight of the CVE severity, normalized between 0 and 1
+}
+
+// NewScorer returns a Scorer configured with our news domains and keyword weights
+func NewScorer() *Scorer {
+	return &Scorer{
+		HalfLife:            24 * time.Hour,
+		SourceWeights:       newsDomains,
+		DefaultSourceWeight: 0.3,
+		KeywordWeights:      keywordWeights,
+		ClusterWeight:       0.5,
+		SeverityWeight:      1.0,
+	}
+}
+
+var defaultScorer = NewScorer()
+
+// Score returns the relevance score of an article at the given time
+func (s *Scorer) Score(article models.NewsArticle, now time.Time) float64 {
+	clusterSize := 1
+	if article.Cluster != nil && article.Cluster.Size > 1 {
+		clusterSize = article.Cluster.Size
+	}
+
+	weight := s.sourceWeight(article.URL) +
+		s.ClusterWeight*math.Log2(float64(clusterSize)) +
+		s.keywordScore(article.Title+" "+article.Description) +
+		s.SeverityWeight*cveSeverity(article.Title+" "+article.Description)
+
+	return s.recency(article.PublishedAt, now) * weight
+}
+
+// Rank returns a copy of the articles with their Score set, sorted from most to least relevant
+func (s *Scorer) Rank(articles []models.NewsArticle, now time.Time) []models.NewsArticle {
+	ranked := make([]models.NewsArticle, len(articles))
+	for i, article := range articles {
+		article.Score = s.Score(article, now)
+		ranked[i] = article
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// recency halves the score every HalfLife. Articles with an unparseable date are treated as one HalfLife old.
+func (s *Scorer) recency(publishedAt string, now time.Time) float64 {
+	published, err := time.Parse(time.RFC3339, publishedAt)
+	if err != nil {
+		return 0.5
+	}
+	age := now.Sub(published)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(s.HalfLife))
+}
+
+// sourceWeight matches the host of the article URL against the configured root domains
+func (s *Scorer) sourceWeight(articleURL string) float64 {
+	u, err := url.Parse(articleURL)
+	if err != nil {
+		return s.DefaultSourceWeight
+	}
+	host := strings.ToLower(u.Hostname())
+	for domain, weight := range s.SourceWeights {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return weight
+		}
+	}
+	return s.DefaultSourceWeight
+}
+
+func (s *Scorer) keywordScore(text string) float64 {
+	text = strings.ToLower(text)
+	var score float64
+	for keyword, weight := range s.KeywordWeights {
+		if strings.Contains(text, keyword) {
+			score += weight
+		}
+	}
+	return math.Min(score, maxKeywordScore)
+}
+
+// cveSeverity returns the severity, between 0 and 1, of the CVE mentioned in the text. We use the CVSS score when the
+// article gives one, otherwise we guess from the wording. Text without a CVE has no severity.
+func cveSeverity(text string) float64 {
+	if !cvePattern.MatchString(text) {
+		return 0
+	}
+	if m := cvssPattern.FindStringSubmatch(text); m != nil {
+		if cvss, err := strconv.ParseFloat(m[1], 64); err == nil && cvss <= 10 {
+			return cvss / 10
+		}
+	}
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "critical"), strings.Contains(lower, "zero-day"):
+		return 0.9
+	case strings.Contains(lower, "high severity"), strings.Contains(lower, "high-severity"):
+		return 0.7
+	default:
+		return 0.5
+	}
+}
+
+// SortArticles returns the articles sorted by sortBy, either SortByScore or SortByPublishedAt (newest first, default)
+func SortArticles(articles []models.NewsArticle, sortBy string, now time.Time) []models.NewsArticle {
+	if sortBy == SortByScore {
+		return defaultScorer.Rank(articles, now)
+	}
+
+	sorted := make([]models.NewsArticle, len(articles))
+	copy(sorted, articles)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PublishedAt > sorted[j].PublishedAt
+	})
+	return sorted
+}
+
+// BuildBrief selects the most relevant articles of a topic for the daily brief
+func BuildBrief(topic string, articles []models.NewsArticle, now time.Time) models.Brief {
+	ranked := defaultScorer.Rank(articles, now)
+	if len(ranked) > briefSize {
+		ranked = ranked[:briefSize]
+	}
+	return models.Brief{
+		Topic:       topic,
+		GeneratedAt: now,
+		Articles:    ranked,
+	}
+}
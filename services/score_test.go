@@ -0,0 +1,158 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"math"
+	"testing"
+	"time"
+)
+
+var scoreNow = time.Date(2024, 9, 20, 12, 0, 0, 0, time.UTC)
+
+func TestScorerScore(t *testing.T) {
+	scorer := NewScorer()
+
+	tests := []struct {
+		name     string
+		article  models.NewsArticle
+		expected float64
+	}{
+		{
+			name: "Fresh article from a trusted source",
+			article: models.NewsArticle{
+				Title:       "Agency publishes advisory",
+				URL:         "https://www.cisa.gov/news/advisory",
+				PublishedAt: scoreNow.Format(time.RFC3339),
+			},
+			expected: 1.0,
+		},
+		{
+			name: "Same article one half-life later",
+			article: models.NewsArticle{
+				Title:       "Agency publishes advisory",
+				URL:         "https://www.cisa.gov/news/advisory",
+				PublishedAt: scoreNow.Add(-24 * time.Hour).Format(time.RFC3339),
+			},
+			expected: 0.5,
+		},
+		{
+			name: "Unknown source with keywords and cluster",
+			article: models.NewsArticle{
+				Title:       "Ransomware gang claims data breach",
+				URL:         "https://blog.example.com/post",
+				PublishedAt: scoreNow.Format(time.RFC3339),
+				Cluster:     &models.Cluster{Size: 4},
+			},
+			expected: 0.3 + 0.5*2 + 0.8 + 0.8,
+		},
+		{
+			name: "CVE with CVSS score",
+			article: models.NewsArticle{
+				Title:       "Patch CVE-2024-12345 now",
+				Description: "The flaw has a CVSS score of 9.8",
+				URL:         "https://thehackernews.com/2024/09/patch.html",
+				PublishedAt: scoreNow.Format(time.RFC3339),
+			},
+			expected: 0.8 + 0.98,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := scorer.Score(tt.article, scoreNow)
+			if math.Abs(score-tt.expected) > 1e-9 {
+				t.Errorf("expected score %v, got %v", tt.expected, score)
+			}
+		})
+	}
+}
+
+func TestCVESeverity(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected float64
+	}{
+		{"No vulnerability here", 0},
+		{"CVE-2024-1234 fixed, CVSS 7.5", 0.75},
+		{"CVE-2024-1234 is a critical flaw", 0.9},
+		{"High-severity CVE-2024-1234 patched", 0.7},
+		{"Vendor patches CVE-2024-1234", 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if severity := cveSeverity(tt.text); severity != tt.expected {
+				t.Errorf("expected severity %v, got %v", tt.expected, severity)
+			}
+		})
+	}
+}
+
+func TestSortArticles(t *testing.T) {
+	articles := []models.NewsArticle{
+		{Title: "Old blog post", URL: "https://virtualattacks.com/a", PublishedAt: "2024-09-20T11:00:00Z"},
+		{Title: "Major zero-day actively exploited", URL: "https://krebsonsecurity.com/b", PublishedAt: "2024-09-20T08:00:00Z"},
+	}
+
+	byScore := SortArticles(articles, SortByScore, scoreNow)
+	if byScore[0].Title != "Major zero-day actively exploited" {
+		t.Errorf("expected the zero-day article first when sorting by score, got %q", byScore[0].Title)
+	}
+	if byScore[0].Score <= byScore[1].Score {
+		t.Errorf("expected scores in descending order, got %v and %v", byScore[0].Score, byScore[1].Score)
+	}
+
+	byDate := SortArticles(articles, SortByPublishedAt, scoreNow)
+	if byDate[0].Title != "Old blog post" {
+		t.Errorf("expected the newest article first when sorting by date, got %q", byDate[0].Title)
+	}
+	if byDate[0].Score != 0 {
+		t.Errorf("expected no score when sorting by date, got %v", byDate[0].Score)
+	}
+}
+
+func TestBuildBrief(t *testing.T) {
+	var articles []models.NewsArticle
+	for i := 0; i < briefSize+3; i++ {
+		articles = append(articles, models.NewsArticle{
+			Title:       "Story",
+			URL:         "https://zdnet.com/story",
+			PublishedAt: scoreNow.Add(-time.Duration(i) * time.Hour).Format(time.RFC3339),
+		})
+	}
+
+	brief := BuildBrief("hacking", articles, scoreNow)
+	if brief.Topic != "hacking" {
+		t.Errorf("expected topic hacking, got %q", brief.Topic)
+	}
+	if len(brief.Articles) != briefSize {
+		t.Fatalf("expected %d articles, got %d", briefSize, len(brief.Articles))
+	}
+	if brief.Articles[0].PublishedAt != articles[0].PublishedAt {
+		t.Errorf("expected the freshest article first, got %v", brief.Articles[0].PublishedAt)
+	}
+}
+
+func TestClusterArticles(t *testing.T) {
+	all := []models.NewsArticle{
+		{Title: "Hackers breach Acme Corp network", Source: models.NewsSource{Name: "Wired"}},
+		{Title: "Hackers breach Acme Corp networks", Source: models.NewsSource{Name: "ZDNet"}},
+		{Title: "Hackers breach Acme Corp network", Source: models.NewsSource{Name: "wired"}},
+		{Title: "New phishing kit targets banks", URL: "https://hackread.com/kit"},
+	}
+	unique := []models.NewsArticle{all[0], all[3]}
+
+	clustered := clusterArticles(unique, all, dedupThreshold)
+	if len(clustered) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clustered))
+	}
+	if clustered[0].ID != ArticleID(all[0].Title) || clustered[0].Cluster.ID != clustered[0].ID {
+		t.Errorf("expected cluster and article ID %s, got %s and %s", ArticleID(all[0].Title), clustered[0].ID, clustered[0].Cluster.ID)
+	}
+	if clustered[0].Cluster.Size != 2 {
+		t.Errorf("expected 2 distinct outlets, got %v", clustered[0].Cluster.Outlets)
+	}
+	if got := clustered[1].Cluster.Outlets; len(got) != 1 || got[0] != "hackread.com" {
+		t.Errorf("expected the URL host as outlet, got %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"sort"
+	"strings"
+)
+
+// tagKeywords maps each tag to the keywords that earn it, matched case-insensitively against the title and description
+var tagKeywords = map[string][]string{
+	"data-breach":   {"data breach", "breach", "leaked", "stolen data"},
+	"malware":       {"malware", "trojan", "botnet", "infostealer", "spyware"},
+	"phishing":      {"phishing", "smishing"},
+	"ransomware":    {"ransomware", "extortion"},
+	"supply-chain":  {"supply chain", "supply-chain"},
+	"vulnerability": {"cve-", "vulnerability", "vulnerabilities", "flaw", "exploit", "patch"},
+	"zero-day":      {"zero-day", "0-day"},
+}
+
+// TagArticle returns the sorted tags earned by an article
+func TagArticle(article models.NewsArticle) []string {
+	text := strings.ToLower(article.Title + " " + article.Description)
+	var tags []string
+	for tag, keywords := range tagKeywords {
+		for _, keyword := range keywords {
+			if strings.Contains(text, keyword) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
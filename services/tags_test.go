@@ -0,0 +1,34 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"reflect"
+	"testing"
+)
+
+func TestTagArticle(t *testing.T) {
+	tests := []struct {
+		name     string
+		article  models.NewsArticle
+		expected []string
+	}{
+		{
+			name:     "Several tags, sorted",
+			article:  models.NewsArticle{Title: "Ransomware gang exploits zero-day", Description: "CVE-2024-1234 patch released"},
+			expected: []string{"ransomware", "vulnerability", "zero-day"},
+		},
+		{
+			name:     "No tag",
+			article:  models.NewsArticle{Title: "Conference announces speakers"},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tags := TagArticle(tt.article); !reflect.DeepEqual(tags, tt.expected) {
+				t.Errorf("expected tags %v, got %v", tt.expected, tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"time"
+)
+
+// Priority tells how much a fetch from an upstream provider matters when its daily budget runs low
+type Priority int
+
+const (
+	// PriorityAdHoc fetches are triggered by API clients, they can be served from cache instead
+	PriorityAdHoc Priority = iota
+	// PriorityScheduled fetches are the daily refresh, the reserve of a budget is kept for them
+	PriorityScheduled
+)
+
+func (p Priority) String() string {
+	if p == PriorityScheduled {
+		return "scheduled"
+	}
+	return "ad-hoc"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context making upstream fetches with a priority, fetches are ad-hoc by default
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority of the fetches made with a context
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// ErrBudgetExhausted is wrapped by the BudgetError returned when a fetch doesn't fit in the budget of its provider
+var ErrBudgetExhausted = errors.New("upstream budget exhausted")
+
+// BudgetError is returned when the budget of a provider refused a fetch, which can be retried after Reset
+type BudgetError struct {
+	Provider string
+	Priority Priority
+	Reset    time.Time
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s budget exhausted for %s fetches until %s", e.Provider, e.Priority, e.Reset.Format(time.RFC3339))
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExhausted
+}
+
+// Budget is the number of calls we can make to a provider per UTC day
+type Budget struct {
+	Limit   int64 // The calls allowed per UTC day, e.g. 100 on the NewsAPI developer plan
+	Reserve int64 // The last calls of the day, only made by scheduled fetches
+}
+
+// BudgetStatus is how much of its budget a provider used today
+type BudgetStatus struct {
+	Provider  string    `json:"provider"`
+	Limit     int64     `json:"limit"`
+	Reserve   int64     `json:"reserve"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// QuotaAccountant counts the calls made to each upstream provider per UTC day in the cache, so the count survives
+// restarts and is shared by every instance. Ad-hoc fetches are refused once only the reserve of a budget is left, and
+// scheduled ones once it's exhausted.
+type QuotaAccountant struct {
+	cache   datastore.Cache
+	budgets map[string]Budget
+	now     func() time.Time
+}
+
+func NewQuotaAccountant(cache datastore.Cache, budgets map[string]Budget) *QuotaAccountant {
+	return &QuotaAccountant{
+		cache:   cache,
+		budgets: budgets,
+		now:     time.Now,
+	}
+}
+
+// Acquire counts a call about to be made to a provider with the priority of ctx, or returns a BudgetError when the
+// call doesn't fit in the budget. Providers without a budget are unlimited. The call is only counted while the calls
+// made so far are below what its priority allows, in one atomic step, so concurrent calls from every instance can't
+// overshoot the budget, and refused ad-hoc calls never touch the reserve left for scheduled ones.
+func (a *QuotaAccountant) Acquire(ctx context.Context, provider string) error {
+	budget, ok := a.budgets[provider]
+	if !ok {
+		return nil
+	}
+
+	now := a.now()
+	priority := PriorityFromContext(ctx)
+	allowed := budget.Limit
+	if priority == PriorityAdHoc {
+		allowed -= budget.Reserve
+	}
+	_, counted, err := datastore.IncrUpstreamCalls(ctx, a.cache, provider, now, allowed)
+	if err != nil {
+		return err
+	}
+	if !counted {
+		return &BudgetError{Provider: provider, Priority: priority, Reset: nextUTCDay(now)}
+	}
+	return nil
+}
+
+// Status returns the budget of every provider, sorted by provider
+func (a *QuotaAccountant) Status(ctx context.Context) ([]BudgetStatus, error) {
+	now := a.now()
+	statuses := make([]BudgetStatus, 0, len(a.budgets))
+	for provider, budget := range a.budgets {
+		used, err := datastore.GetUpstreamCalls(ctx, a.cache, provider, now)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, BudgetStatus{
+			Provider:  provider,
+			Limit:     budget.Limit,
+			Reserve:   budget.Reserve,
+			Used:      used,
+			Remaining: max(budget.Limit-used, 0),
+			Reset:     nextUTCDay(now),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	return statuses, nil
+}
+
+// budgetRemainingDesc describes the calls left today in the budget of each provider
+var budgetRemainingDesc = prometheus.NewDesc("devbriefs_upstream_budget_remaining",
+	"Calls left today in the budget of each upstream provider.", []string{"provider"}, nil)
+
+// Collector exposes the remaining budget of each provider as a gauge, read from the cache when scraped
+func (a *QuotaAccountant) Collector() prometheus.Collector {
+	return budgetCollector{accountant: a}
+}
+
+type budgetCollector struct {
+	accountant *QuotaAccountant
+}
+
+func (c budgetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- budgetRemainingDesc
+}
+
+func (c budgetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	statuses, err := c.accountant.Status(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(budgetRemainingDesc, err)
+		return
+	}
+	for _, status := range statuses {
+		ch <- prometheus.MustNewConstMetric(budgetRemainingDesc, prometheus.GaugeValue, float64(status.Remaining), status.Provider)
+	}
+}
+
+func nextUTCDay(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"devbriefs-news/datastore"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuotaAccountant(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	accountant := NewQuotaAccountant(datastore.NewMemoryCache(), map[string]Budget{"newsapi": {Limit: 3, Reserve: 1}})
+	accountant.now = func() time.Time { return now }
+	scheduled := WithPriority(ctx, PriorityScheduled)
+
+	steps := []struct {
+		name        string
+		ctx         context.Context
+		provider    string
+		expectedErr bool
+	}{
+		{name: "First ad-hoc call", ctx: ctx, provider: "newsapi"},
+		{name: "Second ad-hoc call", ctx: ctx, provider: "newsapi"},
+		{name: "Ad-hoc call into the reserve", ctx: ctx, provider: "newsapi", expectedErr: true},
+		{name: "Scheduled call uses the reserve", ctx: scheduled, provider: "newsapi"},
+		{name: "Scheduled call over the budget", ctx: scheduled, provider: "newsapi", expectedErr: true},
+		{name: "Provider without budget", ctx: ctx, provider: "other"},
+	}
+	for _, step := range steps {
+		err := accountant.Acquire(step.ctx, step.provider)
+		if (err != nil) != step.expectedErr {
+			t.Fatalf("%s: expected error %v, got %v", step.name, step.expectedErr, err)
+		}
+		var budgetErr *BudgetError
+		if step.expectedErr && (!errors.As(err, &budgetErr) || !errors.Is(err, ErrBudgetExhausted)) {
+			t.Fatalf("%s: expected a BudgetError, got %v", step.name, err)
+		}
+		if budgetErr != nil && !budgetErr.Reset.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: expected reset at the next UTC midnight, got %v", step.name, budgetErr.Reset)
+		}
+	}
+
+	statuses, err := accountant.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Used != 3 || statuses[0].Remaining != 0 {
+		t.Errorf("expected 3 calls used and none remaining, got %+v", statuses)
+	}
+
+	// and the remaining budget is exposed as a gauge
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(accountant.Collector())
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || len(families[0].GetMetric()) != 1 || families[0].GetMetric()[0].GetGauge().GetValue() != 0 {
+		t.Errorf("expected the newsapi budget gauge at 0, got %v", families)
+	}
+
+	// the budget starts over the next day
+	now = now.Add(24 * time.Hour)
+	if err = accountant.Acquire(ctx, "newsapi"); err != nil {
+		t.Errorf("expected a new budget the next day, got %v", err)
+	}
+}
+
+func TestQuotaAccountantConcurrent(t *testing.T) {
+	ctx := context.Background()
+	cache := datastore.NewMemoryCache()
+	budgets := map[string]Budget{"newsapi": {Limit: 10, Reserve: 2}}
+	scheduled := WithPriority(ctx, PriorityScheduled)
+
+	// every fetch from its own instance, sharing the cache, and all of them at once
+	acquire := func(ctxs []context.Context) []error {
+		errs := make([]error, len(ctxs))
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i, fetchCtx := range ctxs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				errs[i] = NewQuotaAccountant(cache, budgets).Acquire(fetchCtx, "newsapi")
+			}()
+		}
+		close(start)
+		wg.Wait()
+		return errs
+	}
+
+	// ad-hoc fetches stop at the reserve
+	ctxs := make([]context.Context, 50)
+	for i := range ctxs {
+		ctxs[i] = ctx
+	}
+	acquired := 0
+	for _, err := range acquire(ctxs) {
+		if err == nil {
+			acquired++
+		} else if !errors.Is(err, ErrBudgetExhausted) {
+			t.Fatalf("expected a BudgetError, got %v", err)
+		}
+	}
+	if acquired != 8 {
+		t.Errorf("expected 8 ad-hoc calls, the budget without its reserve, got %d", acquired)
+	}
+
+	// and scheduled ones still get the reserve while ad-hoc ones keep being refused
+	ctxs = append(ctxs, scheduled, scheduled)
+	errs := acquire(ctxs)
+	for i, err := range errs[:50] {
+		if !errors.Is(err, ErrBudgetExhausted) {
+			t.Fatalf("expected ad-hoc call %d to be refused, got %v", i, err)
+		}
+	}
+	for i, err := range errs[50:] {
+		if err != nil {
+			t.Errorf("expected scheduled call %d to get the reserve, got %v", i, err)
+		}
+	}
+
+	used, err := datastore.GetUpstreamCalls(ctx, cache, "newsapi", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 10 {
+		t.Errorf("expected the 10 calls of the budget counted, got %d", used)
+	}
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	if priority := PriorityFromContext(context.Background()); priority != PriorityAdHoc {
+		t.Errorf("expected %v by default, got %v", PriorityAdHoc, priority)
+	}
+	if priority := PriorityFromContext(WithPriority(context.Background(), PriorityScheduled)); priority != PriorityScheduled {
+		t.Errorf("expected %v, got %v", PriorityScheduled, priority)
+	}
+}
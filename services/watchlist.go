@@ -0,0 +1,79 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// watchlistMatcher holds the compiled patterns of a watchlist so we can match it against many articles
+type watchlistMatcher struct {
+	entities       []string
+	patterns       []*regexp.Regexp
+	domains        []string
+	domainPatterns []*regexp.Regexp
+}
+
+func newWatchlistMatcher(watchlist models.Watchlist) *watchlistMatcher {
+	m := &watchlistMatcher{}
+	for _, entity := range append(append([]string{}, watchlist.Vendors...), watchlist.Products...) {
+		entity = strings.TrimSpace(entity)
+		if entity == "" {
+			continue
+		}
+		m.entities = append(m.entities, entity)
+		// whole words only, so "Okta" doesn't match "Oktane"
+		m.patterns = append(m.patterns, regexp.MustCompile(`(?i)(^|\W)`+regexp.QuoteMeta(entity)+`($|\W)`))
+	}
+	for _, domain := range watchlist.Domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			m.domains = append(m.domains, domain)
+			// whole labels only, so "example.com" matches "mail.example.com" but not "notexample.com" or
+			// "example.com.evil.net", while trailing dots ending a sentence are fine
+			m.domainPatterns = append(m.domainPatterns, regexp.MustCompile(`(?i)(^|[^a-z0-9-])`+regexp.QuoteMeta(domain)+`\.*($|[^a-z0-9.-])`))
+		}
+	}
+	return m
+}
+
+// match returns the watched entities mentioned by an article. Vendors and products are looked up in the title and
+// description, domains also match when the article is hosted on them.
+func (m *watchlistMatcher) match(article models.NewsArticle) []string {
+	text := article.Title + " " + article.Description
+	var mentions []string
+	for i, pattern := range m.patterns {
+		if pattern.MatchString(text) && !containsFold(mentions, m.entities[i]) {
+			mentions = append(mentions, m.entities[i])
+		}
+	}
+
+	host := ""
+	if u, err := url.Parse(article.URL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	for i, domain := range m.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) || m.domainPatterns[i].MatchString(text) {
+			mentions = append(mentions, domain)
+		}
+	}
+	return mentions
+}
+
+// MatchWatchlist returns the watched entities mentioned by an article, nil if it mentions none
+func MatchWatchlist(watchlist models.Watchlist, article models.NewsArticle) []string {
+	return newWatchlistMatcher(watchlist).match(article)
+}
+
+// FilterWatchlist returns the articles mentioning at least one watched entity, flagged with the entities they mention
+func FilterWatchlist(watchlist models.Watchlist, articles []models.NewsArticle) []models.NewsArticle {
+	m := newWatchlistMatcher(watchlist)
+	matched := make([]models.NewsArticle, 0)
+	for _, article := range articles {
+		if mentions := m.match(article); len(mentions) > 0 {
+			article.Mentions = mentions
+			matched = append(matched, article)
+		}
+	}
+	return matched
+}
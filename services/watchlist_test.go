@@ -0,0 +1,89 @@
+package services
+
+import (
+	"devbriefs-news/models"
+	"reflect"
+	"testing"
+)
+
+func TestMatchWatchlist(t *testing.T) {
+	watchlist := models.Watchlist{
+		Vendors:  []string{"Okta", "Acme Corp"},
+		Products: []string{"MOVEit Transfer"},
+		Domains:  []string{"example.com"},
+	}
+
+	tests := []struct {
+		name     string
+		article  models.NewsArticle
+		expected []string
+	}{
+		{
+			name:     "Vendor in title",
+			article:  models.NewsArticle{Title: "Okta support system breached"},
+			expected: []string{"Okta"},
+		},
+		{
+			name:     "Vendor is only a prefix of a word",
+			article:  models.NewsArticle{Title: "Oktane conference recap"},
+			expected: nil,
+		},
+		{
+			name:     "Product and vendor in description, case insensitive",
+			article:  models.NewsArticle{Title: "Mass exploitation", Description: "acme corp hit through moveit transfer flaw"},
+			expected: []string{"Acme Corp", "MOVEit Transfer"},
+		},
+		{
+			name:     "Article hosted on a watched domain",
+			article:  models.NewsArticle{Title: "Our incident report", URL: "https://blog.example.com/incident"},
+			expected: []string{"example.com"},
+		},
+		{
+			name:     "Domain mentioned in text",
+			article:  models.NewsArticle{Title: "Phishing kit spoofs example.com logins"},
+			expected: []string{"example.com"},
+		},
+		{
+			name:     "Subdomain or address mentioned in text",
+			article:  models.NewsArticle{Title: "Mail from it@mail.example.com is spoofed", Description: "Users of Example.com."},
+			expected: []string{"example.com"},
+		},
+		{
+			name:     "Domain is only a suffix of another domain",
+			article:  models.NewsArticle{Title: "notexample.com and my-example.com were seized"},
+			expected: nil,
+		},
+		{
+			name:     "Domain is only a prefix of another domain",
+			article:  models.NewsArticle{Title: "Phishing from example.com.evil.net and example.com-login.net"},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mentions := MatchWatchlist(watchlist, tt.article); !reflect.DeepEqual(mentions, tt.expected) {
+				t.Errorf("expected mentions %v, got %v", tt.expected, mentions)
+			}
+		})
+	}
+}
+
+func TestFilterWatchlist(t *testing.T) {
+	watchlist := models.Watchlist{Vendors: []string{"Okta"}}
+	articles := []models.NewsArticle{
+		{Title: "Okta support system breached"},
+		{Title: "Unrelated ransomware story"},
+	}
+
+	matched := FilterWatchlist(watchlist, articles)
+	if len(matched) != 1 {
+		t.Fatalf("expected 1 matching article, got %d", len(matched))
+	}
+	if !reflect.DeepEqual(matched[0].Mentions, []string{"Okta"}) {
+		t.Errorf("expected the article to be flagged with Okta, got %v", matched[0].Mentions)
+	}
+	if articles[0].Mentions != nil {
+		t.Errorf("expected the input articles to be left untouched, got %v", articles[0].Mentions)
+	}
+}
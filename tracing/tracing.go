@@ -0,0 +1,66 @@
+// Package tracing sets up the OpenTelemetry tracer provider our packages create their spans with
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"io"
+)
+
+// ServiceName is the service.name of our spans, unless OTEL_SERVICE_NAME overrides it
+const ServiceName = "devbriefs-news"
+
+// Exporters, as named by OTEL_TRACES_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Setup installs the global tracer provider exporting spans with exporter, and the W3C trace context and baggage
+// propagators. The OTLP exporter sends spans over HTTP to OTEL_EXPORTER_OTLP_ENDPOINT (default localhost:4318, e.g. a
+// local collector), the stdout one prints them to out. With ExporterNone, spans are still created so trace IDs
+// propagate, but never exported.
+//
+// The returned shutdown flushes the spans not exported yet, call it before exiting.
+func Setup(ctx context.Context, exporter string, out io.Writer) (shutdown func(context.Context) error, err error) {
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		if spanExporter, err = otlptracehttp.New(ctx); err != nil {
+			return nil, err
+		}
+	case ExporterStdout:
+		if spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(out), stdouttrace.WithPrettyPrint()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q, expected %q, %q or %q", exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win over our defaults
+	if res, err = resource.Merge(res, resource.Environment()); err != nil {
+		return nil, err
+	}
+
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if spanExporter != nil {
+		options = append(options, sdktrace.WithBatcher(spanExporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
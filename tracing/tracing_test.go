@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"go.opentelemetry.io/otel"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Setup(ctx, "jaeger", nil); err == nil {
+		t.Error("expected an unknown exporter to fail")
+	}
+
+	var out bytes.Buffer
+	shutdown, err := Setup(ctx, ExporterStdout, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("devbriefs-news/tracing").Start(ctx, "test span")
+	span.End()
+	if err = shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`"Name": "test span"`, `"Value": "devbriefs-news"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %s in the exported spans, got\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package trustedproxy
+
+import (
+	"context"
+	"devbriefs-news/logging"
+	"devbriefs-news/metrics"
+	"devbriefs-news/models"
+	"devbriefs-news/upstream"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/semper-proficiens/go-utils/web/jsonhandler"
+	"github.com/semper-proficiens/go-utils/web/securehttp"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// CloudflareIPsURL lists the IPv4 and IPv6 ranges Cloudflare proxies traffic from
+const CloudflareIPsURL = "https://api.cloudflare.com/client/v4/ips"
+
+// DefaultRefreshInterval is how often the ranges are refreshed, Cloudflare rarely changes them
+const DefaultRefreshInterval = 6 * time.Hour
+
+// schedulerJob labels the refreshes in metrics.SchedulerLastSuccess
+const schedulerJob = "cloudflare_ranges"
+
+// Ranges are the CIDRs of the trusted proxies
+type Ranges struct {
+	IPv4    []netip.Prefix
+	IPv6    []netip.Prefix
+	Fetched time.Time // When the ranges were fetched from Cloudflare
+}
+
+// Contains tells whether an address belongs to one of the ranges
+func (r *Ranges) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	prefixes := r.IPv6
+	if addr.Is4() {
+		prefixes = r.IPv4
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastKnownGood is how ranges are persisted on disk
+type lastKnownGood struct {
+	IPv4CIDRs []string  `json:"ipv4_cidrs"`
+	IPv6CIDRs []string  `json:"ipv6_cidrs"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+// Manager keeps the Cloudflare ranges up to date. The current ranges are swapped atomically on refresh, so requests
+// always check against a complete list, and every list fetched is persisted to a file loaded when Cloudflare is
+// unreachable.
+type Manager struct {
+	client   upstream.Doer
+	url      string
+	filePath string
+	ranges   atomic.Pointer[Ranges]
+}
+
+// NewManager returns a manager fetching the ranges from url and persisting the last known good ones to filePath,
+// which isn't persisted when empty. It trusts no proxy until loaded.
+func NewManager(client upstream.Doer, url, filePath string) *Manager {
+	m := &Manager{
+		client:   client,
+		url:      url,
+		filePath: filePath,
+	}
+	m.ranges.Store(&Ranges{})
+	return m
+}
+
+// Ranges returns the current ranges
+func (m *Manager) Ranges() *Ranges {
+	return m.ranges.Load()
+}
+
+// Trusted tells whether an address is one of the trusted proxies
+func (m *Manager) Trusted(addr netip.Addr) bool {
+	return m.ranges.Load().Contains(addr)
+}
+
+// Load fetches the ranges, falling back to the last known good ones persisted when Cloudflare is unreachable. It only
+// fails when neither is available, the manager then keeps trusting no proxy until a refresh succeeds.
+func (m *Manager) Load(ctx context.Context) error {
+	fetchErr := m.Refresh(ctx)
+	if fetchErr == nil {
+		return nil
+	}
+	ranges, err := m.readLastKnownGood()
+	if err != nil {
+		return fmt.Errorf("failed to fetch cloudflare ranges (%w) and to load the last known good ones (%w)", fetchErr, err)
+	}
+	slog.WarnContext(ctx, "failed to fetch cloudflare ranges, using the last known good ones",
+		"file", m.filePath, "fetched", ranges.Fetched, logging.Err(fetchErr))
+	m.ranges.Store(ranges)
+	return nil
+}
+
+// Refresh fetches the ranges and swaps them in, keeping the current ones when fetching fails. Successes are recorded in
+// metrics.SchedulerLastSuccess.
+func (m *Manager) Refresh(ctx context.Context) error {
+	ranges, raw, err := m.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	m.ranges.Store(ranges)
+	metrics.SchedulerLastSuccess.WithLabelValues(schedulerJob).Set(float64(ranges.Fetched.Unix()))
+	if err = m.writeLastKnownGood(raw, ranges.Fetched); err != nil {
+		slog.ErrorContext(ctx, "failed to persist cloudflare ranges", "file", m.filePath, logging.Err(err))
+	}
+	return nil
+}
+
+// Run refreshes the ranges every interval until ctx is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil {
+				slog.WarnContext(ctx, "failed to refresh cloudflare ranges, keeping the current ones", logging.Err(err))
+			}
+		}
+	}
+}
+
+func (m *Manager) fetch(ctx context.Context) (*Ranges, models.CloudflareIPRanges, error) {
+	var raw models.CloudflareIPRanges
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return nil, raw, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, raw, err
+	}
+	defer securehttp.ResponseBodyCloser(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, raw, fmt.Errorf("cloudflare returned %s", resp.Status)
+	}
+	if err = jsonhandler.UnmarshalJSONResponse(resp, &raw); err != nil {
+		return nil, raw, err
+	}
+	if !raw.Success {
+		return nil, raw, errors.New("cloudflare returned an unsuccessful response")
+	}
+	ranges, err := parseRanges(raw.Result.IPv4CIDRs, raw.Result.IPv6CIDRs)
+	if err != nil {
+		return nil, raw, err
+	}
+	ranges.Fetched = time.Now().UTC()
+	return ranges, raw, nil
+}
+
+// parseRanges parses and validates CIDRs, rejecting lists that would trust everyone or no one
+func parseRanges(ipv4, ipv6 []string) (*Ranges, error) {
+	if len(ipv4) == 0 || len(ipv6) == 0 {
+		return nil, errors.New("expected both IPv4 and IPv6 ranges")
+	}
+	ranges := &Ranges{}
+	for _, cidr := range append(append([]string{}, ipv4...), ipv6...) {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", cidr, err)
+		}
+		if prefix.Bits() == 0 {
+			return nil, fmt.Errorf("range %q would trust every address", cidr)
+		}
+		if prefix.Addr().Is4() {
+			ranges.IPv4 = append(ranges.IPv4, prefix.Masked())
+		} else {
+			ranges.IPv6 = append(ranges.IPv6, prefix.Masked())
+		}
+	}
+	return ranges, nil
+}
+
+// writeLastKnownGood persists ranges through a temporary file renamed over the previous one, so a crash can't leave a
+// truncated list behind
+func (m *Manager) writeLastKnownGood(raw models.CloudflareIPRanges, fetched time.Time) error {
+	if m.filePath == "" {
+		return nil
+	}
+	body, err := json.MarshalIndent(lastKnownGood{
+		IPv4CIDRs: raw.Result.IPv4CIDRs,
+		IPv6CIDRs: raw.Result.IPv6CIDRs,
+		Fetched:   fetched,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.filePath), filepath.Base(m.filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.filePath)
+}
+
+func (m *Manager) readLastKnownGood() (*Ranges, error) {
+	if m.filePath == "" {
+		return nil, errors.New("no last known good file configured")
+	}
+	body, err := os.ReadFile(m.filePath)
+	if err != nil {
+		return nil, err
+	}
+	var persisted lastKnownGood
+	if err = json.Unmarshal(body, &persisted); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", m.filePath, err)
+	}
+	ranges, err := parseRanges(persisted.IPv4CIDRs, persisted.IPv6CIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", m.filePath, err)
+	}
+	ranges.Fetched = persisted.Fetched
+	return ranges, nil
+}
@@ -0,0 +1,156 @@
+package trustedproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const cloudflareResponse = `{"result":{"ipv4_cidrs":["173.245.48.0/20","104.16.0.0/13"],"ipv6_cidrs":["2400:cb00::/32"]},"success":true}`
+
+// fakeClient answers every request with its current response, or fails with err
+type fakeClient struct {
+	mu     sync.Mutex
+	status int
+	body   string
+	err    error
+}
+
+func (f *fakeClient) Do(*http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: f.status, Status: http.StatusText(f.status), Body: io.NopCloser(strings.NewReader(f.body))}, nil
+}
+
+func (f *fakeClient) set(status int, body string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.body, f.err = status, body, err
+}
+
+func TestManagerTrusted(t *testing.T) {
+	manager := NewManager(&fakeClient{status: http.StatusOK, body: cloudflareResponse}, CloudflareIPsURL, "")
+	if manager.Trusted(netip.MustParseAddr("173.245.48.1")) {
+		t.Fatal("expected no proxy trusted before loading")
+	}
+	if err := manager.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{addr: "173.245.48.1", expected: true},
+		{addr: "104.23.255.255", expected: true},
+		{addr: "::ffff:104.16.0.1", expected: true},
+		{addr: "2400:cb00:1::1", expected: true},
+		{addr: "8.8.8.8", expected: false},
+		{addr: "2001:db8::1", expected: false},
+	}
+	for _, tt := range tests {
+		if got := manager.Trusted(netip.MustParseAddr(tt.addr)); got != tt.expected {
+			t.Errorf("%s: expected trusted %v, got %v", tt.addr, tt.expected, got)
+		}
+	}
+}
+
+func TestManagerLastKnownGood(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudflare_ips.json")
+	client := &fakeClient{status: http.StatusOK, body: cloudflareResponse}
+	if err := NewManager(client, CloudflareIPsURL, path).Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the ranges persisted: %v", err)
+	}
+
+	// a restart while Cloudflare is unreachable falls back to the persisted ranges
+	client.set(0, "", errors.New("connection refused"))
+	manager := NewManager(client, CloudflareIPsURL, path)
+	if err := manager.Load(context.Background()); err != nil {
+		t.Fatalf("expected the last known good ranges loaded, got %v", err)
+	}
+	if !manager.Trusted(netip.MustParseAddr("2400:cb00::1")) {
+		t.Error("expected the persisted IPv6 ranges trusted")
+	}
+
+	// without them, loading fails
+	if err := NewManager(client, CloudflareIPsURL, filepath.Join(t.TempDir(), "missing.json")).Load(context.Background()); err == nil {
+		t.Error("expected an error without ranges")
+	}
+}
+
+func TestManagerRefreshKeepsRangesOnFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    error
+	}{
+		{name: "Unreachable", err: errors.New("connection refused")},
+		{name: "Server error", status: http.StatusBadGateway, body: "bad gateway"},
+		{name: "Unsuccessful", status: http.StatusOK, body: `{"result":{"ipv4_cidrs":["1.1.1.0/24"],"ipv6_cidrs":["2400:cb00::/32"]},"success":false}`},
+		{name: "Missing IPv6", status: http.StatusOK, body: `{"result":{"ipv4_cidrs":["1.1.1.0/24"]},"success":true}`},
+		{name: "Invalid range", status: http.StatusOK, body: `{"result":{"ipv4_cidrs":["1.1.1.0/33"],"ipv6_cidrs":["2400:cb00::/32"]},"success":true}`},
+		{name: "Trusts everyone", status: http.StatusOK, body: `{"result":{"ipv4_cidrs":["0.0.0.0/0"],"ipv6_cidrs":["::/0"]},"success":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cloudflare_ips.json")
+			client := &fakeClient{status: http.StatusOK, body: cloudflareResponse}
+			manager := NewManager(client, CloudflareIPsURL, path)
+			if err := manager.Load(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			persisted, _ := os.ReadFile(path)
+
+			client.set(tt.status, tt.body, tt.err)
+			if err := manager.Refresh(context.Background()); err == nil {
+				t.Fatal("expected the refresh to fail")
+			}
+			if !manager.Trusted(netip.MustParseAddr("173.245.48.1")) || manager.Trusted(netip.MustParseAddr("1.1.1.1")) {
+				t.Error("expected the previous ranges kept")
+			}
+			if current, _ := os.ReadFile(path); string(current) != string(persisted) {
+				t.Error("expected the last known good ranges kept on disk")
+			}
+		})
+	}
+}
+
+// TestManagerConcurrentRefresh checks, with -race, that ranges can be swapped while requests check them
+func TestManagerConcurrentRefresh(t *testing.T) {
+	manager := NewManager(&fakeClient{status: http.StatusOK, body: cloudflareResponse}, CloudflareIPsURL, "")
+	addr := netip.MustParseAddr("173.245.48.1")
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_ = manager.Refresh(context.Background())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				manager.Trusted(addr)
+			}
+		}()
+	}
+	wg.Wait()
+	if !manager.Trusted(addr) {
+		t.Error("expected the address trusted once refreshed")
+	}
+}
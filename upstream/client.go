@@ -0,0 +1,154 @@
+// Package upstream makes the HTTP requests to the providers we depend on (NewsAPI, Cloudflare), in the context of the
+// request or job they're made for
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UserAgent identifies our requests to the providers
+const UserAgent = "devbriefs-news (+https://github.com/semper-proficiens/devbriefs-news)"
+
+// DefaultMaxResponseBytes is the largest response body read from a provider, a NewsAPI page of 100 articles being
+// a few hundred KB
+const DefaultMaxResponseBytes = 10 << 20
+
+// ErrResponseTooLarge is returned reading a response body larger than the limit of the client
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// Doer sends HTTP requests, e.g. *http.Client. Requests are cancelled with their context.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// StatusError is a response of a provider with a status code other than 2xx
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // The Retry-After of a 429 or 503, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status code %d", e.StatusCode)
+}
+
+// Client sends the requests to a provider with our User-Agent. Responses other than 2xx are returned as a
+// StatusError, and bodies fail with ErrResponseTooLarge past MaxResponseBytes.
+type Client struct {
+	UserAgent        string
+	MaxResponseBytes int64
+
+	doer Doer
+}
+
+func NewClient(doer Doer) *Client {
+	return &Client{
+		UserAgent:        UserAgent,
+		MaxResponseBytes: DefaultMaxResponseBytes,
+		doer:             doer,
+	}
+}
+
+// NewSecureHTTPClient returns an HTTP client only speaking TLS 1.2 or higher with modern ciphers, over HTTP/2 when
+// available. Its timeout bounds requests made without a deadline.
+func NewSecureHTTPClient() *http.Client {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:          rootCAs,
+				MinVersion:       tls.VersionTLS12,
+				CurvePreferences: []tls.CurveID{tls.CurveP256, tls.X25519},
+				CipherSuites: []uint16{
+					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+				},
+			},
+			ForceAttemptHTTP2: true,
+			MaxIdleConns:      100,
+			IdleConnTimeout:   60 * time.Second,
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+// Do sends req, returning its 2xx response or an error
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// the response tells how long to wait before retrying
+		err = &StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+		drain(resp.Body)
+		return nil, err
+	}
+	if resp.ContentLength > c.MaxResponseBytes {
+		drain(resp.Body)
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, resp.ContentLength)
+	}
+	resp.Body = &limitedBody{body: resp.Body, remaining: c.MaxResponseBytes}
+	return resp, nil
+}
+
+// limitedBody fails with ErrResponseTooLarge once more than remaining bytes are read, rather than truncating the body
+// into something that may still parse
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// read one byte more than allowed to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// drain closes a body read until the end, so its connection can be reused
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	_ = body.Close()
+}
@@ -0,0 +1,97 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             int
+		header             http.Header
+		body               string
+		streamed           bool // Whether the body is sent without a Content-Length
+		expectedErr        error
+		expectedStatus     int // of the StatusError returned, if any
+		expectedRetryAfter time.Duration
+	}{
+		{name: "Success", status: http.StatusOK, body: "0123456789"},
+		{name: "Rate limited", status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"30"}}, expectedStatus: http.StatusTooManyRequests, expectedRetryAfter: 30 * time.Second},
+		{name: "Unauthorized", status: http.StatusUnauthorized, expectedStatus: http.StatusUnauthorized},
+		{name: "Too large", status: http.StatusOK, body: "0123456789a", expectedErr: ErrResponseTooLarge},
+		{name: "Too large streamed", status: http.StatusOK, body: "0123456789a", streamed: true, expectedErr: ErrResponseTooLarge},
+		{name: "Streamed", status: http.StatusOK, body: "0123456789", streamed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+				for name, values := range tt.header {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+				if tt.streamed {
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer server.Close()
+
+			client := NewClient(server.Client())
+			client.MaxResponseBytes = 10
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				var body []byte
+				body, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				if err == nil && string(body) != tt.body {
+					t.Errorf("expected body %q, got %q", tt.body, body)
+				}
+			}
+
+			if userAgent != UserAgent {
+				t.Errorf("expected User-Agent %q, got %q", UserAgent, userAgent)
+			}
+			if tt.expectedStatus != 0 {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) {
+					t.Fatalf("expected a status error, got %v", err)
+				}
+				if statusErr.StatusCode != tt.expectedStatus || statusErr.RetryAfter != tt.expectedRetryAfter {
+					t.Errorf("expected %d after %v, got %d after %v", tt.expectedStatus, tt.expectedRetryAfter, statusErr.StatusCode, statusErr.RetryAfter)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter("120"); d != 2*time.Minute {
+		t.Errorf("expected 2m, got %v", d)
+	}
+	if d := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected about an hour, got %v", d)
+	}
+	if d := retryAfter("soon"); d != 0 {
+		t.Errorf("expected no wait for an invalid value, got %v", d)
+	}
+}
+
+func TestLimitedBodyExactLimit(t *testing.T) {
+	body := &limitedBody{body: io.NopCloser(strings.NewReader("0123456789")), remaining: 10}
+	if data, err := io.ReadAll(body); err != nil || string(data) != "0123456789" {
+		t.Errorf("expected a body of exactly the limit to be read, got %q, %v", data, err)
+	}
+}
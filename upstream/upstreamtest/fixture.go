@@ -0,0 +1,94 @@
+// Package upstreamtest records the responses of the providers we depend on into fixtures, and replays them in process
+// or from a fake server, so the fetch pipeline is tested offline against real responses.
+//
+// Fixtures are JSON files, one per method and path, e.g. testdata/newsapi/GET_v2_everything.json. They're recorded by
+// running the tests using them with UPSTREAM_RECORD=1 and the credentials of the provider, which are scrubbed from the
+// fixtures.
+package upstreamtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fixture is a response of a provider, recorded for a method and path
+type Fixture struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Status int             `json:"status"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// scrubbed replaces the credentials in the recorded fixtures
+const scrubbed = "REDACTED"
+
+// recordedHeaders are the response headers kept in fixtures, the others being irrelevant to our clients or, like
+// Set-Cookie, possibly sensitive
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+// FileName is the name of the fixture file of a method and path, e.g. GET_v2_everything.json
+func FileName(method, path string) string {
+	return method + "_" + strings.ReplaceAll(strings.Trim(path, "/"), "/", "_") + ".json"
+}
+
+// Load loads the fixtures of dir
+func Load(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixture in %s", dir)
+	}
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fixture Fixture
+		if err = json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// Save writes a fixture to dir, indented so changes in a new recording can be reviewed
+func (f Fixture) Save(dir string) error {
+	var body bytes.Buffer
+	if err := json.Indent(&body, f.Body, "", "  "); err == nil {
+		f.Body = body.Bytes()
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, FileName(f.Method, f.Path)), append(data, '\n'), 0o644)
+}
+
+// scrub replaces every secret in the body and headers of the fixture
+func (f Fixture) scrub(secrets []string) Fixture {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		f.Body = bytes.ReplaceAll(f.Body, []byte(secret), []byte(scrubbed))
+		for name, values := range f.Header {
+			for i, value := range values {
+				f.Header[name][i] = strings.ReplaceAll(value, secret, scrubbed)
+			}
+		}
+	}
+	return f
+}
@@ -0,0 +1,118 @@
+package upstreamtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// RecordEnv is the environment variable recording the fixtures from the real providers when set to 1
+const RecordEnv = "UPSTREAM_RECORD"
+
+// Handler serves fixtures as the provider they were recorded from would, matched by method and path regardless of
+// the query
+type Handler struct {
+	// APIKey, when set, is required in the X-Api-Key header like NewsAPI does, requests without it getting a 401
+	APIKey string
+
+	fixtures map[string]Fixture
+}
+
+func NewHandler(fixtures []Fixture) *Handler {
+	h := &Handler{fixtures: make(map[string]Fixture, len(fixtures))}
+	for _, fixture := range fixtures {
+		h.fixtures[fixture.Method+" "+fixture.Path] = fixture
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if h.APIKey != "" && r.Header.Get("X-Api-Key") != h.APIKey {
+		// as NewsAPI answers
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"status":"error","code":"apiKeyInvalid","message":"Your API key is invalid or incorrect."}`)
+		return
+	}
+	fixture, ok := h.fixtures[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"status":"error","code":"fixtureNotFound","message":"No fixture recorded for this request."}`)
+		return
+	}
+	for name, values := range fixture.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(fixture.Status)
+	_, _ = w.Write(fixture.Body)
+}
+
+// Transport is a fake HTTP transport serving the requests with Handler in process, failing the cancelled ones as
+// net/http does
+type Transport struct {
+	Handler http.Handler
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	t.Handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Recorder is an HTTP transport saving the responses it gets from the provider into fixtures in Dir, with Secrets
+// and the X-Api-Key of the requests scrubbed
+type Recorder struct {
+	Transport http.RoundTripper
+	Dir       string
+	Secrets   []string
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{Method: req.Method, Path: req.URL.Path, Status: resp.StatusCode, Header: http.Header{}, Body: body}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			fixture.Header.Set(name, value)
+		}
+	}
+	fixture = fixture.scrub(append([]string{req.Header.Get("X-Api-Key")}, r.Secrets...))
+	if err = fixture.Save(r.Dir); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Client returns an HTTP client replaying the fixtures of dir, or recording them from the real provider when
+// UPSTREAM_RECORD=1, with secrets scrubbed, e.g.
+//
+//	UPSTREAM_RECORD=1 GOOGLE_NEWS_API_KEY=$apiKey go test ./services -run TestFetchEverythingNews
+func Client(t testing.TB, dir string, secrets ...string) *http.Client {
+	t.Helper()
+	if os.Getenv(RecordEnv) == "1" {
+		t.Logf("recording fixtures into %s", dir)
+		return &http.Client{Transport: &Recorder{Transport: http.DefaultTransport, Dir: dir, Secrets: secrets}}
+	}
+	fixtures, err := Load(dir)
+	if err != nil {
+		t.Fatalf("failed to load fixtures, record them with %s=1: %v", RecordEnv, err)
+	}
+	return &http.Client{Transport: &Transport{Handler: NewHandler(fixtures)}}
+}
@@ -0,0 +1,62 @@
+package upstreamtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		// some providers echo the key back, e.g. in errors
+		_, _ = io.WriteString(w, `{"status":"ok","key":"`+r.Header.Get("X-Api-Key")+`","account":"secret-account"}`)
+	}))
+	defer provider.Close()
+	dir := t.TempDir()
+
+	recorder := &http.Client{Transport: &Recorder{Transport: http.DefaultTransport, Dir: dir, Secrets: []string{"secret-account"}}}
+	req, _ := http.NewRequest(http.MethodGet, provider.URL+"/v2/everything?q=hacker", nil)
+	req.Header.Set("X-Api-Key", "secret-key")
+	resp, err := recorder.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "secret-key") {
+		t.Errorf("expected the recorded response to be returned as is, got %s", body)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "GET_v2_everything.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-key", "secret-account", "secret-session"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %s to be scrubbed from the fixture, got %s", secret, data)
+		}
+	}
+
+	// the fixture is replayed for the same path, whatever the query
+	fixtures, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := &http.Client{Transport: &Transport{Handler: NewHandler(fixtures)}}
+	resp, err = replayer.Get("https://newsapi.org/v2/everything?q=ransomware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"key": "REDACTED"`) {
+		t.Errorf("expected the scrubbed fixture, got %d %s", resp.StatusCode, body)
+	}
+	if resp, err = replayer.Get("https://newsapi.org/v2/top-headlines"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 without fixture, got %v", err)
+	}
+}